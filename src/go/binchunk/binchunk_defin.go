@@ -1,5 +1,7 @@
 package binchunk
 
+import "fmt"
+
 const (
 	LUA_SIGNATURE    = "\x1bLua"
 	LUA_VERSION      = 0x53
@@ -23,6 +25,43 @@ const (
 	TAG_LONG_STR  = 0x14
 )
 
+//Format 二进制chunk头里声明的各种类型的大小和字节序；
+//读取时使用chunk头里的值，值本身能用Prototype表示就可以，比如64位luac的8字节size_t或者大端的chunk
+type Format struct {
+	BigEndian       bool
+	IntSize         byte //int：行号、数组的长度等，1到8个字节
+	SizetSize       byte //size_t：长字符串的长度，1到8个字节
+	InstructionSize byte //4到8个字节
+	IntegerSize     byte //lua_Integer，1到8个字节
+	NumberSize      byte //lua_Number，只支持4(float)或者8(double)
+}
+
+//DefaultFormat Dump使用的格式，和本项目以前读写的chunk一样
+var DefaultFormat = Format{
+	IntSize:         CINT_SIZE,
+	SizetSize:       CSIZET_SIZE,
+	InstructionSize: INSTRUCTION_SIZE,
+	IntegerSize:     LUA_INTEGER_SIZE,
+	NumberSize:      LUA_NUMBER_SIZE,
+}
+
+//unsupported 返回不支持的原因，都支持时返回空串
+func (format Format) unsupported() string {
+	switch {
+	case format.IntSize < 1 || format.IntSize > 8:
+		return fmt.Sprintf("int size %d not supported", format.IntSize)
+	case format.SizetSize < 1 || format.SizetSize > 8:
+		return fmt.Sprintf("size_t size %d not supported", format.SizetSize)
+	case format.InstructionSize < 4 || format.InstructionSize > 8:
+		return fmt.Sprintf("Instruction size %d not supported", format.InstructionSize)
+	case format.IntegerSize < 1 || format.IntegerSize > 8:
+		return fmt.Sprintf("lua_Integer size %d not supported", format.IntegerSize)
+	case format.NumberSize != 4 && format.NumberSize != 8:
+		return fmt.Sprintf("lua_Number size %d not supported", format.NumberSize)
+	}
+	return ""
+}
+
 type header struct {
 	signature       [4]byte
 	version         byte
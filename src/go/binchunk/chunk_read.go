@@ -1,41 +1,114 @@
 package binchunk
 
 import (
-	"encoding/binary"
+	"fmt"
 	"math"
 )
 
+//UndumpError 二进制chunk损坏或者不兼容，Offset是出错处距chunk开头的字节数
+type UndumpError struct {
+	Offset  int
+	Section string //正在读的部分：header、function、code、constants、upvalues、protos、line info、local vars或者upvalue names
+	Msg     string
+}
+
+func (err *UndumpError) Error() string {
+	return fmt.Sprintf("bad binary chunk at offset %d (%s): %s", err.Offset, err.Section, err.Msg)
+}
+
 type chunkReader struct {
-	data []byte
+	data    []byte
+	format  Format //从chunk头读出来的格式
+	size    int    //整个chunk的长度，用来计算偏移
+	section string //正在读的部分，用于报错
+}
+
+func (reader *chunkReader) offset() int {
+	return reader.size - len(reader.data)
+}
+
+func (reader *chunkReader) error(f string, a ...interface{}) {
+	panic(&UndumpError{
+		Offset:  reader.offset(),
+		Section: reader.section,
+		Msg:     fmt.Sprintf(f, a...),
+	})
+}
+
+//need 剩下的数据至少要有n个字节
+func (reader *chunkReader) need(n uint) {
+	if uint(len(reader.data)) < n {
+		reader.error("truncated (need %d bytes, %d left)", n, len(reader.data))
+	}
+}
+
+//readCount 读数组的长度，每个元素至少占elemSize个字节，防止损坏的长度分配出巨大的数组
+func (reader *chunkReader) readCount(elemSize uint) int {
+	n := uint(reader.readInt())
+	if n > uint(len(reader.data))/elemSize {
+		reader.error("bad count %d (only %d bytes left)", n, len(reader.data))
+	}
+	return int(n)
 }
 
 func (reader *chunkReader) readByte() byte {
+	reader.need(1)
 	b := reader.data[0]
 	reader.data = reader.data[1:]
 	return b
 }
 
-func (reader *chunkReader) readUint32() uint32 {
-	i := binary.LittleEndian.Uint32(reader.data)
-	reader.data = reader.data[4:]
+//readUint 按chunk的字节序读n个字节的无符号整数
+func (reader *chunkReader) readUint(n byte) uint64 {
+	bytes := reader.readBytes(uint(n))
+	var i uint64
+	for k := range bytes {
+		if reader.format.BigEndian {
+			i = i<<8 | uint64(bytes[k])
+		} else {
+			i |= uint64(bytes[k]) << (8 * uint(k))
+		}
+	}
 	return i
 }
 
-func (reader *chunkReader) readUint64() uint64 {
-	i := binary.LittleEndian.Uint64(reader.data)
-	reader.data = reader.data[8:]
-	return i
+//readUint32 读n个字节的无符号整数，值必须能用uint32表示
+func (reader *chunkReader) readUint32(n byte, what string) uint32 {
+	data := reader.data
+	i := reader.readUint(n)
+	if i > math.MaxUint32 {
+		reader.data = data
+		reader.error("%s %d too large", what, i)
+	}
+	return uint32(i)
+}
+
+func (reader *chunkReader) readInt() uint32 {
+	return reader.readUint32(reader.format.IntSize, "int")
+}
+
+func (reader *chunkReader) readSizet() uint32 {
+	return reader.readUint32(reader.format.SizetSize, "size_t")
+}
+
+func (reader *chunkReader) readInstruction() uint32 {
+	return reader.readUint32(reader.format.InstructionSize, "instruction")
 }
 
 func (reader *chunkReader) readLuaInteger() int64 {
-	return int64(reader.readUint64())
+	shift := 64 - 8*uint(reader.format.IntegerSize)
+	return int64(reader.readUint(reader.format.IntegerSize)<<shift) >> shift //符号扩展
 }
 
 func (reader *chunkReader) readLuaNumber() float64 {
-	return math.Float64frombits(reader.readUint64())
+	if reader.format.NumberSize == 4 {
+		return float64(math.Float32frombits(uint32(reader.readUint(4))))
+	}
+	return math.Float64frombits(reader.readUint(8))
 }
 
 func (reader *chunkReader) readBytes(n uint) []byte {
+	reader.need(n)
 	bytes := reader.data[:n]
 	reader.data = reader.data[n:]
 	return bytes
@@ -46,50 +119,61 @@ func (reader *chunkReader) readString() string {
 	if size == 0 {
 		return ""
 	}
-	if size == 0xFF { //长字符串
-		size = uint(reader.readUint64())
+	if size == 0xFF { //长字符串，长度是size_t
+		if size = uint(reader.readSizet()); size == 0 {
+			reader.error("bad string size 0")
+		}
 	}
 	bytes := reader.readBytes(size - 1)
 	return string(bytes)
 }
 
+//checkHeader 检查chunk头并读出格式；字节序由LUAC_INT的读法决定
 func (reader *chunkReader) checkHeader() {
-	if str := string(reader.readBytes(4)); str != LUA_SIGNATURE {
-		panic("not a lua chunk file!!" + str)
-	} else if reader.readByte() != LUA_VERSION {
-		panic("Lua Version not match!!!")
-	} else if reader.readByte() != LUA_FORMAT {
-		panic("Lua Format not match!")
-	} else if string(reader.readBytes(6)) != LUA_DATA {
-		panic("LUA_DATA not match")
-	} else if reader.readByte() != CINT_SIZE {
-		panic("CINT_SIZE not match")
-	} else if reader.readByte() != CSIZET_SIZE {
-		panic("CSIZET_SIZE not match")
-	} else if reader.readByte() != INSTRUCTION_SIZE {
-		panic("INSTRUCTION_SIZE not match")
-	} else if reader.readByte() != LUA_INTEGER_SIZE {
-		panic("LUA_INTEGER_SIZE not match")
-	} else if reader.readByte() != LUA_NUMBER_SIZE {
-		panic("LUA_NUMBER_SIZE not match")
-	} else if reader.readLuaInteger() != LUAC_INT {
-		panic("LUAC_INT not match")
-	} else if num := reader.readLuaNumber(); num != LUAC_NUM {
-		println(num)
-		panic("LUAC_NUM not match: ")
-	}
-	println("===== check header succ =======")
+	reader.section = "header"
+	check := func(ok func() bool, msg string) {
+		data := reader.data
+		if !ok() {
+			reader.data = data //报告字段开头的偏移
+			reader.error("%s", msg)
+		}
+	}
+	check(func() bool { return string(reader.readBytes(4)) == LUA_SIGNATURE }, "not a binary chunk")
+	check(func() bool { return reader.readByte() == LUA_VERSION }, "version mismatch")
+	check(func() bool { return reader.readByte() == LUA_FORMAT }, "format mismatch")
+	check(func() bool { return string(reader.readBytes(6)) == LUA_DATA }, "corrupted")
+
+	format := &reader.format
+	data := reader.data
+	sizes := reader.readBytes(5)
+	format.IntSize, format.SizetSize, format.InstructionSize = sizes[0], sizes[1], sizes[2]
+	format.IntegerSize, format.NumberSize = sizes[3], sizes[4]
+	if msg := format.unsupported(); msg != "" {
+		reader.data = data
+		reader.error("%s", msg)
+	}
+
+	check(func() bool {
+		data := reader.data
+		if reader.readLuaInteger() == LUAC_INT {
+			return true
+		}
+		reader.data, format.BigEndian = data, true
+		return reader.readLuaInteger() == LUAC_INT
+	}, "endianness mismatch")
+	check(func() bool { return reader.readLuaNumber() == LUAC_NUM }, "float format mismatch")
 }
 
 func (reader *chunkReader) readProto(parentSource string) *Prototype {
+	reader.section = "function"
 	source := reader.readString()
 	if source == "" {
 		source = parentSource
 	}
 	return &Prototype{
 		Source:          source,
-		LineDefine:      reader.readUint32(),
-		LastLineDefined: reader.readUint32(),
+		LineDefine:      reader.readInt(),
+		LastLineDefined: reader.readInt(),
 		NumParams:       reader.readByte(),
 		IsVarargs:       reader.readByte(),
 		MaxStatckSize:   reader.readByte(),
@@ -104,7 +188,8 @@ func (reader *chunkReader) readProto(parentSource string) *Prototype {
 }
 
 func (reader *chunkReader) readUpvalueNames() []string {
-	names := make([]string, reader.readUint32())
+	reader.section = "upvalue names"
+	names := make([]string, reader.readCount(1))
 	for i := range names {
 		names[i] = reader.readString()
 	}
@@ -112,27 +197,30 @@ func (reader *chunkReader) readUpvalueNames() []string {
 }
 
 func (reader *chunkReader) readLocVars() []LocVar {
-	vars := make([]LocVar, reader.readUint32())
+	reader.section = "local vars"
+	vars := make([]LocVar, reader.readCount(1+2*uint(reader.format.IntSize)))
 	for i := range vars {
 		vars[i] = LocVar{
 			VarName: reader.readString(),
-			StartPC: reader.readUint32(),
-			EndPC:   reader.readUint32(),
+			StartPC: reader.readInt(),
+			EndPC:   reader.readInt(),
 		}
 	}
 	return vars
 }
 
 func (reader *chunkReader) readLineInfo() []uint32 {
-	lineInfos := make([]uint32, reader.readUint32())
+	reader.section = "line info"
+	lineInfos := make([]uint32, reader.readCount(uint(reader.format.IntSize)))
 	for i := range lineInfos {
-		lineInfos[i] = reader.readUint32()
+		lineInfos[i] = reader.readInt()
 	}
 	return lineInfos
 }
 
 func (reader *chunkReader) readProtos(source string) []*Prototype {
-	protos := make([]*Prototype, reader.readUint32())
+	reader.section = "protos"
+	protos := make([]*Prototype, reader.readCount(1))
 	for i := range protos {
 		protos[i] = reader.readProto(source)
 	}
@@ -140,7 +228,8 @@ func (reader *chunkReader) readProtos(source string) []*Prototype {
 }
 
 func (reader *chunkReader) readUpvalues() []Upvalue {
-	upvalues := make([]Upvalue, reader.readUint32())
+	reader.section = "upvalues"
+	upvalues := make([]Upvalue, reader.readCount(2))
 
 	for i := range upvalues {
 		upvalues[i].Instatck = reader.readByte()
@@ -150,15 +239,17 @@ func (reader *chunkReader) readUpvalues() []Upvalue {
 }
 
 func (reader *chunkReader) readCode() []uint32 {
-	code := make([]uint32, reader.readUint32())
+	reader.section = "code"
+	code := make([]uint32, reader.readCount(uint(reader.format.InstructionSize)))
 	for i := range code {
-		code[i] = reader.readUint32()
+		code[i] = reader.readInstruction()
 	}
 	return code
 }
 
 func (reader *chunkReader) readConstants() []interface{} {
-	constants := make([]interface{}, reader.readUint32())
+	reader.section = "constants"
+	constants := make([]interface{}, reader.readCount(1))
 	for i := range constants {
 		constants[i] = reader.readConstant()
 	}
@@ -166,7 +257,8 @@ func (reader *chunkReader) readConstants() []interface{} {
 }
 
 func (reader *chunkReader) readConstant() interface{} {
-	switch reader.readByte() {
+	data := reader.data
+	switch tag := reader.readByte(); tag {
 	case TAG_NIL:
 		return nil
 	case TAG_BOOLEAN:
@@ -180,15 +272,36 @@ func (reader *chunkReader) readConstant() interface{} {
 	case TAG_LONG_STR:
 		return reader.readString()
 	default:
-		panic("undefine lua val type!!!")
+		reader.data = data
+		reader.error("bad constant type %#x", tag)
+		return nil
 	}
 }
 
-//Undump 解析lua chunk文件
+//Undump 解析lua chunk文件，chunk损坏时panic，见UndumpErr
 func Undump(data []byte) *Prototype {
-	reader := &chunkReader{data}
+	proto, err := UndumpErr(data)
+	if err != nil {
+		panic(err)
+	}
+	return proto
+}
+
+//UndumpErr 解析lua chunk文件，chunk损坏、被截断或者和本机的格式不同时返回*UndumpError
+func UndumpErr(data []byte) (proto *Prototype, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			undumpErr, ok := r.(*UndumpError)
+			if !ok {
+				panic(r)
+			}
+			proto, err = nil, undumpErr
+		}
+	}()
+
+	reader := &chunkReader{data: data, size: len(data)}
 	reader.checkHeader()
 
 	reader.readByte()
-	return reader.readProto("")
+	return reader.readProto(""), nil
 }
@@ -0,0 +1,64 @@
+package binchunk
+
+import (
+	"strings"
+	"testing"
+)
+
+//TestUndumpTruncated chunk在任何地方被截断都返回*UndumpError，不会panic
+func TestUndumpTruncated(t *testing.T) {
+	for path, data := range luacChunks(t) {
+		for n := 0; n < len(data); n++ {
+			proto, err := UndumpErr(data[:n])
+			if err == nil {
+				t.Errorf("%s: truncated to %d bytes: no error", path, n)
+				continue
+			}
+			if proto != nil {
+				t.Errorf("%s: truncated to %d bytes: got a prototype with the error", path, n)
+			}
+			if undumpErr, ok := err.(*UndumpError); !ok || undumpErr.Offset > n {
+				t.Errorf("%s: truncated to %d bytes: %v", path, n, err)
+			}
+		}
+	}
+}
+
+func TestUndumpErrors(t *testing.T) {
+	var data []byte
+	for _, chunk := range luacChunks(t) {
+		data = chunk
+		break
+	}
+	corrupt := func(offset int, b byte) []byte {
+		c := append([]byte(nil), data...)
+		c[offset] = b
+		return c
+	}
+	tests := []struct {
+		data    []byte
+		offset  int
+		section string
+		msg     string
+	}{
+		{[]byte("print(1)"), 0, "header", "not a binary chunk"},
+		{corrupt(4, 0x52), 4, "header", "version mismatch"},
+		{corrupt(5, 1), 5, "header", "format mismatch"},
+		{corrupt(6, 0), 6, "header", "corrupted"},
+		{corrupt(14, 3), 12, "header", "Instruction size 3 not supported"},
+		{corrupt(16, 5), 12, "header", "lua_Number size 5 not supported"},
+		{corrupt(17, 0), 17, "header", "endianness mismatch"},
+		{data[:20], 17, "header", ""},
+	}
+	for _, tt := range tests {
+		_, err := UndumpErr(tt.data)
+		undumpErr, ok := err.(*UndumpError)
+		if !ok {
+			t.Errorf("%q: got %v", tt.msg, err)
+			continue
+		}
+		if undumpErr.Offset != tt.offset || undumpErr.Section != tt.section || !strings.Contains(undumpErr.Msg, tt.msg) {
+			t.Errorf("got %+v, want offset %d, section %s, %q", undumpErr, tt.offset, tt.section, tt.msg)
+		}
+	}
+}
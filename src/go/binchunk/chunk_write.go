@@ -0,0 +1,246 @@
+package binchunk
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const LUAI_MAXSHORTLEN = 40 //短字符串的最大长度
+
+type chunkWriter struct {
+	buf    []byte
+	strip  bool
+	format Format
+}
+
+//dumpError 值不能用目标格式表示，DumpFormat把它变成error返回
+type dumpError string
+
+func (writer *chunkWriter) error(f string, a ...interface{}) {
+	panic(dumpError(fmt.Sprintf(f, a...)))
+}
+
+func (writer *chunkWriter) writeByte(b byte) {
+	writer.buf = append(writer.buf, b)
+}
+
+func (writer *chunkWriter) writeBytes(bytes []byte) {
+	writer.buf = append(writer.buf, bytes...)
+}
+
+//writeUint 按目标格式的字节序写n个字节的无符号整数
+func (writer *chunkWriter) writeUint(i uint64, n byte, what string) {
+	if n < 8 && i>>(8*uint(n)) != 0 {
+		writer.error("%s %d does not fit in %d bytes", what, i, n)
+	}
+	for k := byte(0); k < n; k++ {
+		if writer.format.BigEndian {
+			writer.writeByte(byte(i >> (8 * uint(n-1-k))))
+		} else {
+			writer.writeByte(byte(i >> (8 * uint(k))))
+		}
+	}
+}
+
+func (writer *chunkWriter) writeInt(i uint32) {
+	writer.writeUint(uint64(i), writer.format.IntSize, "int")
+}
+
+func (writer *chunkWriter) writeSizet(i uint32) {
+	writer.writeUint(uint64(i), writer.format.SizetSize, "size_t")
+}
+
+func (writer *chunkWriter) writeInstruction(i uint32) {
+	writer.writeUint(uint64(i), writer.format.InstructionSize, "instruction")
+}
+
+func (writer *chunkWriter) writeLuaInteger(i int64) {
+	n := writer.format.IntegerSize
+	if shift := 64 - 8*uint(n); i<<shift>>shift != i {
+		writer.error("integer %d does not fit in %d bytes", i, n)
+	}
+	writer.writeUint(uint64(i)&(math.MaxUint64>>(64-8*uint(n))), n, "integer")
+}
+
+func (writer *chunkWriter) writeLuaNumber(n float64) {
+	if writer.format.NumberSize == 4 {
+		f := float32(n)
+		if float64(f) != n && !math.IsNaN(n) {
+			writer.error("number %g cannot be represented as float", n)
+		}
+		writer.writeUint(uint64(math.Float32bits(f)), 4, "number")
+		return
+	}
+	writer.writeUint(math.Float64bits(n), 8, "number")
+}
+
+//writeNilString 写入NULL字符串，读回来时是空串
+func (writer *chunkWriter) writeNilString() {
+	writer.writeByte(0)
+}
+
+func (writer *chunkWriter) writeString(s string) {
+	size := len(s) + 1
+	if size < 0xFF {
+		writer.writeByte(byte(size))
+	} else { //长字符串
+		writer.writeByte(0xFF)
+		writer.writeSizet(uint32(size))
+	}
+	writer.writeBytes([]byte(s))
+}
+
+func (writer *chunkWriter) writeHeader() {
+	writer.writeBytes([]byte(LUA_SIGNATURE))
+	writer.writeByte(LUA_VERSION)
+	writer.writeByte(LUA_FORMAT)
+	writer.writeBytes([]byte(LUA_DATA))
+	writer.writeByte(writer.format.IntSize)
+	writer.writeByte(writer.format.SizetSize)
+	writer.writeByte(writer.format.InstructionSize)
+	writer.writeByte(writer.format.IntegerSize)
+	writer.writeByte(writer.format.NumberSize)
+	writer.writeLuaInteger(LUAC_INT)
+	writer.writeLuaNumber(LUAC_NUM)
+}
+
+func (writer *chunkWriter) writeProto(proto *Prototype, parentSource string) {
+	if writer.strip || (parentSource != "" && proto.Source == parentSource) {
+		writer.writeNilString()
+	} else {
+		writer.writeString(proto.Source)
+	}
+	writer.writeInt(proto.LineDefine)
+	writer.writeInt(proto.LastLineDefined)
+	writer.writeByte(proto.NumParams)
+	writer.writeByte(proto.IsVarargs)
+	writer.writeByte(proto.MaxStatckSize)
+	writer.writeCode(proto.Code)
+	writer.writeConstants(proto.Constants)
+	writer.writeUpvalues(proto.Upvalues)
+	writer.writeProtos(proto.Protos, proto.Source)
+	if writer.strip {
+		writer.writeInt(0) //lineinfo
+		writer.writeInt(0) //locvars
+		writer.writeInt(0) //upvalue names
+		return
+	}
+	writer.writeLineInfo(proto.LineInfo)
+	writer.writeLocVars(proto.LocVars)
+	writer.writeUpvalueNames(proto.UpvalueNames)
+}
+
+func (writer *chunkWriter) writeCode(code []uint32) {
+	writer.writeInt(uint32(len(code)))
+	for _, inst := range code {
+		writer.writeInstruction(inst)
+	}
+}
+
+func (writer *chunkWriter) writeConstants(constants []interface{}) {
+	writer.writeInt(uint32(len(constants)))
+	for _, k := range constants {
+		writer.writeConstant(k)
+	}
+}
+
+func (writer *chunkWriter) writeConstant(k interface{}) {
+	switch x := k.(type) {
+	case nil:
+		writer.writeByte(TAG_NIL)
+	case bool:
+		writer.writeByte(TAG_BOOLEAN)
+		if x {
+			writer.writeByte(1)
+		} else {
+			writer.writeByte(0)
+		}
+	case float64:
+		writer.writeByte(TAG_NUMBER)
+		writer.writeLuaNumber(x)
+	case int64:
+		writer.writeByte(TAG_INTEGER)
+		writer.writeLuaInteger(x)
+	case string:
+		if len(x) <= LUAI_MAXSHORTLEN {
+			writer.writeByte(TAG_SHORT_STR)
+		} else {
+			writer.writeByte(TAG_LONG_STR)
+		}
+		writer.writeString(x)
+	default:
+		panic("undefine lua val type!!!")
+	}
+}
+
+func (writer *chunkWriter) writeUpvalues(upvalues []Upvalue) {
+	writer.writeInt(uint32(len(upvalues)))
+	for _, upval := range upvalues {
+		writer.writeByte(upval.Instatck)
+		writer.writeByte(upval.Idx)
+	}
+}
+
+func (writer *chunkWriter) writeProtos(protos []*Prototype, source string) {
+	writer.writeInt(uint32(len(protos)))
+	for _, proto := range protos {
+		writer.writeProto(proto, source)
+	}
+}
+
+func (writer *chunkWriter) writeLineInfo(lineInfo []uint32) {
+	writer.writeInt(uint32(len(lineInfo)))
+	for _, line := range lineInfo {
+		writer.writeInt(line)
+	}
+}
+
+func (writer *chunkWriter) writeLocVars(locVars []LocVar) {
+	writer.writeInt(uint32(len(locVars)))
+	for _, locVar := range locVars {
+		writer.writeString(locVar.VarName)
+		writer.writeInt(locVar.StartPC)
+		writer.writeInt(locVar.EndPC)
+	}
+}
+
+func (writer *chunkWriter) writeUpvalueNames(names []string) {
+	writer.writeInt(uint32(len(names)))
+	for _, name := range names {
+		writer.writeString(name)
+	}
+}
+
+//Dump 把函数原型序列化成lua chunk，strip为true时丢弃调试信息
+func Dump(proto *Prototype, strip bool) []byte {
+	data, err := DumpFormat(proto, strip, DefaultFormat)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+//DumpFormat 按format序列化函数原型，比如给size_t是8个字节或者大端的目标机器生成chunk；
+//format不支持，或者有值(比如常量)不能用format表示时返回错误
+func DumpFormat(proto *Prototype, strip bool, format Format) (data []byte, err error) {
+	if msg := format.unsupported(); msg != "" {
+		return nil, errors.New(msg)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			msg, ok := r.(dumpError)
+			if !ok {
+				panic(r)
+			}
+			data, err = nil, errors.New(string(msg))
+		}
+	}()
+
+	writer := &chunkWriter{strip: strip, format: format}
+	writer.writeHeader()
+
+	writer.writeByte(byte(len(proto.Upvalues)))
+	writer.writeProto(proto, "")
+	return writer.buf, nil
+}
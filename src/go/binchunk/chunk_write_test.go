@@ -0,0 +1,85 @@
+package binchunk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//luacChunks 返回src/lua下luac 5.3生成的所有chunk
+func luacChunks(t *testing.T) map[string][]byte {
+	t.Helper()
+	paths, err := filepath.Glob("../../lua/*/luac.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no luac.out found")
+	}
+	chunks := map[string][]byte{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks[path] = data
+	}
+	return chunks
+}
+
+//TestDumpRoundTrip Dump写出的chunk和luac写的逐字节相同
+func TestDumpRoundTrip(t *testing.T) {
+	for path, data := range luacChunks(t) {
+		proto, err := UndumpErr(data)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if got := Dump(proto, false); !bytes.Equal(got, data) {
+			t.Errorf("%s: Dump(Undump(chunk)) differs from chunk", path)
+		}
+	}
+}
+
+func TestDumpStrip(t *testing.T) {
+	for path, data := range luacChunks(t) {
+		proto := Undump(data)
+		stripped, err := UndumpErr(Dump(proto, true))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if stripped.Source != "" || len(stripped.LineInfo) != 0 || len(stripped.LocVars) != 0 || len(stripped.UpvalueNames) != 0 {
+			t.Errorf("%s: stripped chunk still has debug info", path)
+		}
+		if !reflect.DeepEqual(stripped.Code, proto.Code) || !reflect.DeepEqual(stripped.Constants, proto.Constants) {
+			t.Errorf("%s: stripped chunk has different code or constants", path)
+		}
+	}
+}
+
+//TestDumpFormat 其他格式的chunk读回来和原来的函数原型一样
+func TestDumpFormat(t *testing.T) {
+	formats := []Format{
+		{BigEndian: true, IntSize: 4, SizetSize: 8, InstructionSize: 4, IntegerSize: 8, NumberSize: 8},
+		{IntSize: 8, SizetSize: 8, InstructionSize: 8, IntegerSize: 8, NumberSize: 8},
+	}
+	for path, data := range luacChunks(t) {
+		proto := Undump(data)
+		for _, format := range formats {
+			out, err := DumpFormat(proto, false, format)
+			if err != nil {
+				t.Errorf("%s %+v: %v", path, format, err)
+				continue
+			}
+			if got, err := UndumpErr(out); err != nil || !reflect.DeepEqual(got, proto) {
+				t.Errorf("%s %+v: round trip failed: %v", path, format, err)
+			}
+		}
+	}
+	if _, err := DumpFormat(&Prototype{Constants: []interface{}{int64(1 << 40)}}, false, Format{IntSize: 4, SizetSize: 4, InstructionSize: 4, IntegerSize: 4, NumberSize: 8}); err == nil {
+		t.Error("DumpFormat accepted an integer constant that does not fit in 4 bytes")
+	}
+}
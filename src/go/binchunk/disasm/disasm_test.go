@@ -0,0 +1,106 @@
+package disasm
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/binchunk"
+	"io/ioutil"
+	"regexp"
+	"testing"
+)
+
+func loadChunk(t *testing.T) *binchunk.Prototype {
+	t.Helper()
+	data, err := ioutil.ReadFile("../../../lua/ch13/luac.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return binchunk.Undump(data)
+}
+
+//div0是ch13/test.lua里的第一个函数，want是luac -l -l的输出，地址换成了ADDR
+const div0Listing = `
+function <.\test.lua:1,7> (9 instructions at ADDR)
+2 params, 4 slots, 1 upvalue, 2 locals, 3 constants, 0 functions
+	1	[2]	EQ       	0 1 -1	; - 0
+	2	[2]	JMP      	0 4	; to 7
+	3	[3]	GETTABUP 	2 0 -2	; _ENV "error"
+	4	[3]	LOADK    	3 -3	; "DIV BY ZERO !"
+	5	[3]	CALL     	2 2 1
+	6	[3]	JMP      	0 2	; to 9
+	7	[5]	DIV      	2 0 1
+	8	[5]	RETURN   	2 2
+	9	[7]	RETURN   	0 1
+constants (3) for ADDR:
+	1	0
+	2	"error"
+	3	"DIV BY ZERO !"
+locals (2) for ADDR:
+	0	a	1	10
+	1	b	1	10
+upvalues (1) for ADDR:
+	0	_ENV	0	0
+`
+
+var addr = regexp.MustCompile(`0x[0-9a-f]+`)
+
+func TestFprint(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Fprint(&buf, loadChunk(t).Protos[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if got := addr.ReplaceAllString(buf.String(), "ADDR"); got != div0Listing {
+		t.Errorf("got:\n%s\nwant:\n%s", got, div0Listing)
+	}
+
+	buf.Reset()
+	Fprint(&buf, loadChunk(t), false)
+	if n := bytes.Count(buf.Bytes(), []byte("\nfunction <")); n != 3 {
+		t.Errorf("listed %d functions, want 3", n)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("constants (")) {
+		t.Error("debug information listed without full")
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	fn := Disassemble(loadChunk(t).Protos[0])
+	if fn.LineDefined != 1 || fn.NumParams != 2 || len(fn.Code) != 9 || len(fn.Locals) != 2 {
+		t.Fatalf("function = %+v", fn)
+	}
+	tests := []struct {
+		pc   int
+		want Instruction
+	}{
+		{1, Instruction{PC: 1, Line: 2, Op: "EQ", Operands: []Operand{
+			{Kind: KindInt, Value: 0},
+			{Kind: KindRegister, Value: 1},
+			{Kind: KindConstant, Value: 0, Constant: &Constant{Type: "integer", Value: int64(0)}},
+		}}},
+		{2, Instruction{PC: 2, Line: 2, Op: "JMP", Operands: []Operand{
+			{Kind: KindInt, Value: 0},
+			{Kind: KindJump, Value: 4, Target: 7},
+		}}},
+		{3, Instruction{PC: 3, Line: 3, Op: "GETTABUP", Operands: []Operand{
+			{Kind: KindRegister, Value: 2},
+			{Kind: KindUpvalue, Value: 0, Name: "_ENV"},
+			{Kind: KindConstant, Value: 1, Constant: &Constant{Type: "string", Value: "error"}},
+		}}},
+	}
+	for _, tt := range tests {
+		got, _ := json.Marshal(fn.Code[tt.pc-1])
+		want, _ := json.Marshal(tt.want)
+		if !bytes.Equal(got, want) {
+			t.Errorf("pc %d:\ngot  %s\nwant %s", tt.pc, got, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := FprintJSON(&buf, loadChunk(t)); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Function
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Protos) != 3 {
+		t.Errorf("FprintJSON output does not decode: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package disasm
+
+import (
+	"encoding/json"
+	"go/binchunk"
+	"go/luavm"
+	"io"
+	"math"
+)
+
+//操作数的种类
+const (
+	KindRegister = "register" //寄存器
+	KindConstant = "constant" //常量，OpArgK的操作数是常量时也是这种
+	KindUpvalue  = "upvalue"  //upvalue的下标
+	KindProto    = "proto"    //子函数的下标
+	KindJump     = "jump"     //跳转的偏移
+	KindInt      = "int"      //个数、标志之类的整数
+)
+
+//Function 解码以后的函数原型，所有的pc都和luac -l一样从1开始
+type Function struct {
+	Source          string        `json:"source"`
+	LineDefined     int           `json:"lineDefined"`
+	LastLineDefined int           `json:"lastLineDefined"`
+	NumParams       int           `json:"numParams"`
+	IsVararg        bool          `json:"isVararg"`
+	MaxStackSize    int           `json:"maxStackSize"`
+	Code            []Instruction `json:"code"`
+	Constants       []Constant    `json:"constants"`
+	Locals          []Local       `json:"locals"`
+	Upvalues        []Upvalue     `json:"upvalues"`
+	Protos          []*Function   `json:"protos"`
+}
+
+type Instruction struct {
+	PC       int       `json:"pc"`
+	Line     int       `json:"line,omitempty"` //去掉了调试信息时为0
+	Op       string    `json:"op"`
+	Operands []Operand `json:"operands"`
+}
+
+//Operand 一个操作数，Value是原始的值：寄存器、常量、upvalue、子函数的下标(从0开始)，整数，或者跳转的偏移
+type Operand struct {
+	Kind     string    `json:"kind"`
+	Value    int       `json:"value"`
+	Constant *Constant `json:"constant,omitempty"` //KindConstant时是常量的值
+	Name     string    `json:"name,omitempty"`     //KindUpvalue时是upvalue的名字，没有调试信息时为空
+	Target   int       `json:"target,omitempty"`   //KindJump时是跳转的目标
+}
+
+//Constant 常量，Type是nil、boolean、integer、number或者string；
+//JSON表示不了的inf和nan用luac -l的写法放在字符串里
+type Constant struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type Local struct {
+	Name    string `json:"name"`
+	StartPC int    `json:"startPC"`
+	EndPC   int    `json:"endPC"`
+}
+
+type Upvalue struct {
+	Name    string `json:"name,omitempty"`
+	InStack bool   `json:"inStack"` //是否是外层函数的局部变量，否则是外层函数的upvalue
+	Index   int    `json:"index"`
+}
+
+//FprintJSON 把Disassemble(f)的结果以缩进的JSON写到w
+func FprintJSON(w io.Writer, f *binchunk.Prototype) error {
+	data, err := json.MarshalIndent(Disassemble(f), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+//Disassemble 解码f和它的所有子函数
+func Disassemble(f *binchunk.Prototype) *Function {
+	fn := &Function{
+		Source:          f.Source,
+		LineDefined:     int(f.LineDefine),
+		LastLineDefined: int(f.LastLineDefined),
+		NumParams:       int(f.NumParams),
+		IsVararg:        f.IsVarargs != 0,
+		MaxStackSize:    int(f.MaxStatckSize),
+		Code:            make([]Instruction, len(f.Code)),
+		Constants:       make([]Constant, len(f.Constants)),
+		Locals:          make([]Local, len(f.LocVars)),
+		Upvalues:        make([]Upvalue, len(f.Upvalues)),
+		Protos:          make([]*Function, len(f.Protos)),
+	}
+	for pc := range f.Code {
+		fn.Code[pc] = decode(f, pc)
+	}
+	for i := range f.Constants {
+		fn.Constants[i] = constant(f, i)
+	}
+	for i, locVar := range f.LocVars {
+		fn.Locals[i] = Local{Name: locVar.VarName, StartPC: int(locVar.StartPC) + 1, EndPC: int(locVar.EndPC) + 1}
+	}
+	for i, upval := range f.Upvalues {
+		fn.Upvalues[i] = Upvalue{Name: upvalueNameOrEmpty(f, i), InStack: upval.Instatck != 0, Index: int(upval.Idx)}
+	}
+	for i, p := range f.Protos {
+		fn.Protos[i] = Disassemble(p)
+	}
+	return fn
+}
+
+func decode(f *binchunk.Prototype, pc int) Instruction {
+	i := luavm.Instruction(f.Code[pc])
+	inst := Instruction{PC: pc + 1, Op: opName(i), Operands: []Operand{}}
+	if pc < len(f.LineInfo) {
+		inst.Line = int(f.LineInfo[pc])
+	}
+	add := func(op Operand) {
+		inst.Operands = append(inst.Operands, op)
+	}
+
+	op := i.OpCode()
+	switch i.OpMode() {
+	case luavm.IABC:
+		a, b, c := i.ABC()
+		switch op {
+		case luavm.OP_SETTABUP:
+			add(upvalueOperand(f, a))
+		case luavm.OP_EQ, luavm.OP_LT, luavm.OP_LE:
+			add(Operand{Kind: KindInt, Value: a})
+		default:
+			add(Operand{Kind: KindRegister, Value: a})
+		}
+		switch i.BMode() {
+		case luavm.OpArgK:
+			add(rkOperand(f, b))
+		case luavm.OpArgR:
+			add(Operand{Kind: KindRegister, Value: b})
+		case luavm.OpArgU:
+			if op == luavm.OP_GETUPVAL || op == luavm.OP_SETUPVAL || op == luavm.OP_GETTABUP {
+				add(upvalueOperand(f, b))
+			} else {
+				add(Operand{Kind: KindInt, Value: b})
+			}
+		}
+		switch i.CMode() {
+		case luavm.OpArgK:
+			add(rkOperand(f, c))
+		case luavm.OpArgR:
+			add(Operand{Kind: KindRegister, Value: c})
+		case luavm.OpArgU:
+			add(Operand{Kind: KindInt, Value: c})
+		}
+	case luavm.IABx:
+		a, bx := i.ABx()
+		add(Operand{Kind: KindRegister, Value: a})
+		switch i.BMode() {
+		case luavm.OpArgK:
+			add(constantOperand(f, bx))
+		case luavm.OpArgU:
+			add(Operand{Kind: KindProto, Value: bx})
+		}
+	case luavm.IAsBx:
+		a, sbx := i.AsBx()
+		if op == luavm.OP_JMP {
+			add(Operand{Kind: KindInt, Value: a}) //JMP的A不为0时关闭>=R(A-1)的upvalue
+		} else {
+			add(Operand{Kind: KindRegister, Value: a})
+		}
+		add(Operand{Kind: KindJump, Value: sbx, Target: pc + sbx + 2})
+	case luavm.IAx:
+		ax := i.Ax()
+		if pc > 0 && luavm.Instruction(f.Code[pc-1]).OpCode() == luavm.OP_LOADKX {
+			add(constantOperand(f, ax))
+		} else {
+			add(Operand{Kind: KindInt, Value: ax})
+		}
+	}
+	return inst
+}
+
+func rkOperand(f *binchunk.Prototype, x int) Operand {
+	if isK(x) {
+		return constantOperand(f, x&0xFF)
+	}
+	return Operand{Kind: KindRegister, Value: x}
+}
+
+func constantOperand(f *binchunk.Prototype, idx int) Operand {
+	op := Operand{Kind: KindConstant, Value: idx}
+	if idx < len(f.Constants) {
+		k := constant(f, idx)
+		op.Constant = &k
+	}
+	return op
+}
+
+func upvalueOperand(f *binchunk.Prototype, idx int) Operand {
+	return Operand{Kind: KindUpvalue, Value: idx, Name: upvalueNameOrEmpty(f, idx)}
+}
+
+func upvalueNameOrEmpty(f *binchunk.Prototype, idx int) string {
+	if idx < len(f.UpvalueNames) {
+		return f.UpvalueNames[idx]
+	}
+	return ""
+}
+
+func constant(f *binchunk.Prototype, idx int) Constant {
+	switch k := f.Constants[idx].(type) {
+	case nil:
+		return Constant{Type: "nil"}
+	case bool:
+		return Constant{Type: "boolean", Value: k}
+	case int64:
+		return Constant{Type: "integer", Value: k}
+	case float64:
+		if math.IsInf(k, 0) || math.IsNaN(k) {
+			return Constant{Type: "number", Value: constantToString(f, idx)}
+		}
+		return Constant{Type: "number", Value: k}
+	case string:
+		return Constant{Type: "string", Value: k}
+	default:
+		return Constant{Type: "?"}
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Package disasm 反汇编函数原型：Fprint输出和luac -l、luac -l -l一样的文本，
+Disassemble把函数原型解码成可以序列化成JSON的结构，操作数里的常量、upvalue的名字和跳转目标都已经解析好了。
+*/
+package disasm
+
+import (
+	"fmt"
+	"go/binchunk"
+	"go/luavm"
+	"io"
+	"strings"
+)
+
+//Fprint 和luac -l一样把f和它的所有子函数列出来写到w，full为true时相当于luac -l -l
+func Fprint(w io.Writer, f *binchunk.Prototype, full bool) error {
+	ew := &errWriter{w: w}
+	printFunction(ew, f, full)
+	return ew.err
+}
+
+//errWriter 记住第一个写错误，之后的写入都忽略
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return len(p), nil
+	}
+	_, ew.err = ew.w.Write(p)
+	return len(p), nil
+}
+
+func printFunction(w io.Writer, f *binchunk.Prototype, full bool) {
+	printHeader(w, f)
+	printCode(w, f)
+	if full {
+		printDebug(w, f)
+	}
+	for _, p := range f.Protos {
+		printFunction(w, p, full)
+	}
+}
+
+func printHeader(w io.Writer, f *binchunk.Prototype) {
+	s := f.Source
+	switch {
+	case s == "":
+		s = "?"
+	case s[0] == '@' || s[0] == '=':
+		s = s[1:]
+	case strings.HasPrefix(s, binchunk.LUA_SIGNATURE[:1]):
+		s = "(bstring)"
+	default:
+		s = "(string)"
+	}
+	funcType := "main"
+	if f.LineDefine > 0 {
+		funcType = "function"
+	}
+	varargs := ""
+	if f.IsVarargs > 0 {
+		varargs = "+"
+	}
+	fmt.Fprintf(w, "\n%s <%s:%d,%d> (%s at %p)\n", funcType, s,
+		f.LineDefine, f.LastLineDefined, plural(len(f.Code), "instruction"), f)
+	fmt.Fprintf(w, "%d%s param%s, %s, %s, ", f.NumParams, varargs, pluralSuffix(int(f.NumParams)),
+		plural(int(f.MaxStatckSize), "slot"), plural(len(f.Upvalues), "upvalue"))
+	fmt.Fprintf(w, "%s, %s, %s\n", plural(len(f.LocVars), "local"),
+		plural(len(f.Constants), "constant"), plural(len(f.Protos), "function"))
+}
+
+func plural(n int, what string) string {
+	return fmt.Sprintf("%d %s%s", n, what, pluralSuffix(n))
+}
+
+func pluralSuffix(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func printCode(w io.Writer, f *binchunk.Prototype) {
+	for pc := 0; pc < len(f.Code); pc++ {
+		i := luavm.Instruction(f.Code[pc])
+		line := "-"
+		if pc < len(f.LineInfo) && f.LineInfo[pc] > 0 {
+			line = fmt.Sprint(f.LineInfo[pc])
+		}
+		fmt.Fprintf(w, "\t%d\t[%s]\t%-9s\t", pc+1, line, opName(i))
+		printOperands(w, i)
+		pc = printComment(w, f, pc, i)
+		fmt.Fprintln(w)
+	}
+}
+
+//isK RK(x)里x是常量的下标时返回true
+func isK(x int) bool {
+	return x > 0xFF
+}
+
+//opName luavm里的名字为了对齐补了空格
+func opName(i luavm.Instruction) string {
+	return strings.TrimSpace(i.OpName())
+}
+
+func printOperands(w io.Writer, i luavm.Instruction) {
+	switch i.OpMode() {
+	case luavm.IABC:
+		a, b, c := i.ABC()
+		fmt.Fprintf(w, "%d", a)
+		if i.BMode() != luavm.OpArgN {
+			fmt.Fprintf(w, " %d", rk(b))
+		}
+		if i.CMode() != luavm.OpArgN {
+			fmt.Fprintf(w, " %d", rk(c))
+		}
+	case luavm.IABx:
+		a, bx := i.ABx()
+		fmt.Fprintf(w, "%d", a)
+		if i.BMode() == luavm.OpArgK {
+			fmt.Fprintf(w, " %d", -1-bx)
+		} else if i.BMode() == luavm.OpArgU {
+			fmt.Fprintf(w, " %d", bx)
+		}
+	case luavm.IAsBx:
+		a, sbx := i.AsBx()
+		fmt.Fprintf(w, "%d %d", a, sbx)
+	case luavm.IAx:
+		fmt.Fprintf(w, "%d", -1-i.Ax())
+	}
+}
+
+//rk 常量显示成负数：-1是第一个常量
+func rk(x int) int {
+	if isK(x) {
+		return -1 - x&0xFF
+	}
+	return x
+}
+
+//printComment 指令后面的注释，返回值是最后一个处理过的pc，SETLIST的C为0时会跳过后面的EXTRAARG
+func printComment(w io.Writer, f *binchunk.Prototype, pc int, i luavm.Instruction) int {
+	a, b, c := i.ABC()
+	switch i.OpCode() {
+	case luavm.OP_LOADK:
+		_, bx := i.ABx()
+		fmt.Fprintf(w, "\t; %s", constantToString(f, bx))
+	case luavm.OP_GETUPVAL, luavm.OP_SETUPVAL:
+		fmt.Fprintf(w, "\t; %s", upvalueName(f, b))
+	case luavm.OP_GETTABUP:
+		fmt.Fprintf(w, "\t; %s", upvalueName(f, b))
+		if isK(c) {
+			fmt.Fprintf(w, " %s", constantToString(f, c&0xFF))
+		}
+	case luavm.OP_SETTABUP:
+		fmt.Fprintf(w, "\t; %s", upvalueName(f, a))
+		if isK(b) {
+			fmt.Fprintf(w, " %s", constantToString(f, b&0xFF))
+		}
+		if isK(c) {
+			fmt.Fprintf(w, " %s", constantToString(f, c&0xFF))
+		}
+	case luavm.OP_GETTABLE, luavm.OP_SELF:
+		if isK(c) {
+			fmt.Fprintf(w, "\t; %s", constantToString(f, c&0xFF))
+		}
+	case luavm.OP_SETTABLE, luavm.OP_ADD, luavm.OP_SUB, luavm.OP_MUL, luavm.OP_MOD,
+		luavm.OP_POW, luavm.OP_DIV, luavm.OP_IDIV, luavm.OP_BAND, luavm.OP_BOR,
+		luavm.OP_BXOR, luavm.OP_SHL, luavm.OP_SHR, luavm.OP_EQ, luavm.OP_LT, luavm.OP_LE:
+		if isK(b) || isK(c) {
+			fmt.Fprintf(w, "\t; %s %s", rkToString(f, b), rkToString(f, c))
+		}
+	case luavm.OP_JMP, luavm.OP_FORLOOP, luavm.OP_FORPREP, luavm.OP_TFORLOOP:
+		_, sbx := i.AsBx()
+		fmt.Fprintf(w, "\t; to %d", sbx+pc+2)
+	case luavm.OP_CLOSURE:
+		_, bx := i.ABx()
+		if bx < len(f.Protos) {
+			fmt.Fprintf(w, "\t; %p", f.Protos[bx])
+		}
+	case luavm.OP_SETLIST:
+		if c == 0 && pc+1 < len(f.Code) {
+			pc++
+			fmt.Fprintf(w, "\t; %d", f.Code[pc])
+		} else {
+			fmt.Fprintf(w, "\t; %d", c)
+		}
+	case luavm.OP_EXTRAARG:
+		fmt.Fprintf(w, "\t; %s", constantToString(f, i.Ax()))
+	}
+	return pc
+}
+
+func rkToString(f *binchunk.Prototype, x int) string {
+	if isK(x) {
+		return constantToString(f, x&0xFF)
+	}
+	return "-"
+}
+
+func upvalueName(f *binchunk.Prototype, idx int) string {
+	if idx < len(f.UpvalueNames) && f.UpvalueNames[idx] != "" {
+		return f.UpvalueNames[idx]
+	}
+	return "-"
+}
+
+//constantToString 和luac一样：浮点数用%.14g并且总是带小数点，字符串转义成C的写法
+func constantToString(f *binchunk.Prototype, idx int) string {
+	if idx >= len(f.Constants) {
+		return "?"
+	}
+	switch k := f.Constants[idx].(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return fmt.Sprintf("%t", k)
+	case float64:
+		s := fmt.Sprintf("%.14g", k)
+		if strings.Trim(s, "-0123456789") == "" {
+			s += ".0"
+		}
+		return s
+	case int64:
+		return fmt.Sprintf("%d", k)
+	case string:
+		return quoteString(k)
+	default:
+		return "?"
+	}
+}
+
+func quoteString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			if c >= 0x20 && c < 0x7F {
+				buf.WriteByte(c)
+			} else {
+				fmt.Fprintf(&buf, `\%03d`, c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func printDebug(w io.Writer, f *binchunk.Prototype) {
+	fmt.Fprintf(w, "constants (%d) for %p:\n", len(f.Constants), f)
+	for i := range f.Constants {
+		fmt.Fprintf(w, "\t%d\t%s\n", i+1, constantToString(f, i))
+	}
+	fmt.Fprintf(w, "locals (%d) for %p:\n", len(f.LocVars), f)
+	for i, locVar := range f.LocVars {
+		fmt.Fprintf(w, "\t%d\t%s\t%d\t%d\n", i, locVar.VarName, locVar.StartPC+1, locVar.EndPC+1)
+	}
+	fmt.Fprintf(w, "upvalues (%d) for %p:\n", len(f.Upvalues), f)
+	for i, upval := range f.Upvalues {
+		fmt.Fprintf(w, "\t%d\t%s\t%d\t%d\n", i, upvalueName(f, i), upval.Instatck, upval.Idx)
+	}
+}
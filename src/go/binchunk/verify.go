@@ -0,0 +1,376 @@
+package binchunk
+
+import (
+	"fmt"
+	"go/luavm"
+)
+
+//VerifyError Verify发现的问题，PC从1开始，为0时表示问题不在某一条指令上
+type VerifyError struct {
+	Source      string
+	LineDefined uint32
+	PC          int
+	Op          string
+	Msg         string
+}
+
+func (err *VerifyError) Error() string {
+	fn := "main function"
+	if err.LineDefined > 0 {
+		fn = fmt.Sprintf("function at line %d", err.LineDefined)
+	}
+	if err.Source != "" {
+		fn = fmt.Sprintf("%s (%s)", fn, err.Source)
+	}
+	if err.PC > 0 {
+		return fmt.Sprintf("bad binary chunk: %s, pc %d (%s): %s", fn, err.PC, err.Op, err.Msg)
+	}
+	return fmt.Sprintf("bad binary chunk: %s: %s", fn, err.Msg)
+}
+
+/*
+Verify 检查函数原型和所有子函数能不能被虚拟机安全地执行，用于加载不可信的二进制chunk：
+
+	寄存器不超过MaxStatckSize，常量、upvalue和子函数的下标都存在
+	跳转的目标在Code里面，并且不会跳到EXTRAARG上
+	LOADKX和C为0的SETLIST后面紧跟着EXTRAARG，EXTRAARG不单独出现
+	比较和测试指令后面是JMP，TFORCALL后面是TFORLOOP
+	B为0(参数或者返回值的个数由上一条指令决定)的CALL、TAILCALL、RETURN和SETLIST
+	紧跟在C为0的CALL、TAILCALL或者B为0的VARARG后面，反过来也一样
+	每个函数都以RETURN结束，子函数的upvalue指向外层函数存在的寄存器或者upvalue
+
+Verify只保证虚拟机不会因为下标越界之类的原因崩溃，不检查寄存器里的值的类型。
+*/
+func Verify(proto *Prototype) error {
+	return verify(proto, nil)
+}
+
+type verifier struct {
+	proto *Prototype
+	pc    int
+}
+
+func verify(proto *Prototype, parent *Prototype) (err error) {
+	v := &verifier{proto: proto, pc: -1}
+	defer func() {
+		if r := recover(); r != nil {
+			if verr, ok := r.(*VerifyError); ok {
+				err = verr
+			} else {
+				panic(r)
+			}
+		}
+	}()
+	v.checkFunction(parent)
+	for v.pc = 0; v.pc < len(proto.Code); v.pc++ {
+		v.checkInstruction()
+	}
+	v.pc = -1
+	for _, p := range proto.Protos {
+		if err := verify(p, proto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *verifier) error(f string, a ...interface{}) {
+	err := &VerifyError{
+		Source:      v.proto.Source,
+		LineDefined: v.proto.LineDefine,
+		Msg:         fmt.Sprintf(f, a...),
+	}
+	if v.pc >= 0 {
+		err.PC = v.pc + 1
+		err.Op = opName(v.proto.Code[v.pc])
+	}
+	panic(err)
+}
+
+func opName(i uint32) string {
+	if op := luavm.Instruction(i).OpCode(); op > luavm.OP_EXTRAARG {
+		return fmt.Sprintf("opcode %d", op)
+	}
+	name := luavm.Instruction(i).OpName()
+	for len(name) > 0 && name[len(name)-1] == ' ' {
+		name = name[:len(name)-1]
+	}
+	return name
+}
+
+func (v *verifier) checkFunction(parent *Prototype) {
+	f := v.proto
+	if int(f.NumParams) > int(f.MaxStatckSize) {
+		v.error("%d parameters but only %d registers", f.NumParams, f.MaxStatckSize)
+	}
+	if len(f.Code) == 0 {
+		v.error("no code")
+	}
+	if luavm.Instruction(f.Code[len(f.Code)-1]).OpCode() != luavm.OP_RETURN {
+		v.error("function does not end with RETURN")
+	}
+	for i, k := range f.Constants {
+		switch k.(type) {
+		case nil, bool, int64, float64, string:
+		default:
+			v.error("constant %d has bad type %T", i+1, k)
+		}
+	}
+	if parent == nil {
+		//主函数的upvalue由Load设置，只有第一个(_ENV)有值
+		if len(f.Upvalues) > 1 {
+			v.error("main function has %d upvalues", len(f.Upvalues))
+		}
+	} else {
+		for i, uv := range f.Upvalues {
+			if uv.Instatck != 0 && int(uv.Idx) >= int(parent.MaxStatckSize) {
+				v.error("upvalue %d refers to register %d of the enclosing function, which has %d", i, uv.Idx, parent.MaxStatckSize)
+			}
+			if uv.Instatck == 0 && int(uv.Idx) >= len(parent.Upvalues) {
+				v.error("upvalue %d refers to upvalue %d of the enclosing function, which has %d", i, uv.Idx, len(parent.Upvalues))
+			}
+		}
+	}
+	if n := len(f.LineInfo); n != 0 && n != len(f.Code) {
+		v.error("%d line numbers for %d instructions", n, len(f.Code))
+	}
+	if len(f.UpvalueNames) > len(f.Upvalues) {
+		v.error("%d upvalue names for %d upvalues", len(f.UpvalueNames), len(f.Upvalues))
+	}
+	for _, locVar := range f.LocVars {
+		if locVar.StartPC > locVar.EndPC || int(locVar.EndPC) > len(f.Code) {
+			v.error("local '%s' has bad range %d-%d", locVar.VarName, locVar.StartPC+1, locVar.EndPC+1)
+		}
+	}
+}
+
+func (v *verifier) inst(pc int) luavm.Instruction {
+	return luavm.Instruction(v.proto.Code[pc])
+}
+
+//reg 寄存器r到r+n-1都要存在
+func (v *verifier) reg(r, n int) {
+	if r+n > int(v.proto.MaxStatckSize) {
+		v.error("register %d out of range (stack size %d)", r+n-1, v.proto.MaxStatckSize)
+	}
+}
+
+func (v *verifier) rk(x int) {
+	if x > 0xFF {
+		v.constant(x & 0xFF)
+	} else {
+		v.reg(x, 1)
+	}
+}
+
+func (v *verifier) constant(idx int) {
+	if idx >= len(v.proto.Constants) {
+		v.error("constant %d out of range (%d constants)", idx+1, len(v.proto.Constants))
+	}
+}
+
+func (v *verifier) upvalue(idx int) {
+	if idx >= len(v.proto.Upvalues) {
+		v.error("upvalue %d out of range (%d upvalues)", idx, len(v.proto.Upvalues))
+	}
+}
+
+//jump 跳转到pc+1+sBx
+func (v *verifier) jump(sBx int) {
+	target := v.pc + 1 + sBx
+	if target < 0 || target >= len(v.proto.Code) {
+		v.error("jump to %d out of range", target+1)
+	}
+	if target > 0 && v.isExtraArgOwner(target-1) {
+		v.error("jump into the middle of an instruction at %d", target)
+	}
+}
+
+//next 下一条指令必须是op
+func (v *verifier) next(op int) {
+	if v.pc+1 >= len(v.proto.Code) || v.inst(v.pc+1).OpCode() != op {
+		v.error("must be followed by %s", opName(uint32(op)))
+	}
+}
+
+//isExtraArgOwner pc处的指令后面跟着自己的EXTRAARG
+func (v *verifier) isExtraArgOwner(pc int) bool {
+	i := v.inst(pc)
+	switch i.OpCode() {
+	case luavm.OP_LOADKX:
+		return true
+	case luavm.OP_SETLIST:
+		_, _, c := i.ABC()
+		return c == 0
+	}
+	return false
+}
+
+//isOpen pc处的指令把不定个数的值留在栈顶，交给下一条指令
+func (v *verifier) isOpen(pc int) bool {
+	i := v.inst(pc)
+	_, b, c := i.ABC()
+	switch i.OpCode() {
+	case luavm.OP_CALL:
+		return c == 0
+	case luavm.OP_TAILCALL:
+		return true
+	case luavm.OP_VARARG:
+		return b == 0
+	}
+	return false
+}
+
+//usesOpen pc处的指令使用上一条指令留在栈顶的值
+func (v *verifier) usesOpen(pc int) bool {
+	i := v.inst(pc)
+	_, b, _ := i.ABC()
+	switch i.OpCode() {
+	case luavm.OP_CALL, luavm.OP_TAILCALL, luavm.OP_RETURN, luavm.OP_SETLIST:
+		return b == 0
+	}
+	return false
+}
+
+func (v *verifier) checkInstruction() {
+	i := v.inst(v.pc)
+	op := i.OpCode()
+	if op > luavm.OP_EXTRAARG {
+		v.error("bad opcode")
+	}
+	if v.usesOpen(v.pc) && (v.pc == 0 || !v.isOpen(v.pc-1)) {
+		v.error("B is 0 but the previous instruction leaves no open results")
+	}
+	if v.isOpen(v.pc) && op != luavm.OP_TAILCALL && (v.pc+1 >= len(v.proto.Code) || !v.usesOpen(v.pc+1)) {
+		v.error("open results are not used by the next instruction")
+	}
+
+	a, b, c := i.ABC()
+	_, bx := i.ABx()
+	_, sBx := i.AsBx()
+	switch op {
+	case luavm.OP_MOVE:
+		v.reg(a, 1)
+		v.reg(b, 1)
+	case luavm.OP_LOADK:
+		v.reg(a, 1)
+		v.constant(bx)
+	case luavm.OP_LOADKX:
+		v.reg(a, 1)
+		v.next(luavm.OP_EXTRAARG)
+		v.constant(v.inst(v.pc + 1).Ax())
+	case luavm.OP_LOADBOOL:
+		v.reg(a, 1)
+		if c != 0 {
+			v.jump(1)
+		}
+	case luavm.OP_LOADNIL:
+		v.reg(a, b+1)
+	case luavm.OP_GETUPVAL:
+		v.reg(a, 1)
+		v.upvalue(b)
+	case luavm.OP_GETTABUP:
+		v.reg(a, 1)
+		v.upvalue(b)
+		v.rk(c)
+	case luavm.OP_GETTABLE:
+		v.reg(a, 1)
+		v.reg(b, 1)
+		v.rk(c)
+	case luavm.OP_SETTABUP:
+		v.upvalue(a)
+		v.rk(b)
+		v.rk(c)
+	case luavm.OP_SETUPVAL:
+		v.reg(a, 1)
+		v.upvalue(b)
+	case luavm.OP_SETTABLE:
+		v.reg(a, 1)
+		v.rk(b)
+		v.rk(c)
+	case luavm.OP_NEWTABLE:
+		v.reg(a, 1)
+	case luavm.OP_SELF:
+		v.reg(a, 2)
+		v.reg(b, 1)
+		v.rk(c)
+	case luavm.OP_ADD, luavm.OP_SUB, luavm.OP_MUL, luavm.OP_MOD, luavm.OP_POW,
+		luavm.OP_DIV, luavm.OP_IDIV, luavm.OP_BAND, luavm.OP_BOR, luavm.OP_BXOR,
+		luavm.OP_SHL, luavm.OP_SHR:
+		v.reg(a, 1)
+		v.rk(b)
+		v.rk(c)
+	case luavm.OP_UNM, luavm.OP_BNOT, luavm.OP_NOT, luavm.OP_LEN:
+		v.reg(a, 1)
+		v.reg(b, 1)
+	case luavm.OP_CONCAT:
+		v.reg(a, 1)
+		if b > c {
+			v.error("empty range of registers %d-%d", b, c)
+		}
+		v.reg(b, c-b+1)
+	case luavm.OP_JMP:
+		if a > 0 {
+			v.reg(a-1, 1)
+		}
+		v.jump(sBx)
+	case luavm.OP_EQ, luavm.OP_LT, luavm.OP_LE:
+		v.rk(b)
+		v.rk(c)
+		v.next(luavm.OP_JMP)
+	case luavm.OP_TEST:
+		v.reg(a, 1)
+		v.next(luavm.OP_JMP)
+	case luavm.OP_TESTSET:
+		v.reg(a, 1)
+		v.reg(b, 1)
+		v.next(luavm.OP_JMP)
+	case luavm.OP_CALL:
+		v.reg(a, 1)
+		if b > 0 {
+			v.reg(a, b)
+		}
+		if c > 1 {
+			v.reg(a, c-1)
+		}
+	case luavm.OP_TAILCALL:
+		v.reg(a, 1)
+		if b > 0 {
+			v.reg(a, b)
+		}
+	case luavm.OP_RETURN:
+		if b > 1 {
+			v.reg(a, b-1)
+		} else if b == 0 {
+			v.reg(a, 1)
+		}
+	case luavm.OP_FORLOOP, luavm.OP_FORPREP:
+		v.reg(a, 4)
+		v.jump(sBx)
+	case luavm.OP_TFORCALL:
+		v.reg(a, 3+c)
+		v.next(luavm.OP_TFORLOOP)
+	case luavm.OP_TFORLOOP:
+		v.reg(a, 2)
+		v.jump(sBx)
+	case luavm.OP_SETLIST:
+		v.reg(a, b+1)
+		if c == 0 {
+			v.next(luavm.OP_EXTRAARG)
+		}
+	case luavm.OP_CLOSURE:
+		v.reg(a, 1)
+		if bx >= len(v.proto.Protos) {
+			v.error("function %d out of range (%d functions)", bx, len(v.proto.Protos))
+		}
+	case luavm.OP_VARARG:
+		v.reg(a, 1)
+		if b > 1 {
+			v.reg(a, b-1)
+		}
+	case luavm.OP_EXTRAARG:
+		if v.pc == 0 || !v.isExtraArgOwner(v.pc-1) {
+			v.error("EXTRAARG without LOADKX or SETLIST")
+		}
+	}
+}
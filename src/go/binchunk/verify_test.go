@@ -0,0 +1,69 @@
+package binchunk
+
+import (
+	"go/luavm"
+	"strings"
+	"testing"
+)
+
+func iABC(op, a, b, c int) uint32 { return uint32(op | a<<6 | c<<14 | b<<23) }
+func iABx(op, a, bx int) uint32   { return uint32(op | a<<6 | bx<<14) }
+func iAsBx(op, a, sBx int) uint32 { return iABx(op, a, sBx+luavm.MAXARG_sBx) }
+func iAx(op, ax int) uint32       { return uint32(op | ax<<6) }
+
+var ret = iABC(luavm.OP_RETURN, 0, 1, 0)
+
+func TestVerifyLuacChunks(t *testing.T) {
+	for path, data := range luacChunks(t) {
+		if err := Verify(Undump(data)); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	main := func(code ...uint32) *Prototype {
+		return &Prototype{MaxStatckSize: 2, Code: code, Constants: []interface{}{"k"}, Upvalues: []Upvalue{{Instatck: 1}}}
+	}
+	tests := []struct {
+		proto *Prototype
+		want  string
+	}{
+		{main(), "no code"},
+		{main(iABC(luavm.OP_MOVE, 0, 1, 0)), "does not end with RETURN"},
+		{main(iABC(luavm.OP_MOVE, 2, 0, 0), ret), "pc 1 (MOVE): register 2 out of range"},
+		{main(iABx(luavm.OP_LOADK, 0, 1), ret), "constant 2 out of range"},
+		{main(iABC(luavm.OP_GETUPVAL, 0, 1, 0), ret), "upvalue 1 out of range"},
+		{main(iABC(luavm.OP_GETTABUP, 0, 0, 0x101), ret), "constant 2 out of range"},
+		{main(iAsBx(luavm.OP_JMP, 0, 5), ret), "jump to 7 out of range"},
+		{main(iAsBx(luavm.OP_JMP, 0, -2), ret), "jump to 0 out of range"},
+		{main(iABx(luavm.OP_LOADKX, 0, 0), ret), "must be followed by EXTRAARG"},
+		{main(iABx(luavm.OP_LOADKX, 0, 0), iAx(luavm.OP_EXTRAARG, 0), iAsBx(luavm.OP_JMP, 0, -2), ret), "jump into the middle"},
+		{main(iAx(luavm.OP_EXTRAARG, 0), ret), "EXTRAARG without LOADKX or SETLIST"},
+		{main(iABC(luavm.OP_EQ, 0, 0, 1), ret), "must be followed by JMP"},
+		{main(iABC(luavm.OP_RETURN, 0, 0, 0)), "no open results"},
+		{main(iABC(luavm.OP_CALL, 0, 1, 0), ret), "open results are not used"},
+		{main(iABC(luavm.OP_CONCAT, 0, 1, 0), ret), "empty range"},
+		{main(iABx(luavm.OP_CLOSURE, 0, 0), ret), "function 0 out of range (0 functions)"},
+		{main(uint32(luavm.OP_EXTRAARG+1), ret), "bad opcode"},
+		{&Prototype{MaxStatckSize: 1, NumParams: 2, Code: []uint32{ret}}, "2 parameters but only 1 registers"},
+		{&Prototype{MaxStatckSize: 1, Code: []uint32{ret}, Upvalues: make([]Upvalue, 2)}, "main function has 2 upvalues"},
+		{&Prototype{MaxStatckSize: 1, Code: []uint32{ret}, Constants: []interface{}{[]byte("k")}}, "bad type"},
+		{&Prototype{MaxStatckSize: 1, Code: []uint32{ret}, LineInfo: []uint32{1, 2}}, "2 line numbers for 1 instructions"},
+		{&Prototype{
+			MaxStatckSize: 1,
+			Code:          []uint32{iABx(luavm.OP_CLOSURE, 0, 0), ret},
+			Protos:        []*Prototype{{MaxStatckSize: 1, LineDefine: 3, Code: []uint32{ret}, Upvalues: []Upvalue{{Instatck: 1, Idx: 1}}}},
+		}, "function at line 3: upvalue 0 refers to register 1 of the enclosing function"},
+	}
+	for _, tt := range tests {
+		err := Verify(tt.proto)
+		if err == nil {
+			t.Errorf("%q: Verify accepted the chunk", tt.want)
+			continue
+		}
+		if _, ok := err.(*VerifyError); !ok || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v, want %q", err, tt.want)
+		}
+	}
+}
@@ -3,63 +3,102 @@ package ast
 type Stat interface{}
 
 type Block struct {
+	Span
 	LastLine int
 	Stats    []Stat
 	RetExps  []Exp
 }
 
-type EmptyStat struct{}
-type BreakStat struct{ Line int }
-type LabelStat struct{ Name string }
-type GotoStat struct{ Name string }
-type DoStat struct{ Block *Block }
+type EmptyStat struct {
+	Span
+}
+
+//BadStat 容错解析时代替有语法错误的语句，Span覆盖被跳过的源码
+type BadStat struct {
+	Span
+}
+
+type BreakStat struct {
+	Span
+	Line int
+}
+
+type LabelStat struct {
+	Span
+	Line int
+	Name string
+}
+
+type GotoStat struct {
+	Span
+	Line int
+	Name string
+}
+
+type DoStat struct {
+	Span
+	Block *Block
+}
+
 type FuncCallStat = FuncCallExp
 
 type WhileStat struct {
+	Span
 	Exp   Exp
 	Block *Block
 }
 
 type RepeatStat struct {
+	Span
 	Block *Block
 	Exp   Exp
 }
 
 type IfStat struct {
+	Span
 	Exps   []Exp
 	Blocks []*Block
 }
 
 type ForNumStat struct {
+	Span
 	LineOfFor int
 	LineOfDo  int
 	VarName   string
+	VarSpan   Span //VarName在源码中的区间
 	InitExp   Exp
 	LimitExp  Exp
-	StepExp    Exp
+	StepExp   Exp
 	Block     *Block
 }
 
 type ForInStat struct {
-	LineOfDo int
-	NameList []string
-	ExpList  []Exp
-	Block    *Block
+	Span
+	LineOfDo  int
+	NameList  []string
+	NameSpans []Span //NameList里每个名字在源码中的区间
+	ExpList   []Exp
+	Block     *Block
 }
 
 type LocalVarDeclStat struct {
-	LastLine int
-	NameList []string
-	ExpList  []Exp
+	Span
+	LastLine  int
+	NameList  []string
+	NameSpans []Span
+	ExpList   []Exp
 }
 
 type AssignStat struct {
+	Span
 	LastLine int
 	VarList  []Exp
 	ExpList  []Exp
 }
 
 type LocalFuncDefStat struct {
-	Name string
-	Exp  *FuncDefExp
+	Span
+	Name     string
+	NameSpan Span
+	Exp      *FuncDefExp
 }
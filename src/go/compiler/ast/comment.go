@@ -0,0 +1,218 @@
+package ast
+
+import (
+	"go/compiler/lexer"
+	"math"
+	"sort"
+)
+
+//Comment 源码中的一条注释
+type Comment = lexer.Comment
+
+//NodeComments 挂在一个节点上的注释
+type NodeComments struct {
+	Leading  []*Comment //节点前面的注释；对Block来说是return前面的注释
+	Trailing []*Comment //节点后面和节点结尾在同一行的注释，以及节点内部没有更合适去处的注释；对Block来说是return后面的注释
+	End      []*Comment //只用于Block：最后一条语句后面、end/else/until之类的关键字前面的注释
+}
+
+/*
+CommentMap 把注释挂到语法树节点上，键是注释所属的节点：
+	Block.Stats里的语句，注释挂在最近的语句上；
+	Block本身，用来记录return前后以及block末尾的注释；
+	TableConstructorExp.ValExps里的值，表示表构造器里某个字段前后的注释；
+	TableConstructorExp本身，它的End是最后一个字段后面、}前面的注释。
+注释是否和节点在同一行决定它是Leading还是上一个节点的Trailing。
+*/
+type CommentMap map[Node]*NodeComments
+
+//NewCommentMap 按照节点的Span把comments(按出现顺序排列)分配给block里的节点
+func NewCommentMap(block *Block, comments []*Comment) CommentMap {
+	a := &commentAssigner{cm: CommentMap{}, comments: comments}
+	a.block(block, math.MaxInt32)
+	return a.cm
+}
+
+//Comments 按出现顺序返回cm里的所有注释
+func (cm CommentMap) Comments() []*Comment {
+	var comments []*Comment
+	for _, nc := range cm {
+		comments = append(comments, nc.Leading...)
+		comments = append(comments, nc.Trailing...)
+		comments = append(comments, nc.End...)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].Pos.Offset < comments[j].Pos.Offset
+	})
+	return comments
+}
+
+func (cm CommentMap) get(node Node) *NodeComments {
+	nc := cm[node]
+	if nc == nil {
+		nc = &NodeComments{}
+		cm[node] = nc
+	}
+	return nc
+}
+
+type commentAssigner struct {
+	cm       CommentMap
+	comments []*Comment //还没有分配的注释
+}
+
+//next 返回下一条在offset之前开始的注释
+func (a *commentAssigner) next(offset int) *Comment {
+	if len(a.comments) > 0 && a.comments[0].Pos.Offset < offset {
+		comment := a.comments[0]
+		a.comments = a.comments[1:]
+		return comment
+	}
+	return nil
+}
+
+//before 把offset之前的注释分给prev(同一行)或者leading
+func (a *commentAssigner) before(offset int, prev Node, leading *[]*Comment) {
+	for comment := a.next(offset); comment != nil; comment = a.next(offset) {
+		if prev != nil && comment.Pos.Line == prev.NodeSpan().End.Line {
+			a.cm.get(prev).Trailing = append(a.cm.get(prev).Trailing, comment)
+		} else {
+			*leading = append(*leading, comment)
+		}
+	}
+}
+
+//inside 节点内部没分配出去的注释都算作它的Trailing
+func (a *commentAssigner) inside(node Node) {
+	for comment := a.next(node.NodeSpan().End.Offset); comment != nil; comment = a.next(node.NodeSpan().End.Offset) {
+		a.cm.get(node).Trailing = append(a.cm.get(node).Trailing, comment)
+	}
+}
+
+//block limit是结束block的关键字的位置
+func (a *commentAssigner) block(block *Block, limit int) {
+	var prev Node
+	for _, stat := range block.Stats {
+		node := stat.(Node)
+		if _, ok := stat.(*EmptyStat); ok {
+			continue
+		}
+		var leading []*Comment
+		a.before(node.NodeSpan().Pos.Offset, prev, &leading)
+		if leading != nil {
+			a.cm.get(node).Leading = leading
+		}
+		a.stat(stat)
+		a.inside(node)
+		prev = node
+	}
+
+	if block.RetExps != nil {
+		offset := limit
+		if len(block.RetExps) > 0 {
+			offset = SpanOf(block.RetExps[0]).Pos.Offset
+		}
+		var leading []*Comment
+		a.before(offset, prev, &leading)
+		if leading != nil {
+			a.cm.get(block).Leading = leading
+		}
+		a.exps(block.RetExps)
+		if n := len(block.RetExps); n > 0 {
+			last := SpanOf(block.RetExps[n-1]).End
+			for comment := a.next(last.Offset); comment != nil; comment = a.next(last.Offset) {
+				a.cm.get(block).Trailing = append(a.cm.get(block).Trailing, comment)
+			}
+			for len(a.comments) > 0 && a.comments[0].Pos.Offset < limit && a.comments[0].Pos.Line == last.Line {
+				a.cm.get(block).Trailing = append(a.cm.get(block).Trailing, a.next(limit))
+			}
+		}
+		prev = nil
+	}
+
+	var end []*Comment
+	a.before(limit, prev, &end)
+	if end != nil {
+		a.cm.get(block).End = end
+	}
+}
+
+func (a *commentAssigner) stat(stat Stat) {
+	switch x := stat.(type) {
+	case *DoStat:
+		a.block(x.Block, x.End.Offset)
+	case *WhileStat:
+		a.exp(x.Exp)
+		a.block(x.Block, x.End.Offset)
+	case *RepeatStat:
+		a.block(x.Block, SpanOf(x.Exp).Pos.Offset)
+		a.exp(x.Exp)
+	case *IfStat:
+		for i, exp := range x.Exps {
+			a.exp(exp)
+			limit := x.End.Offset
+			if i+1 < len(x.Exps) {
+				limit = SpanOf(x.Exps[i+1]).Pos.Offset
+			}
+			a.block(x.Blocks[i], limit)
+		}
+	case *ForNumStat:
+		a.exps([]Exp{x.InitExp, x.LimitExp, x.StepExp})
+		a.block(x.Block, x.End.Offset)
+	case *ForInStat:
+		a.exps(x.ExpList)
+		a.block(x.Block, x.End.Offset)
+	case *LocalFuncDefStat:
+		a.block(x.Exp.Block, x.End.Offset)
+	default:
+		a.exp(stat)
+	}
+}
+
+func (a *commentAssigner) exps(exps []Exp) {
+	for _, exp := range exps {
+		a.exp(exp)
+	}
+}
+
+//exp 表达式里只有函数体和表构造器能挂注释
+func (a *commentAssigner) exp(exp Exp) {
+	Inspect(exp, func(node Node) bool {
+		switch x := node.(type) {
+		case *FuncDefExp:
+			a.block(x.Block, x.End.Offset)
+			return false
+		case *TableConstructorExp:
+			a.table(x)
+			return false
+		}
+		return true
+	})
+}
+
+func (a *commentAssigner) table(table *TableConstructorExp) {
+	var prev Node
+	for i, val := range table.ValExps {
+		node := val.(Node)
+		var key Exp
+		start := node.NodeSpan().Pos.Offset
+		if i < len(table.KeyExps) && table.KeyExps[i] != nil {
+			key = table.KeyExps[i]
+			start = SpanOf(key).Pos.Offset
+		}
+		var leading []*Comment
+		a.before(start, prev, &leading)
+		if leading != nil {
+			a.cm.get(node).Leading = leading
+		}
+		a.exp(key)
+		a.exp(val)
+		a.inside(node)
+		prev = node
+	}
+	var end []*Comment
+	a.before(table.End.Offset, prev, &end)
+	if end != nil {
+		a.cm.get(table).End = end
+	}
+}
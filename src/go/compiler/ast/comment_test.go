@@ -0,0 +1,85 @@
+package ast_test
+
+import (
+	"go/compiler/ast"
+	"go/compiler/parser"
+	"reflect"
+	"testing"
+)
+
+const commentSource = `-- header
+local a = 1 -- after a
+-- before f
+local function f()
+  -- inside f
+  return a -- after return
+  -- end of f
+end
+local t = {
+  -- before x
+  x = 1, -- after x
+  -- end of t
+}
+if a then
+  -- only comment
+else --[[ else ]] f()
+end
+-- tail
+`
+
+//texts 返回注释的原文
+func texts(comments []*ast.Comment) []string {
+	var list []string
+	for _, comment := range comments {
+		list = append(list, comment.Text)
+	}
+	return list
+}
+
+func TestCommentMap(t *testing.T) {
+	block, cm, err := parser.ParseComments(commentSource, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := block.Stats[1].(*ast.LocalFuncDefStat).Exp.Block
+	table := block.Stats[2].(*ast.LocalVarDeclStat).ExpList[0].(*ast.TableConstructorExp)
+	ifStat := block.Stats[3].(*ast.IfStat)
+	tests := []struct {
+		node                   ast.Node
+		leading, trailing, end []string
+	}{
+		{block.Stats[0].(ast.Node), []string{"-- header"}, []string{"-- after a"}, nil},
+		{block.Stats[1].(ast.Node), []string{"-- before f"}, nil, nil},
+		{fn, []string{"-- inside f"}, []string{"-- after return"}, []string{"-- end of f"}},
+		{table.ValExps[0].(ast.Node), []string{"-- before x"}, []string{"-- after x"}, nil},
+		{table, nil, nil, []string{"-- end of t"}},
+		{ifStat.Blocks[0], nil, nil, []string{"-- only comment"}},
+		{ifStat.Blocks[1].Stats[0].(ast.Node), []string{"--[[ else ]]"}, nil, nil},
+		{block, nil, nil, []string{"-- tail"}},
+	}
+	for _, tt := range tests {
+		nc := cm[tt.node]
+		if nc == nil {
+			t.Errorf("%T@%d: no comments", tt.node, tt.node.NodeSpan().Pos.Line)
+			continue
+		}
+		if got := texts(nc.Leading); !reflect.DeepEqual(got, tt.leading) {
+			t.Errorf("%T@%d: leading %q, want %q", tt.node, tt.node.NodeSpan().Pos.Line, got, tt.leading)
+		}
+		if got := texts(nc.Trailing); !reflect.DeepEqual(got, tt.trailing) {
+			t.Errorf("%T@%d: trailing %q, want %q", tt.node, tt.node.NodeSpan().Pos.Line, got, tt.trailing)
+		}
+		if got := texts(nc.End); !reflect.DeepEqual(got, tt.end) {
+			t.Errorf("%T@%d: end %q, want %q", tt.node, tt.node.NodeSpan().Pos.Line, got, tt.end)
+		}
+	}
+	if len(cm) != len(tests) {
+		t.Errorf("comments attached to %d nodes, want %d", len(cm), len(tests))
+	}
+
+	want := []string{"-- header", "-- after a", "-- before f", "-- inside f", "-- after return", "-- end of f",
+		"-- before x", "-- after x", "-- end of t", "-- only comment", "--[[ else ]]", "-- tail"}
+	if got := texts(cm.Comments()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Comments() = %q, want %q", got, want)
+	}
+}
@@ -2,35 +2,65 @@ package ast
 
 type Exp interface{}
 
-type NilExp struct{ Line int }
-type TrueExp struct{ Line int }
-type FalseExp struct{ Line int }
-type VarargExp struct{ Line int }
-type IntegerExp struct
-{ 
+//BadExp 容错解析时代替缺失或者写错的表达式，缺失时Span是空区间
+type BadExp struct {
+	Span
 	Line int
-	Val int64
 }
+
+type NilExp struct {
+	Span
+	Line int
+}
+
+type TrueExp struct {
+	Span
+	Line int
+}
+
+type FalseExp struct {
+	Span
+	Line int
+}
+
+type VarargExp struct {
+	Span
+	Line int
+}
+
+type IntegerExp struct {
+	Span
+	Line int
+	Val  int64
+}
+
 type FloatExp struct {
+	Span
 	Line int
 	Val  float64
 }
+
 type StringExp struct {
+	Span
 	Line int
 	Val  string
 }
+
 type NameExp struct {
+	Span
 	Line int
 	Name string
 }
 
 type UnopExp struct {
+	Span
 	Line int
 	Op   int
 	Exp  Exp
 }
 
 type BinopExp struct {
+	Span
 	Line int
 	Op   int
 	Exp1 Exp
@@ -38,39 +68,46 @@ type BinopExp struct {
 }
 
 type ConcatExp struct {
+	Span
 	Line int
 	Exps []Exp
 }
 
 type TableConstructorExp struct {
+	Span
 	Line     int
 	LastLine int
 	KeyExps  []Exp
-	ValExp   []Exp
+	ValExps  []Exp
 }
 
 type FuncDefExp struct {
+	Span
 	Line     int
 	LastLine int
 	ParList  []string
+	ParSpans []Span //参数名在源码中的区间，方法隐含的self用方法名的区间
 	IsVararg bool
 	Block    *Block
 }
 
 type ParensExp struct {
+	Span
 	Exp Exp
 }
 
 type TableAccessExp struct {
+	Span
 	LastLine  int
 	PrefixExp Exp
 	KeyExp    Exp
 }
 
 type FuncCallExp struct {
+	Span
 	Line      int
 	LastLine  int
 	PrefixExp Exp
-	NameExp   Exp
+	NameExp   *StringExp
 	Args      []Exp
 }
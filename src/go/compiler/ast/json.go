@@ -0,0 +1,396 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go/compiler/lexer"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+/*
+语法树的JSON格式：
+	每个节点都是一个对象，"kind"字段是节点的类型名(比如"IntegerExp")，其余字段和Go结构体的字段同名；
+	Span/Pos是普通对象，不带kind；
+	Op字段写成运算符本身，比如"+"、"..", "not"；
+	nil切片写成null，空切片写成[]，二者含义不同(比如Block.RetExps)；
+	整数原样输出；非有限的浮点数写成字符串"inf"、"-inf"、"nan"；
+	不是合法UTF-8的字符串写成{"base64": "..."}。
+DecodeJSON检查解码出来的是合法的语法树：Stat字段里只有语句，Exp字段里只有表达式，
+成对的列表一样长，赋值语句的左边只有名字和下标访问。
+*/
+
+var (
+	nodeTypes = map[string]reflect.Type{}
+	statKinds = map[string]bool{} //可以出现在Stat字段里的节点
+	expKinds  = map[string]bool{} //可以出现在Exp字段里的节点
+
+	statType = reflect.TypeOf((*Stat)(nil)).Elem()
+	expType  = reflect.TypeOf((*Exp)(nil)).Elem()
+)
+
+func init() {
+	register := func(kinds map[string]bool, nodes ...interface{}) {
+		for _, node := range nodes {
+			t := reflect.TypeOf(node)
+			nodeTypes[t.Name()] = t
+			if kinds != nil {
+				kinds[t.Name()] = true
+			}
+		}
+	}
+	register(nil, Block{})
+	register(statKinds, EmptyStat{}, BadStat{}, BreakStat{}, LabelStat{}, GotoStat{}, DoStat{},
+		WhileStat{}, RepeatStat{}, IfStat{}, ForNumStat{}, ForInStat{},
+		LocalVarDeclStat{}, AssignStat{}, LocalFuncDefStat{}, FuncCallStat{})
+	register(expKinds, BadExp{}, NilExp{}, TrueExp{}, FalseExp{}, VarargExp{}, IntegerExp{}, FloatExp{},
+		StringExp{}, NameExp{}, UnopExp{}, BinopExp{}, ConcatExp{},
+		TableConstructorExp{}, FuncDefExp{}, ParensExp{}, TableAccessExp{}, FuncCallExp{})
+}
+
+var unopNames = map[int]string{
+	lexer.TOKEN_OP_UNM:  "-",
+	lexer.TOKEN_OP_NOT:  "not",
+	lexer.TOKEN_OP_LEN:  "#",
+	lexer.TOKEN_OP_BNOT: "~",
+}
+
+var binopNames = map[int]string{
+	lexer.TOKEN_OP_ADD:    "+",
+	lexer.TOKEN_OP_SUB:    "-",
+	lexer.TOKEN_OP_MUL:    "*",
+	lexer.TOKEN_OP_DIV:    "/",
+	lexer.TOKEN_OP_IDIV:   "//",
+	lexer.TOKEN_OP_MOD:    "%",
+	lexer.TOKEN_OP_POW:    "^",
+	lexer.TOKEN_OP_CONCAT: "..",
+	lexer.TOKEN_OP_BAND:   "&",
+	lexer.TOKEN_OP_BOR:    "|",
+	lexer.TOKEN_OP_BXOR:   "~",
+	lexer.TOKEN_OP_SHL:    "<<",
+	lexer.TOKEN_OP_SHR:    ">>",
+	lexer.TOKEN_OP_LT:     "<",
+	lexer.TOKEN_OP_LE:     "<=",
+	lexer.TOKEN_OP_GT:     ">",
+	lexer.TOKEN_OP_GE:     ">=",
+	lexer.TOKEN_OP_EQ:     "==",
+	lexer.TOKEN_OP_NE:     "~=",
+	lexer.TOKEN_OP_AND:    "and",
+	lexer.TOKEN_OP_OR:     "or",
+}
+
+func opNames(t reflect.Type) map[int]string {
+	if t == reflect.TypeOf(UnopExp{}) {
+		return unopNames
+	}
+	return binopNames
+}
+
+//EncodeJSON 把语法树节点(*Block、Stat或Exp)编码成带kind的JSON
+func EncodeJSON(node interface{}) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("ast: %v", r)
+		}
+	}()
+
+	buf := &bytes.Buffer{}
+	encodeValue(buf, reflect.ValueOf(&node).Elem())
+	return buf.Bytes(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+		} else {
+			encodeValue(buf, v.Elem())
+		}
+	case reflect.Struct:
+		encodeStruct(buf, v)
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encodeValue(buf, v.Index(i))
+		}
+		buf.WriteByte(']')
+	case reflect.String:
+		encodeString(buf, v.String())
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Float64:
+		encodeFloat(buf, v.Float())
+	default:
+		panic("unsupported type " + v.Type().String())
+	}
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) {
+	t := v.Type()
+	buf.WriteByte('{')
+	first := true
+	if nodeType, isNode := nodeTypes[t.Name()]; isNode && nodeType == t {
+		buf.WriteString(`"kind":`)
+		encodeString(buf, t.Name())
+		first = false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		field := t.Field(i)
+		encodeString(buf, field.Name)
+		buf.WriteByte(':')
+		if field.Name == "Op" {
+			op, found := opNames(t)[int(v.Field(i).Int())]
+			if !found {
+				panic(fmt.Sprintf("unknown operator %d in %s", v.Field(i).Int(), t.Name()))
+			}
+			encodeString(buf, op)
+		} else {
+			encodeValue(buf, v.Field(i))
+		}
+	}
+	buf.WriteByte('}')
+}
+
+func encodeString(buf *bytes.Buffer, s string) {
+	if !utf8.ValidString(s) {
+		buf.WriteString(`{"base64":"`)
+		buf.WriteString(base64.StdEncoding.EncodeToString([]byte(s)))
+		buf.WriteString(`"}`)
+		return
+	}
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+func encodeFloat(buf *bytes.Buffer, f float64) {
+	switch {
+	case math.IsInf(f, 1):
+		buf.WriteString(`"inf"`)
+	case math.IsInf(f, -1):
+		buf.WriteString(`"-inf"`)
+	case math.IsNaN(f):
+		buf.WriteString(`"nan"`)
+	default:
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+}
+
+//DecodeJSON 把EncodeJSON的输出还原成语法树节点，返回值是*Block或者某个Stat/Exp的指针
+func DecodeJSON(data []byte) (node interface{}, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("ast: unexpected data after the node")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			node, err = nil, fmt.Errorf("ast: %v", r)
+		}
+	}()
+	return decodeNode(x), nil
+}
+
+func decodeNode(x interface{}) interface{} {
+	if x == nil {
+		return nil
+	}
+	obj, ok := x.(map[string]interface{})
+	if !ok {
+		panic(fmt.Sprintf("node must be an object, got %T", x))
+	}
+	kind, _ := obj["kind"].(string)
+	t, found := nodeTypes[kind]
+	if !found {
+		panic(fmt.Sprintf("unknown node kind %q", kind))
+	}
+	ptr := reflect.New(t)
+	decodeStruct(ptr.Elem(), obj)
+	checkNode(ptr.Interface())
+	return ptr.Interface()
+}
+
+//checkNode 检查字段之间的关系，walk、printer和codegen都依赖它们
+func checkNode(node interface{}) {
+	switch n := node.(type) {
+	case *IfStat:
+		if len(n.Exps) != len(n.Blocks) {
+			panic(fmt.Sprintf("IfStat has %d conditions but %d blocks", len(n.Exps), len(n.Blocks)))
+		}
+	case *TableConstructorExp:
+		if len(n.KeyExps) != len(n.ValExps) {
+			panic(fmt.Sprintf("TableConstructorExp has %d keys but %d values", len(n.KeyExps), len(n.ValExps)))
+		}
+	case *AssignStat:
+		for i, v := range n.VarList {
+			switch v.(type) {
+			case *NameExp, *TableAccessExp:
+			default:
+				panic(fmt.Sprintf("AssignStat.VarList[%d]: cannot assign to %T", i, v))
+			}
+		}
+	}
+}
+
+//checkKind Stat字段里只能是语句，Exp字段里只能是表达式
+func checkKind(t reflect.Type, node interface{}, path string) {
+	kind := reflect.TypeOf(node).Elem().Name()
+	switch {
+	case t == statType && !statKinds[kind]:
+		panic(fmt.Sprintf("%s: %s is not a statement", path, kind))
+	case t == expType && !expKinds[kind]:
+		panic(fmt.Sprintf("%s: %s is not an expression", path, kind))
+	}
+}
+
+func decodeStruct(v reflect.Value, obj map[string]interface{}) {
+	t := v.Type()
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names) //错误信息稳定一些
+
+	for _, name := range names {
+		if name == "kind" {
+			continue
+		}
+		field, found := t.FieldByName(name)
+		if !found || len(field.Index) != 1 {
+			panic(fmt.Sprintf("unknown field %s.%s", t.Name(), name))
+		}
+		fv := v.FieldByIndex(field.Index)
+		if name == "Op" {
+			fv.SetInt(int64(decodeOp(t, obj[name])))
+		} else {
+			decodeValue(fv, obj[name], t.Name()+"."+name)
+		}
+	}
+}
+
+func decodeOp(t reflect.Type, x interface{}) int {
+	s, _ := x.(string)
+	for op, name := range opNames(t) {
+		if name == s {
+			return op
+		}
+	}
+	panic(fmt.Sprintf("unknown operator %v in %s", x, t.Name()))
+}
+
+func decodeValue(v reflect.Value, x interface{}, path string) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if node := decodeNode(x); node != nil {
+			checkKind(v.Type(), node, path)
+			v.Set(reflect.ValueOf(node))
+		}
+	case reflect.Ptr:
+		if x == nil {
+			return
+		}
+		node := decodeNode(x)
+		if reflect.TypeOf(node) != v.Type() {
+			panic(fmt.Sprintf("%s: want %s, got %T", path, v.Type().Elem().Name(), node))
+		}
+		v.Set(reflect.ValueOf(node))
+	case reflect.Struct:
+		obj, ok := x.(map[string]interface{})
+		if !ok {
+			panic(fmt.Sprintf("%s: want object, got %T", path, x))
+		}
+		decodeStruct(v, obj)
+	case reflect.Slice:
+		if x == nil {
+			return
+		}
+		arr, ok := x.([]interface{})
+		if !ok {
+			panic(fmt.Sprintf("%s: want array, got %T", path, x))
+		}
+		slice := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, elem := range arr {
+			decodeValue(slice.Index(i), elem, fmt.Sprintf("%s[%d]", path, i))
+		}
+		v.Set(slice)
+	case reflect.String:
+		v.SetString(decodeString(x, path))
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			panic(fmt.Sprintf("%s: want bool, got %T", path, x))
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, ok := x.(json.Number)
+		if !ok {
+			panic(fmt.Sprintf("%s: want integer, got %T", path, x))
+		}
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("%s: %v", path, err))
+		}
+		v.SetInt(i)
+	case reflect.Float64:
+		v.SetFloat(decodeFloat(x, path))
+	}
+}
+
+func decodeString(x interface{}, path string) string {
+	switch s := x.(type) {
+	case string:
+		return s
+	case map[string]interface{}:
+		if b64, ok := s["base64"].(string); ok && len(s) == 1 {
+			b, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				panic(fmt.Sprintf("%s: %v", path, err))
+			}
+			return string(b)
+		}
+	}
+	panic(fmt.Sprintf("%s: want string, got %T", path, x))
+}
+
+func decodeFloat(x interface{}, path string) float64 {
+	switch f := x.(type) {
+	case json.Number:
+		if v, err := strconv.ParseFloat(string(f), 64); err == nil {
+			return v
+		}
+	case string:
+		switch f {
+		case "inf":
+			return math.Inf(1)
+		case "-inf":
+			return math.Inf(-1)
+		case "nan":
+			return math.NaN()
+		}
+	}
+	panic(fmt.Sprintf("%s: want number, got %T", path, x))
+}
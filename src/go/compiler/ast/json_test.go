@@ -0,0 +1,93 @@
+package ast_test
+
+import (
+	"go/compiler"
+	"go/compiler/ast"
+	"go/compiler/parser"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//luaSources 返回src/lua/*/*.lua，去掉了#!开头的第一行
+func luaSources(t *testing.T) map[string]string {
+	t.Helper()
+	paths, err := filepath.Glob("../../../lua/*/*.lua")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no lua sources found: %v", err)
+	}
+	sources := map[string]string{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := string(data)
+		sources[path] = src[compiler.SkipComment(src):]
+	}
+	return sources
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	sources := luaSources(t)
+	sources["special"] = "local s, f, g = '\\xff\\0', 1/0, 2^53 return -s, #s, not f, ~g, s .. s .. s, {1, x = 2, [3] = 4}"
+	for name, src := range sources {
+		block, err := parser.Parse(src, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		data, err := ast.EncodeJSON(block)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		node, err := ast.DecodeJSON(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(node, block) {
+			t.Errorf("%s: decoded tree differs from the parsed one", name)
+		}
+	}
+}
+
+//TestDecodeJSONRejects 外部工具生成的不合法的语法树在解码时就要报错，不能留给walk或者codegen去panic
+func TestDecodeJSONRejects(t *testing.T) {
+	tests := []struct {
+		json, want string
+	}{
+		{`{"kind":"IfStat","Exps":[{"kind":"TrueExp"}],"Blocks":[]}`, "1 conditions but 0 blocks"},
+		{`{"kind":"TableConstructorExp","KeyExps":[null],"ValExps":[]}`, "1 keys but 0 values"},
+		{`{"kind":"Block","Stats":[{"kind":"IntegerExp","Val":1}]}`, "Block.Stats[0]: IntegerExp is not a statement"},
+		{`{"kind":"ReturnStat"}`, "unknown node kind"},
+		{`{"kind":"WhileStat","Exp":{"kind":"BreakStat"}}`, "WhileStat.Exp: BreakStat is not an expression"},
+		{`{"kind":"AssignStat","VarList":[{"kind":"IntegerExp","Val":1}],"ExpList":[{"kind":"IntegerExp","Val":1}]}`, "cannot assign to *ast.IntegerExp"},
+		{`{"kind":"AssignStat","VarList":[{"kind":"FuncCallExp"}],"ExpList":[]}`, "cannot assign to *ast.FuncCallExp"},
+		{`{"kind":"DoStat","Block":{"kind":"NilExp"}}`, "DoStat.Block: want Block"},
+		{`{"kind":"NilExp","Foo":1}`, "unknown field NilExp.Foo"},
+		{`{"kind":"UnopExp","Op":"!"}`, "unknown operator"},
+		{`{"kind":"NilExp"} {"kind":"NilExp"}`, "unexpected data after the node"},
+		{`{"kind":"NilExp"}}`, "unexpected data after the node"},
+	}
+	for _, tt := range tests {
+		node, err := ast.DecodeJSON([]byte(tt.json))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want error containing %q", tt.json, err, tt.want)
+		}
+		if node != nil {
+			t.Errorf("%s: got a node with the error", tt.json)
+		}
+	}
+
+	//合法的树，包括语句也是表达式的函数调用和数组部分的nil键
+	for _, s := range []string{
+		`{"kind":"Block","Stats":[{"kind":"FuncCallExp","PrefixExp":{"kind":"NameExp","Name":"f"}}]}`,
+		`{"kind":"TableConstructorExp","KeyExps":[null],"ValExps":[{"kind":"TrueExp"}]}`,
+		`{"kind":"NilExp"}` + "\n",
+	} {
+		if _, err := ast.DecodeJSON([]byte(s)); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+//ApplyFunc Rewrite在每个节点上调用的函数，通过Cursor可以替换、删除当前节点或者在它前后插入节点
+type ApplyFunc func(c *Cursor) bool
+
+//Rewrite 按源码顺序深度优先地遍历node，并返回(可能被替换掉的)根节点；
+//pre在访问子节点之前调用，返回false时跳过子节点，也不调用post；
+//post在访问子节点之后调用，返回false时立即结束整个遍历；
+//pre替换了当前节点时，接着遍历的是新节点的子节点；pre和post都可以为nil，为nil的子节点不会被访问
+func Rewrite(node interface{}, pre, post ApplyFunc) (result interface{}) {
+	parent := &rootNode{toNode(node)}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+
+	a := &application{pre: pre, post: post}
+	a.apply(parent, "Node", nil, parent.Node)
+	return
+}
+
+var abort = new(int)
+
+type rootNode struct {
+	Node
+}
+
+//Cursor 描述Rewrite当前所在的节点以及它在父节点中的位置
+type Cursor struct {
+	parent Node
+	name   string
+	iter   *iterator //当前节点在切片里时不为nil
+	node   Node
+}
+
+type iterator struct {
+	index, step int
+	paired      bool //IfStat.Exps/Blocks和TableConstructorExp.KeyExps/ValExps是一一对应的
+}
+
+//Node 返回当前节点
+func (c *Cursor) Node() Node {
+	return c.node
+}
+
+//Parent 返回当前节点的父节点，根节点的父节点是nil
+func (c *Cursor) Parent() Node {
+	if _, ok := c.parent.(*rootNode); ok {
+		return nil
+	}
+	return c.parent
+}
+
+//Name 返回当前节点在父节点中的字段名，比如"Stats"、"Exp1"
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+//Index 当前节点在父节点的切片字段里时返回它的下标，否则返回-1
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+func (c *Cursor) field() reflect.Value {
+	return reflect.Indirect(reflect.ValueOf(c.parent)).FieldByName(c.name)
+}
+
+//Replace 把当前节点换成node，node的类型必须能放进父节点的这个字段，否则panic
+func (c *Cursor) Replace(node interface{}) {
+	v := c.field()
+	if i := c.Index(); i >= 0 {
+		v = v.Index(i)
+	}
+	if node == nil {
+		v.Set(reflect.Zero(v.Type()))
+	} else {
+		v.Set(reflect.ValueOf(node))
+	}
+	c.node = toNode(node)
+}
+
+//Delete 从父节点的切片里删掉当前节点，比如删掉Block.Stats里的一条语句
+func (c *Cursor) Delete() {
+	v := c.listField("Delete")
+	i, l := c.Index(), v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+}
+
+//InsertAfter 在当前节点后面插入node，Rewrite不会遍历新插入的节点
+func (c *Cursor) InsertAfter(node interface{}) {
+	v := c.listField("InsertAfter")
+	i := c.Index()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(reflect.ValueOf(node))
+	c.iter.step++
+}
+
+//InsertBefore 在当前节点前面插入node，Rewrite不会遍历新插入的节点
+func (c *Cursor) InsertBefore(node interface{}) {
+	v := c.listField("InsertBefore")
+	i := c.Index()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(reflect.ValueOf(node))
+	c.iter.index++
+}
+
+func (c *Cursor) listField(op string) reflect.Value {
+	if c.iter == nil {
+		panic(fmt.Sprintf("ast: %s: %s.%s is not a list", op, reflect.TypeOf(c.parent).Elem().Name(), c.name))
+	}
+	if c.iter.paired {
+		panic(fmt.Sprintf("ast: %s: elements of %s.%s must stay paired", op, reflect.TypeOf(c.parent).Elem().Name(), c.name))
+	}
+	return c.field()
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+func (a *application) apply(parent Node, name string, iter *iterator, node interface{}) {
+	n := toNode(node)
+	if n == nil {
+		return
+	}
+
+	saved := a.cursor
+	a.cursor = Cursor{parent: parent, name: name, iter: iter, node: n}
+	if a.pre != nil {
+		if !a.pre(&a.cursor) {
+			a.cursor = saved
+			return
+		}
+		n = a.cursor.node
+	}
+
+	switch n := n.(type) {
+	case nil:
+	case *Block:
+		a.applyList(n, "Stats")
+		a.applyList(n, "RetExps")
+	case *EmptyStat, *BadStat, *BreakStat, *LabelStat, *GotoStat:
+	case *DoStat:
+		a.apply(n, "Block", nil, n.Block)
+	case *WhileStat:
+		a.apply(n, "Exp", nil, n.Exp)
+		a.apply(n, "Block", nil, n.Block)
+	case *RepeatStat:
+		a.apply(n, "Block", nil, n.Block)
+		a.apply(n, "Exp", nil, n.Exp)
+	case *IfStat:
+		a.applyPairs(n, "Exps", "Blocks")
+	case *ForNumStat:
+		a.apply(n, "InitExp", nil, n.InitExp)
+		a.apply(n, "LimitExp", nil, n.LimitExp)
+		a.apply(n, "StepExp", nil, n.StepExp)
+		a.apply(n, "Block", nil, n.Block)
+	case *ForInStat:
+		a.applyList(n, "ExpList")
+		a.apply(n, "Block", nil, n.Block)
+	case *LocalVarDeclStat:
+		a.applyList(n, "ExpList")
+	case *AssignStat:
+		a.applyList(n, "VarList")
+		a.applyList(n, "ExpList")
+	case *LocalFuncDefStat:
+		a.apply(n, "Exp", nil, n.Exp)
+	case *BadExp, *NilExp, *TrueExp, *FalseExp, *VarargExp, *IntegerExp, *FloatExp, *StringExp, *NameExp:
+	case *UnopExp:
+		a.apply(n, "Exp", nil, n.Exp)
+	case *BinopExp:
+		a.apply(n, "Exp1", nil, n.Exp1)
+		a.apply(n, "Exp2", nil, n.Exp2)
+	case *ConcatExp:
+		a.applyList(n, "Exps")
+	case *TableConstructorExp:
+		a.applyPairs(n, "KeyExps", "ValExps")
+	case *FuncDefExp:
+		a.apply(n, "Block", nil, n.Block)
+	case *ParensExp:
+		a.apply(n, "Exp", nil, n.Exp)
+	case *TableAccessExp:
+		a.apply(n, "PrefixExp", nil, n.PrefixExp)
+		a.apply(n, "KeyExp", nil, n.KeyExp)
+	case *FuncCallExp:
+		a.apply(n, "PrefixExp", nil, n.PrefixExp)
+		a.apply(n, "NameExp", nil, n.NameExp)
+		a.applyList(n, "Args")
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+	a.cursor = saved
+}
+
+func (a *application) applyList(parent Node, name string) {
+	saved := a.iter
+	a.iter = iterator{}
+	for {
+		v := reflect.Indirect(reflect.ValueOf(parent)).FieldByName(name)
+		if a.iter.index >= v.Len() {
+			break
+		}
+		a.iter.step = 1
+		a.apply(parent, name, &a.iter, v.Index(a.iter.index).Interface())
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
+//applyPairs 按源码顺序交替访问两个一一对应的列表
+func (a *application) applyPairs(parent Node, name1, name2 string) {
+	saved := a.iter
+	v := reflect.Indirect(reflect.ValueOf(parent))
+	for i := 0; i < v.FieldByName(name2).Len(); i++ {
+		for _, name := range []string{name1, name2} {
+			if list := v.FieldByName(name); i < list.Len() {
+				a.iter = iterator{index: i, paired: true}
+				a.apply(parent, name, &a.iter, list.Index(i).Interface())
+			}
+		}
+	}
+	a.iter = saved
+}
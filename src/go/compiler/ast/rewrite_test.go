@@ -0,0 +1,133 @@
+package ast_test
+
+import (
+	"fmt"
+	"go/compiler/ast"
+	"go/compiler/parser"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, src string) *ast.Block {
+	t.Helper()
+	block, err := parser.Parse(src, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+//target 返回赋值语句左边第一个变量的名字
+func target(node ast.Node) string {
+	if stat, ok := node.(*ast.AssignStat); ok {
+		if name, ok := stat.VarList[0].(*ast.NameExp); ok {
+			return name.Name
+		}
+	}
+	return ""
+}
+
+func TestRewriteStats(t *testing.T) {
+	block := mustParse(t, "a = 1 b = 2 c = 3 d = 4")
+	var visited []string
+	ast.Rewrite(block, func(c *ast.Cursor) bool {
+		name := target(c.Node())
+		if name == "" {
+			return true
+		}
+		visited = append(visited, fmt.Sprintf("%s@%d", name, c.Index()))
+		if c.Name() != "Stats" || c.Parent() != block {
+			t.Errorf("%s: cursor at %T.%s", name, c.Parent(), c.Name())
+		}
+		switch name {
+		case "a":
+			c.InsertBefore(mustParse(t, "w = 0").Stats[0])
+		case "b":
+			c.Delete()
+		case "c":
+			c.InsertBefore(mustParse(t, "x = 0").Stats[0])
+			c.InsertAfter(mustParse(t, "y = 0").Stats[0])
+		}
+		return false
+	}, nil)
+
+	//新插入的语句不会被访问，删除和插入以后后面的语句仍然各访问一次
+	if got, want := strings.Join(visited, " "), "a@0 b@2 c@2 d@5"; got != want {
+		t.Errorf("visited %s, want %s", got, want)
+	}
+	if got, want := sprint(t, block), "w = 0\na = 1\nx = 0\nc = 3\ny = 0\nd = 4\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRewriteReplace(t *testing.T) {
+	block := mustParse(t, "local x = a + f(a)")
+	result := ast.Rewrite(block, nil, func(c *ast.Cursor) bool {
+		if name, ok := c.Node().(*ast.NameExp); ok && name.Name == "a" {
+			c.Replace(&ast.NameExp{Name: "b"})
+		}
+		return true
+	})
+	if result != block {
+		t.Errorf("root replaced by %T", result)
+	}
+	if got, want := sprint(t, block), "local x = b + f(b)\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	//替换根节点
+	result = ast.Rewrite(block.Stats[0].(*ast.LocalVarDeclStat).ExpList[0], func(c *ast.Cursor) bool {
+		if c.Parent() != nil {
+			t.Errorf("root has parent %T", c.Parent())
+		}
+		c.Replace(&ast.IntegerExp{Val: 1})
+		return false
+	}, nil)
+	if n, ok := result.(*ast.IntegerExp); !ok || n.Val != 1 {
+		t.Errorf("root = %#v", result)
+	}
+}
+
+//TestRewriteAbort post返回false时立即结束遍历
+func TestRewriteAbort(t *testing.T) {
+	var visited []string
+	ast.Rewrite(mustParse(t, "a = 1 b = 2 c = 3"), nil, func(c *ast.Cursor) bool {
+		if name := target(c.Node()); name != "" {
+			visited = append(visited, name)
+			return name != "b"
+		}
+		return true
+	})
+	if got := strings.Join(visited, " "); got != "a b" {
+		t.Errorf("visited %s, want a b", got)
+	}
+}
+
+//TestRewritePanics 一一对应的列表和不是列表的字段都不能增删元素
+func TestRewritePanics(t *testing.T) {
+	tests := []struct {
+		src, field string
+		op         func(c *ast.Cursor)
+		want       string
+	}{
+		{"if a then end", "Exps", (*ast.Cursor).Delete, "ast: Delete: elements of IfStat.Exps must stay paired"},
+		{"if a then end", "Blocks", func(c *ast.Cursor) { c.InsertAfter(&ast.Block{}) }, "ast: InsertAfter: elements of IfStat.Blocks must stay paired"},
+		{"local t = {1}", "ValExps", func(c *ast.Cursor) { c.InsertBefore(&ast.NilExp{}) }, "ast: InsertBefore: elements of TableConstructorExp.ValExps must stay paired"},
+		{"x = a + 1", "Exp1", (*ast.Cursor).Delete, "ast: Delete: BinopExp.Exp1 is not a list"},
+	}
+	for _, tt := range tests {
+		got := func() (msg interface{}) {
+			defer func() { msg = recover() }()
+			ast.Rewrite(mustParse(t, tt.src), func(c *ast.Cursor) bool {
+				if c.Name() == tt.field {
+					tt.op(c)
+				}
+				return true
+			}, nil)
+			return nil
+		}()
+		if got != tt.want {
+			t.Errorf("%q %s: panic %v, want %q", tt.src, tt.field, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package ast
+
+import "go/compiler/lexer"
+
+//Pos 源码中的一个位置，Line和Column从1开始，Column和Offset都按字节计算
+type Pos = lexer.Pos
+
+//Span 节点在源码中的区间，End指向最后一个字节的下一个位置
+type Span struct {
+	Pos Pos
+	End Pos
+}
+
+//NodeSpan 返回节点在源码中的区间
+func (span Span) NodeSpan() Span {
+	return span
+}
+
+//Node 所有语法树节点都嵌入了Span，因此都实现了Node
+type Node interface {
+	NodeSpan() Span
+}
+
+//SpanOf 返回Stat或Exp的区间，node为nil时返回零值
+func SpanOf(node interface{}) Span {
+	if n, ok := node.(Node); ok {
+		return n.NodeSpan()
+	}
+	return Span{}
+}
@@ -0,0 +1,104 @@
+package ast_test
+
+import (
+	"bytes"
+	"go/compiler/ast"
+	"go/compiler/parser"
+	"go/compiler/printer"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func sprint(t *testing.T, node interface{}) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, node); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+//synthesized 判断node是不是语法糖补出来的节点，这些节点的区间指向引出它的记号，重新解析得不到同样的节点：
+//a.x和{x = 1}里的键x、for循环省略的步长1(区间为空)、else对应的条件true
+func synthesized(text string, node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.StringExp:
+		return text == n.Val && name.MatchString(text)
+	case *ast.IntegerExp:
+		return text == "" && n.Val == 1
+	case *ast.TrueExp:
+		return text == "else"
+	}
+	return false
+}
+
+var (
+	name   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	method = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*:[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+//reparse 把text重新解析成和node同类的节点：*ast.Block按整个chunk解析，语句要求正好是一条，表达式放在return后面；
+//function f() end里的函数的区间是整条语句，要按语句解析再取出函数；function a.b:m() end里的a.b:m按a.b.m解析
+func reparse(text string, node ast.Node) (interface{}, error) {
+	if _, ok := node.(*ast.TableAccessExp); ok && method.MatchString(text) {
+		text = strings.Replace(text, ":", ".", 1)
+	}
+	if _, ok := node.(*ast.FuncDefExp); ok && strings.HasPrefix(text, "function ") && !strings.HasPrefix(text, "function (") {
+		block, err := parser.Parse(text, "span")
+		if err != nil || len(block.Stats) != 1 {
+			return block, err
+		}
+		if stat, ok := block.Stats[0].(*ast.AssignStat); ok && len(stat.ExpList) == 1 {
+			return stat.ExpList[0], nil
+		}
+		return block, nil
+	}
+	switch node.(type) {
+	case *ast.Block:
+		return parser.Parse(text, "span")
+	case *ast.EmptyStat, *ast.BreakStat, *ast.LabelStat, *ast.GotoStat, *ast.DoStat,
+		*ast.WhileStat, *ast.RepeatStat, *ast.IfStat, *ast.ForNumStat, *ast.ForInStat,
+		*ast.LocalVarDeclStat, *ast.AssignStat, *ast.LocalFuncDefStat:
+		block, err := parser.Parse(text, "span")
+		if err != nil || len(block.Stats) != 1 {
+			return block, err
+		}
+		return block.Stats[0], nil
+	default:
+		block, err := parser.Parse("return "+text, "span")
+		if err != nil || len(block.RetExps) != 1 {
+			return block, err
+		}
+		return block.RetExps[0], nil
+	}
+}
+
+//TestNodeSpans 每个节点的区间截出来的源码重新解析后要得到同样的节点
+func TestNodeSpans(t *testing.T) {
+	sources := luaSources(t)
+	sources["special"] = "::top:: local t = {1, [2] = (3), x = -4} function t.a.b:m(...) goto top end repeat t:m(\"s\") until #t > 1 ; return (t)"
+	for name, src := range sources {
+		block, err := parser.Parse(src, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ast.Inspect(block, func(node ast.Node) bool {
+			if node == nil {
+				return false
+			}
+			span := node.NodeSpan()
+			text := src[span.Pos.Offset:span.End.Offset]
+			if synthesized(text, node) {
+				return true
+			}
+			got, err := reparse(text, node)
+			if err != nil {
+				t.Errorf("%s:%d:%d: %T %q: %v", name, span.Pos.Line, span.Pos.Column, node, text, err)
+			} else if want := sprint(t, node); sprint(t, got) != want {
+				t.Errorf("%s:%d:%d: %T %q reparses to %q", name, span.Pos.Line, span.Pos.Column, node, text, sprint(t, got))
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+//Visitor Walk遇到每个节点时调用Visit，返回的Visitor用来访问这个节点的子节点，返回nil则跳过子节点；
+//子节点都访问完以后还会调用一次w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+//Walk 按源码顺序深度优先地遍历node(*Block、Stat或Exp)，为nil的子节点不会被访问
+func Walk(v Visitor, node interface{}) {
+	n := toNode(node)
+	if n == nil {
+		return
+	}
+	if v = v.Visit(n); v == nil {
+		return
+	}
+
+	switch n := n.(type) {
+	case *Block:
+		for _, stat := range n.Stats {
+			Walk(v, stat)
+		}
+		walkList(v, n.RetExps)
+	case *EmptyStat, *BadStat, *BreakStat, *LabelStat, *GotoStat:
+	case *DoStat:
+		Walk(v, n.Block)
+	case *WhileStat:
+		Walk(v, n.Exp)
+		Walk(v, n.Block)
+	case *RepeatStat:
+		Walk(v, n.Block)
+		Walk(v, n.Exp)
+	case *IfStat:
+		for i, exp := range n.Exps {
+			Walk(v, exp)
+			Walk(v, n.Blocks[i])
+		}
+	case *ForNumStat:
+		Walk(v, n.InitExp)
+		Walk(v, n.LimitExp)
+		Walk(v, n.StepExp)
+		Walk(v, n.Block)
+	case *ForInStat:
+		walkList(v, n.ExpList)
+		Walk(v, n.Block)
+	case *LocalVarDeclStat:
+		walkList(v, n.ExpList)
+	case *AssignStat:
+		walkList(v, n.VarList)
+		walkList(v, n.ExpList)
+	case *LocalFuncDefStat:
+		Walk(v, n.Exp)
+	case *BadExp, *NilExp, *TrueExp, *FalseExp, *VarargExp, *IntegerExp, *FloatExp, *StringExp, *NameExp:
+	case *UnopExp:
+		Walk(v, n.Exp)
+	case *BinopExp:
+		Walk(v, n.Exp1)
+		Walk(v, n.Exp2)
+	case *ConcatExp:
+		walkList(v, n.Exps)
+	case *TableConstructorExp:
+		for i, val := range n.ValExps {
+			if i < len(n.KeyExps) {
+				Walk(v, n.KeyExps[i])
+			}
+			Walk(v, val)
+		}
+	case *FuncDefExp:
+		Walk(v, n.Block)
+	case *ParensExp:
+		Walk(v, n.Exp)
+	case *TableAccessExp:
+		Walk(v, n.PrefixExp)
+		Walk(v, n.KeyExp)
+	case *FuncCallExp:
+		Walk(v, n.PrefixExp)
+		Walk(v, n.NameExp)
+		walkList(v, n.Args)
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkList(v Visitor, list []Exp) {
+	for _, node := range list {
+		Walk(v, node)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+//Inspect 用f遍历node，f返回false时跳过当前节点的子节点；访问完子节点以后会调用f(nil)
+func Inspect(node interface{}, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+//toNode 把Stat/Exp转成Node，nil接口和nil指针都返回nil
+func toNode(node interface{}) Node {
+	if node == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(node); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	n, ok := node.(Node)
+	if !ok {
+		panic(fmt.Sprintf("ast: %T is not a node", node))
+	}
+	return n
+}
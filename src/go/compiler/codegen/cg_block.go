@@ -5,34 +5,74 @@ import (
 )
 
 func cgBlock(f *funcInfo, node *ast.Block) {
-	for _, stat := range node.Stat {
-		cgStat(f, stat)
+	for i, stat := range node.Stats {
+		if labelStat, ok := stat.(*ast.LabelStat); ok {
+			cgLabelStat(f, labelStat, node.RetExps == nil && isVoidStats(node.Stats[i+1:]))
+		} else {
+			cgStat(f, stat)
+		}
 	}
 	if node.RetExps != nil {
-		cgRetStat(f, node.RetExps)
+		cgRetStat(f, node.RetExps, node.LastLine)
+	}
+}
+
+// isVoidStats label后面只有空语句和label时，这个label就在block的末尾
+func isVoidStats(stats []ast.Stat) bool {
+	for _, stat := range stats {
+		switch stat.(type) {
+		case *ast.EmptyStat, *ast.LabelStat:
+		default:
+			return false
+		}
 	}
+	return true
 }
 
-func cgRetStat(f *funcInfo, exps []ast.Exp) {
+func cgRetStat(f *funcInfo, exps []ast.Exp, lastLine int) {
 	nExps := len(exps)
 	if nExps == 0 {
-		f.emitReturn(0, 0)
+		f.emitReturn(lastLine, 0, 0)
 		return
 	}
-	multRet := isVarargOrFuncCall(exps[nExps - 1])
+	if nExps == 1 {
+		if nameExp, ok := exps[0].(*ast.NameExp); ok {
+			if r := f.slotOfLocVar(nameExp.Name); r >= 0 {
+				f.emitReturn(lastLine, r, 1)
+				return
+			}
+		}
+		if fcExp, ok := exps[0].(*ast.FuncCallExp); ok {
+			r := f.allocReg()
+			cgTailCallExp(f, fcExp, r)
+			f.freeReg()
+			f.emitReturn(lastLine, r, -1)
+			return
+		}
+	}
+
+	multRet := isVarargOrFuncCall(exps[nExps-1])
 	for i, exp := range exps {
 		r := f.allocReg()
-		if i == nExps -1 && multRet {
+		if i == nExps-1 && multRet {
 			cgExp(f, exp, r, -1)
-		}else{
+		} else {
 			cgExp(f, exp, r, 1)
 		}
 	}
+	f.freeRegs(nExps)
+
+	a := f.useRegs
+	if multRet {
+		f.emitReturn(lastLine, a, -1)
+	} else {
+		f.emitReturn(lastLine, a, nExps)
+	}
 }
 
 func isVarargOrFuncCall(exp ast.Exp) bool {
 	switch exp.(type) {
-	case *ast.VarargExp, *FuncCallExp:
+	case *ast.VarargExp, *ast.FuncCallExp:
 		return true
 	}
 	return false
@@ -40,23 +80,47 @@ func isVarargOrFuncCall(exp ast.Exp) bool {
 
 func cgStat(f *funcInfo, node ast.Stat) {
 	switch stat := node.(type) {
-	case *ast.FuncCallStat: cgFuncCallStat(f, stat)
-	case *ast.BreakState: cgBreakStat(f, stat)
-	case *ast.DoStat: cgDoStat(f, stat)
-	case *ast.RepeatStat: cgRepeatStat(f, stat)
-	case *ast.WhileStat: cgWhileStat(f, stat)
-	case *ast.IfStat: cgIfStat(f, stat)
-	case *ast.ForNumStat: cgForNumStat(f, stat)
-	case *ast.ForInStat: cgForInStat(f, stat)
-	case *ast.AssignStat: cgAssignStat(f, stat)
-	case *ast.LocalVarDeclStat: cgLocalVarDeclStat(f, stat)
-	case *ast.LocalFuncDefStat: cgLocalFuncDefStat(f, stat)
-	case *ast.LabelStat, *ast.GotoStat: panic("not support!!")
+	case *ast.FuncCallStat:
+		cgFuncCallStat(f, stat)
+	case *ast.BreakStat:
+		cgBreakStat(f, stat)
+	case *ast.DoStat:
+		cgDoStat(f, stat)
+	case *ast.RepeatStat:
+		cgRepeatStat(f, stat)
+	case *ast.WhileStat:
+		cgWhileStat(f, stat)
+	case *ast.IfStat:
+		cgIfStat(f, stat)
+	case *ast.ForNumStat:
+		cgForNumStat(f, stat)
+	case *ast.ForInStat:
+		cgForInStat(f, stat)
+	case *ast.AssignStat:
+		cgAssignStat(f, stat)
+	case *ast.LocalVarDeclStat:
+		cgLocalVarDeclStat(f, stat)
+	case *ast.LocalFuncDefStat:
+		cgLocalFuncDefStat(f, stat)
+	case *ast.LabelStat:
+		cgLabelStat(f, stat, false)
+	case *ast.GotoStat:
+		cgGotoStat(f, stat)
 	}
 }
 
-func cgLocalFuncDefStat(f *funcInfo, node *ast.LocalFuncDefStat){
-	r := f.addLocalVar(node.Name)
+func cgLabelStat(f *funcInfo, node *ast.LabelStat, atEnd bool) {
+	f.addLabel(node.Name, node.Line, atEnd)
+}
+
+func cgGotoStat(f *funcInfo, node *ast.GotoStat) {
+	pc := f.emitJmp(node.Line, 0, 0)
+	f.addGoto(node.Name, node.Line, pc)
+}
+
+func cgLocalFuncDefStat(f *funcInfo, node *ast.LocalFuncDefStat) {
+	// 和luac一样，CLOSURE之后局部函数才出现在调试信息里
+	r := f.addLocalVar(node.Name, f.pc()+2)
 	cgFuncDefExp(f, node.Exp, r)
 }
 
@@ -67,110 +131,107 @@ func cgFuncCallStat(f *funcInfo, node *ast.FuncCallStat) {
 }
 
 func cgBreakStat(f *funcInfo, node *ast.BreakStat) {
-	pc := f.emitJmp(0, 0)
-	f.addBreakJmp(pc)
+	pc := f.emitJmp(node.Line, 0, 0)
+	f.addBreakJmp(pc, node.Line)
 }
 
 func cgDoStat(f *funcInfo, node *ast.DoStat) {
 	f.enterScope(false)
 	cgBlock(f, node.Block)
-	f.closeOpenUpvals()
-	f.exitScope()
+	f.closeOpenUpvals(node.Block.LastLine)
+	f.exitScope(f.pc() + 1)
 }
 
 //While Stat
 func cgWhileStat(f *funcInfo, node *ast.WhileStat) {
 	pcBeforeExp := f.pc()
-
-	r := f.allocReg()
-	cgExp(f, node.Exp, r, 1)
-	f.freeReg()
-
-	f.emitTest(r, 0)
-	pcJmpToEnd := f.emitJmp(0, 0)
+	pcJmpToEnd := cgCondJmp(f, node.Exp, 0)
 
 	f.enterScope(true)
 	cgBlock(f, node.Block)
-	f.closeOpenUpvals()
-	f.emitJmp(0, pcBeforeExp - f.pc() - 1)
-	f.exitScope()
+	f.closeOpenUpvals(node.Block.LastLine)
+	f.emitJmp(node.Block.LastLine, 0, pcBeforeExp-f.pc()-1)
+	// 循环体的局部变量在跳回去的JMP之前结束
+	f.exitScope(f.pc())
 
-	f.fixSbx(pcJmpToEnd, f.pc() - pcJmpToEnd)
+	if pcJmpToEnd >= 0 {
+		f.fixSbx(pcJmpToEnd, f.pc()-pcJmpToEnd)
+	}
 }
 
-
 //RepeatStat
 func cgRepeatStat(f *funcInfo, node *ast.RepeatStat) {
 	f.enterScope(true)
+	f.labels[len(f.labels)-1].untilFollow = true
 
-	pcBeforeExp := f.pc()
+	pcBeforeBlock := f.pc()
 	cgBlock(f, node.Block)
 
-	r := f.allocReg()
-	cgExp(f, node.Exp, r, 1)
-	f.freeReg()
-
-	f.emitTest(r, 0)
-	f.emitJmp(f.getJmpArgA, pcBeforeExp - f.pc() - 1)
-	f.closeOpenUpvals()
+	if pc := cgCondJmp(f, node.Exp, f.getJmpArgA()); pc >= 0 {
+		f.fixSbx(pc, pcBeforeBlock-pc)
+	}
+	f.closeOpenUpvals(lastLineOf(node.Exp))
 
-	f.exitScope()
+	f.exitScope(f.pc() + 1)
 }
 
 //if Stat
 func cgIfStat(f *funcInfo, node *ast.IfStat) {
-	pcJmpToEnds := make([]int, len(node.exps))
+	pcJmpToEnds := make([]int, len(node.Exps))
 	pcJmpToNextExp := -1
 
 	for i, exp := range node.Exps {
 		if pcJmpToNextExp >= 0 {
-			f.fixSbx(pcJmpToNextExp, f.pc() - pcJmpToNextExp)
+			f.fixSbx(pcJmpToNextExp, f.pc()-pcJmpToNextExp)
 		}
-		r := f.allocReg()
-		cgExp(f, exp, r, 1)
-		f.freeReg()
-
-		f.emitTest(r, 0);
-		pcJmpToNextExp = f.emitJmp(0, 0)
+		pcJmpToNextExp = cgCondJmp(f, exp, 0)
 
+		block := node.Blocks[i]
 		f.enterScope(false)
-		cgBlock(f, node.Blocks[i]);
-		f.closeOpenUpvals()
-		f.exitScope()
+		cgBlock(f, block)
+		f.closeOpenUpvals(block.LastLine)
+		f.exitScope(f.pc() + 1)
 
-		if i < len(node.Exps) - 1 {
-			pcJmpToEnds[i] = f.emitJmp(0, 0)
-		}else{
+		if i < len(node.Exps)-1 {
+			pcJmpToEnds[i] = f.emitJmp(block.LastLine, 0, 0)
+		} else {
 			pcJmpToEnds[i] = pcJmpToNextExp
 		}
 	}
 
 	for _, pc := range pcJmpToEnds {
-		f.fixSbx(pc, f.pc() - pc)
+		if pc >= 0 {
+			f.fixSbx(pc, f.pc()-pc)
+		}
 	}
 }
 
 //for Num Stat
-func cgForNumStat( f *funcInfo, node *ast.ForNumStat) {
+func cgForNumStat(f *funcInfo, node *ast.ForNumStat) {
 	f.enterScope(true)
 
 	cgLocalVarDeclStat(f, &ast.LocalVarDeclStat{
-		NameList : []string{"(for index)", "(for limit)", "(for step)"},
-		ExpList  : []ast.Exp{node.InitExp, node.LimitExp, node.StepExp},
+		LastLine: node.LineOfDo,
+		NameList: []string{"(for index)", "(for limit)", "(for step)"},
+		ExpList:  []ast.Exp{node.InitExp, node.LimitExp, node.StepExp},
 	})
 
-	f.addLocalVar(node.VarName)
+	f.addLocalVar(node.VarName, f.pc()+2)
 
 	a := f.useRegs - 4
-	pcForPrep := f.emitForPrep(a, 0)
+	pcForPrep := f.emitForPrep(node.LineOfDo, a, 0)
 	cgBlock(f, node.Block)
-	f.closeOpenUpvals()
-	pcForLoop := f.emitForLoop(a, 0)
+	f.closeOpenUpvals(node.Block.LastLine)
+	pcForLoop := f.emitForLoop(node.LineOfFor, a, 0)
 
-	f.fixSbx(pcForPrep, pcForLoop - pcForPrep - 1)
-	f.fixSbx(pcForLoop, pcForPrep - pcForLoop)
+	f.fixSbx(pcForPrep, pcForLoop-pcForPrep-1)
+	f.fixSbx(pcForLoop, pcForPrep-pcForLoop)
 
-	f.exitScope()
+	// 循环变量在FORLOOP之前结束，隐藏的变量包括FORLOOP
+	f.exitScope(f.pc())
+	f.fixEndPC("(for index)", 1)
+	f.fixEndPC("(for limit)", 1)
+	f.fixEndPC("(for step)", 1)
 }
 
 //For comm Stat
@@ -178,28 +239,32 @@ func cgForInStat(f *funcInfo, node *ast.ForInStat) {
 	f.enterScope(true)
 
 	cgLocalVarDeclStat(f, &ast.LocalVarDeclStat{
-		NameList : []string{"(for generator)", "(for state)", "(for control)"},
-		ExpList  : node.ExpList,
+		LastLine: lastLineOf(node.ExpList[len(node.ExpList)-1]),
+		NameList: []string{"(for generator)", "(for state)", "(for control)"},
+		ExpList:  node.ExpList,
 	})
 
-	for _,name := range node.NameList {
-		f.addLocalVar(name)
+	for _, name := range node.NameList {
+		f.addLocalVar(name, f.pc()+2)
 	}
 
-	pcJmpToTFC := f.emitJmp(0, 0)
+	pcJmpToTFC := f.emitJmp(node.LineOfDo, 0, 0)
 	cgBlock(f, node.Block)
-	f.closeOpenUpvals()
-	f.fixSbx(pcJmpToTFC, f.pc() - pcJmpToTFC)
+	f.closeOpenUpvals(node.Block.LastLine)
+	f.fixSbx(pcJmpToTFC, f.pc()-pcJmpToTFC)
 
+	line := lineOf(node.ExpList[0])
 	rGenerator := f.slotOfLocVar("(for generator)")
-	f.emitTForCall(rGenerator, len(node.NameList))
-	f.emitTForLoop(rGenerator+2, pcJmpToTFC-f.pc()-1)
-
-	f.exitScope()
+	f.emitTForCall(line, rGenerator, len(node.NameList))
+	f.emitTForLoop(line, rGenerator+2, pcJmpToTFC-f.pc()-1)
+
+	// 循环变量在TFORCALL之前结束，隐藏的变量包括TFORLOOP
+	f.exitScope(f.pc() - 1)
+	f.fixEndPC("(for generator)", 2)
+	f.fixEndPC("(for state)", 2)
+	f.fixEndPC("(for control)", 2)
 }
 
-
-
 func cgLocalVarDeclStat(f *funcInfo, node *ast.LocalVarDeclStat) {
 	nExps := len(node.ExpList)
 	nNames := len(node.NameList)
@@ -210,105 +275,177 @@ func cgLocalVarDeclStat(f *funcInfo, node *ast.LocalVarDeclStat) {
 			a := f.allocReg()
 			cgExp(f, exp, a, 1)
 		}
-	}else if nExps > nNames {
+	} else if nExps > nNames {
 		for i, exp := range node.ExpList {
 			a := f.allocReg()
-			if i == nExps - 1 && isVarargOrFuncCall(exp) {
+			if i == nExps-1 && isVarargOrFuncCall(exp) {
 				cgExp(f, exp, a, 0)
-			}else{
+			} else {
 				cgExp(f, exp, a, 1)
 			}
 		}
-	}else {
+	} else {
 		mulRet := false
 		for i, exp := range node.ExpList {
 			a := f.allocReg()
-			if i == nExps - 1 && isVarargOrFuncCall(exp) {
+			if i == nExps-1 && isVarargOrFuncCall(exp) {
 				mulRet = true
 				n := nNames - nExps + 1
 				cgExp(f, exp, a, n)
 				f.allocRegs(n - 1)
-			}else{
+			} else {
 				cgExp(f, exp, a, 1)
 			}
-			if !mulRet {
-				n := nNames - nExps
-				a := f.allocRegs(n)
-				f.emitLoadNil(a, n)
-			}
+		}
+		if !mulRet {
+			n := nNames - nExps
+			a := f.allocRegs(n)
+			f.emitLoadNil(node.LastLine, a, n)
 		}
 	}
 	f.useRegs = oldRegs
 	for _, name := range node.NameList {
-		f.addLocalVar(Name)
+		f.addLocalVar(name, f.pc()+1)
 	}
 }
 
 func cgAssignStat(f *funcInfo, node *ast.AssignStat) {
+	// 全局变量x就是_ENV.x
+	varList := make([]ast.Exp, len(node.VarList))
+	for i, exp := range node.VarList {
+		varList[i] = exp
+		if nameExp, ok := exp.(*ast.NameExp); ok {
+			if f.slotOfLocVar(nameExp.Name) < 0 && f.indexOfUpval(nameExp.Name) < 0 {
+				varList[i] = &ast.TableAccessExp{
+					LastLine:  nameExp.Line,
+					PrefixExp: &ast.NameExp{Line: nameExp.Line, Name: "_ENV"},
+					KeyExp:    &ast.StringExp{Line: nameExp.Line, Val: nameExp.Name},
+				}
+			}
+		}
+	}
+	if len(varList) == 1 && len(node.ExpList) == 1 {
+		cgSingleAssignStat(f, varList[0], node.ExpList[0], node.LastLine)
+		return
+	}
+
 	nExps := len(node.ExpList)
-	nVars := len(node.VarList)
+	nVars := len(varList)
 
 	oldRegs := f.useRegs
 	tRegs := make([]int, nVars)
+	tKinds := make([]int, nVars)
 	kRegs := make([]int, nVars)
 	vRegs := make([]int, nVars)
 
-	for i, exp := range node.VarList {
+	for i, exp := range varList {
 		if taExp, ok := exp.(*ast.TableAccessExp); ok {
-			tRegs[i] = f.allocReg()
-			cgExp(f, taExp.PrefixExp, tRegs[i], 1)
-			kRegs[i] = f.allocReg()
-			cgExp(f, taExp.KeyExps, kRegs[i], 1)
+			tRegs[i], tKinds[i] = exp2OpArg(f, taExp.PrefixExp, conflictKinds(varList, taExp.PrefixExp, ARG_RU))
+			kRegs[i], _ = exp2OpArg(f, taExp.KeyExp, conflictKinds(varList, taExp.KeyExp, ARG_RK))
 		}
 	}
 
-	for i:=0; i < nVars; i++ {
+	for i := 0; i < nVars; i++ {
 		vRegs[i] = f.useRegs + i
 	}
 
 	if nExps >= nVars {
 		for i, exp := range node.ExpList {
 			a := f.allocReg()
-			if i >= nVars && i == nRegs - 1 && isVarargOrFuncCall(exp) {
+			if i >= nVars && i == nExps-1 && isVarargOrFuncCall(exp) {
 				cgExp(f, exp, a, 0)
-			}else{
+			} else {
 				cgExp(f, exp, a, 1)
 			}
 		}
-	}else{
+	} else {
 		multRet := false
-		for i, exp := range exps {
+		for i, exp := range node.ExpList {
 			a := f.allocReg()
-			if i == nExps - 1 && isVarargOrFuncCall(exp) {
+			if i == nExps-1 && isVarargOrFuncCall(exp) {
 				multRet = true
 				n := nVars - nExps + 1
 				cgExp(f, exp, a, n)
-				f.allocRegs(n - i)
-			}else{
+				f.allocRegs(n - 1)
+			} else {
 				cgExp(f, exp, a, 1)
 			}
 		}
 		if !multRet {
 			n := nVars - nExps
 			a := f.allocRegs(n)
-			f.emitLoadNil(a, n)
+			f.emitLoadNil(node.LastLine, a, n)
 		}
 	}
-	for i, exp := range node.ExpList {
-		if nameExp, ok := exp.(*ast.NameExp); ok {
-			varName := nameExp.Name
-			if a:= f.slotOfLocVar(varName); a > 0 {
-				f.emitMove(a, vRegs[i])
-			}else if b := f.indexOfUpval(varName); b > 0 {
-				f.emitSetUpval(vRegs[i], b)
-			}else{
-				a := f.indexOfUpval("_Env")
-				b := 0x100 + f.indexOfConstant(varName)
-				f.emitSetTabUp(a, b, vRegs[i])
+
+	// 和luac一样从最后一个变量开始赋值
+	for i := nVars - 1; i >= 0; i-- {
+		if nameExp, ok := varList[i].(*ast.NameExp); ok {
+			if a := f.slotOfLocVar(nameExp.Name); a >= 0 {
+				f.emitMove(node.LastLine, a, vRegs[i])
+			} else {
+				f.emitSetUpval(node.LastLine, vRegs[i], f.indexOfUpval(nameExp.Name))
+			}
+		} else if tKinds[i] == ARG_UPVAL {
+			f.emitSetTabUp(node.LastLine, tRegs[i], kRegs[i], vRegs[i])
+		} else {
+			f.emitSetTable(node.LastLine, tRegs[i], kRegs[i], vRegs[i])
+		}
+	}
+	f.useRegs = oldRegs
+}
+
+// conflictKinds 多重赋值的左边给局部变量或者upvalue name赋值时，
+// 用name作表或者键的地方要先把它复制到临时寄存器里(和lparser.c的check_conflict一样)
+func conflictKinds(varList []ast.Exp, exp ast.Exp, argKinds int) int {
+	if nameExp, ok := exp.(*ast.NameExp); ok {
+		for _, v := range varList {
+			if target, ok := v.(*ast.NameExp); ok && target.Name == nameExp.Name {
+				return argKinds &^ ARG_RU
 			}
-		}else{
-			f.emitSetTable(tRegs[i], kRegs[i], vRegs[i])
+		}
+	}
+	return argKinds
+}
+
+// cgSingleAssignStat 只有一个变量时值直接用RK，或者直接算到局部变量的寄存器里
+func cgSingleAssignStat(f *funcInfo, varExp, exp ast.Exp, line int) {
+	oldRegs := f.useRegs
+	switch v := varExp.(type) {
+	case *ast.NameExp:
+		if a := f.slotOfLocVar(v.Name); a >= 0 {
+			if canTarget(exp) {
+				cgExp(f, exp, a, 1)
+			} else {
+				b := f.allocReg()
+				cgExp(f, exp, b, 1)
+				f.emitMove(line, a, b)
+			}
+		} else {
+			b, _ := exp2OpArg(f, exp, ARG_REG)
+			f.emitSetUpval(line, b, f.indexOfUpval(v.Name))
+		}
+	case *ast.TableAccessExp:
+		t, kindT := exp2OpArg(f, v.PrefixExp, ARG_RU)
+		k, _ := exp2OpArg(f, v.KeyExp, ARG_RK)
+		val, _ := exp2OpArg(f, exp, ARG_RK)
+		if kindT == ARG_UPVAL {
+			f.emitSetTabUp(line, t, k, val)
+		} else {
+			f.emitSetTable(line, t, k, val)
 		}
 	}
 	f.useRegs = oldRegs
-}
\ No newline at end of file
+}
+
+// canTarget 表达式能不能直接算到局部变量的寄存器里：函数调用和表构造器
+// 先往目标寄存器里写东西再读其他操作数，可能覆盖还要用到的这个局部变量
+func canTarget(exp ast.Exp) bool {
+	switch x := exp.(type) {
+	case *ast.FuncCallExp, *ast.TableConstructorExp:
+		return false
+	case *ast.ParensExp:
+		return canTarget(x.Exp)
+	}
+	return true
+}
@@ -2,22 +2,107 @@ package codegen
 
 import (
 	"go/compiler/ast"
-	"go/lexer"
+	"go/compiler/lexer"
 	"go/luavm"
 )
 
+// 操作数的种类，和lcode.c的luaK_exp2RK、luaK_exp2anyregup一样尽量不把操作数搬到临时寄存器里
+const (
+	ARG_CONST = 1 // 常量表里的下标，加上0x100就是RK
+	ARG_REG   = 2 // 局部变量或者临时变量所在的寄存器
+	ARG_UPVAL = 4 // upvalue的下标
+	ARG_RK    = ARG_REG | ARG_CONST
+	ARG_RU    = ARG_REG | ARG_UPVAL
+)
+
+// exp2OpArg 按argKinds允许的种类把表达式变成指令的操作数，都不行时求值到新分配的寄存器里；
+// 调用者负责在用完操作数后把useRegs恢复原状
+func exp2OpArg(f *funcInfo, node ast.Exp, argKinds int) (arg, argKind int) {
+	if argKinds&ARG_CONST > 0 {
+		if k, ok := constOf(node); ok {
+			if idx := f.indexOfConstant(k); idx <= 0xFF {
+				return 0x100 + idx, ARG_CONST
+			}
+		}
+	}
+	if nameExp, ok := node.(*ast.NameExp); ok {
+		if argKinds&ARG_REG > 0 {
+			if r := f.slotOfLocVar(nameExp.Name); r >= 0 {
+				return r, ARG_REG
+			}
+		}
+		if argKinds&ARG_UPVAL > 0 && f.slotOfLocVar(nameExp.Name) < 0 {
+			if idx := f.indexOfUpval(nameExp.Name); idx >= 0 {
+				return idx, ARG_UPVAL
+			}
+		}
+	}
+	a := f.allocReg()
+	cgExp(f, node, a, 1)
+	return a, ARG_REG
+}
+
+// constOf 可以放进常量表的字面量
+func constOf(node ast.Exp) (interface{}, bool) {
+	switch exp := node.(type) {
+	case *ast.NilExp:
+		return nil, true
+	case *ast.TrueExp:
+		return true, true
+	case *ast.FalseExp:
+		return false, true
+	case *ast.IntegerExp:
+		return exp.Val, true
+	case *ast.FloatExp:
+		return exp.Val, true
+	case *ast.StringExp:
+		return exp.Val, true
+	}
+	return nil, false
+}
+
 func cgExp(f *funcInfo, node ast.Exp, a, n int) {
 	switch exp := node.(type) {
+	case *ast.NilExp:
+		f.emitLoadNil(exp.Line, a, n)
+	case *ast.FalseExp:
+		f.emitLoadBool(exp.Line, a, 0, 0)
+	case *ast.TrueExp:
+		f.emitLoadBool(exp.Line, a, 1, 0)
+	case *ast.IntegerExp:
+		f.emitLoadK(exp.Line, a, exp.Val)
+	case *ast.FloatExp:
+		f.emitLoadK(exp.Line, a, exp.Val)
+	case *ast.StringExp:
+		f.emitLoadK(exp.Line, a, exp.Val)
+	case *ast.ParensExp:
+		cgExp(f, exp.Exp, a, 1)
 	case *ast.VarargExp:
-		cgVarargExp(f, node, a, n)
+		cgVarargExp(f, exp, a, n)
+	case *ast.FuncDefExp:
+		cgFuncDefExp(f, exp, a)
+	case *ast.TableConstructorExp:
+		cgTableConstructorExp(f, exp, a)
+	case *ast.UnopExp:
+		cgUnopExp(f, exp, a)
+	case *ast.BinopExp:
+		cgBinopExp(f, exp, a)
+	case *ast.ConcatExp:
+		cgConcatExp(f, exp, a)
+	case *ast.NameExp:
+		cgNameExp(f, exp, a)
+	case *ast.TableAccessExp:
+		cgTableAccessExp(f, exp, a)
+	case *ast.FuncCallExp:
+		cgFuncCallExp(f, exp, a, n)
 	}
 }
 
 func cgVarargExp(f *funcInfo, node *ast.VarargExp, a, n int) {
 	if !f.isVararg {
-		panic("can not use '...' outside a vararg function")
+		syntaxError(node.Line, "cannot use '...' outside a vararg function")
 	}
-	f.emitVararg(a, n)
+	f.emitVararg(node.Line, a, n)
 }
 
 func cgFuncDefExp(f *funcInfo, node *ast.FuncDefExp, a int) {
@@ -25,71 +110,75 @@ func cgFuncDefExp(f *funcInfo, node *ast.FuncDefExp, a int) {
 	f.subFuncs = append(f.subFuncs, subFI)
 
 	for _, param := range node.ParList {
-		subFI.addLocalVar(param)
+		subFI.addLocalVar(param, 0)
 	}
 
 	cgBlock(subFI, node.Block)
-	subFI.exitScope()
-	subFI.emitReturn(0, 0)
+	// 和luac一样，局部变量到最后的RETURN之后才结束
+	subFI.exitScope(subFI.pc() + 2)
+	subFI.emitReturn(node.LastLine, 0, 0)
 
 	bx := len(f.subFuncs) - 1
-	f.emitClosure(a, bx)
+	f.emitClosure(node.LastLine, a, bx)
 }
 
 func cgTableConstructorExp(f *funcInfo, node *ast.TableConstructorExp, a int) {
 	nArr := 0
 	for _, keyExp := range node.KeyExps {
 		if keyExp == nil {
-			nArr ++
+			nArr++
 		}
 	}
 
 	nExps := len(node.KeyExps)
-	mulRet := nExps > 0 && isVarargOrFuncCall(node.ValExps[nExps - 1])
+	mulRet := nExps > 0 && isVarargOrFuncCall(node.ValExps[nExps-1])
 
-	f.emitNewTable(a, nArr, nExps - nArr)
+	f.emitNewTable(node.Line, a, nArr, nExps-nArr)
 
 	arrIdx := 0
 
 	for i, keyExp := range node.KeyExps {
 		valExp := node.ValExps[i]
 		if keyExp == nil {
-			arrIdx ++
+			arrIdx++
 			tmp := f.allocReg()
-			if i == nExps - 1 && mulRet {
+			if i == nExps-1 && mulRet {
 				cgExp(f, valExp, tmp, -1)
-			}else{
+			} else {
 				cgExp(f, valExp, tmp, 1)
 			}
-			if arrIdx % 50 == 0 || arrIdx == nArr {
-				n := arrIdx % 50
+			if arrIdx%luavm.LFIELDS_PER_PLUSH == 0 || arrIdx == nArr {
+				n := arrIdx % luavm.LFIELDS_PER_PLUSH
 				if n == 0 {
-					n = 50
+					n = luavm.LFIELDS_PER_PLUSH
 				}
-				c := (arrIdx - 1) / 50 + 1
+				c := (arrIdx-1)/luavm.LFIELDS_PER_PLUSH + 1
 				f.freeRegs(n)
-				if i == nExps - 1 && mulRet {
-					f.emitSetList(a, 0, c)
-				}else{
-					f.emitSetList(a, n, c)
+				line := lastLineOf(valExp)
+				if arrIdx == nArr {
+					line = node.LastLine
+				}
+				if i == nExps-1 && mulRet {
+					f.emitSetList(line, a, 0, c)
+				} else {
+					f.emitSetList(line, a, n, c)
 				}
 			}
 			continue
 		}
-		b := f.allocReg()
-		cgExp(f, keyExp, b, 1)
-		c := f.allocReg()
-		cgExp(f, valExp, c, 1)
-		f.freeRegs(2)
-		f.emitSetTable(a, b, c)
+		oldRegs := f.useRegs
+		b, _ := exp2OpArg(f, keyExp, ARG_RK)
+		c, _ := exp2OpArg(f, valExp, ARG_RK)
+		f.useRegs = oldRegs
+		f.emitSetTable(lastLineOf(valExp), a, b, c)
 	}
 }
 
-func cgUnopExp(f *funcInfo, node *ast.UnopExp, a int){ 
-	b := f.allocReg()
-	cgExp(f, node.Exp, b, 1)
-	f.emitUnaryOp(node.Op, a, b)
-	f.freeReg()
+func cgUnopExp(f *funcInfo, node *ast.UnopExp, a int) {
+	oldRegs := f.useRegs
+	b, _ := exp2OpArg(f, node.Exp, ARG_REG)
+	f.emitUnaryOp(node.Line, node.Op, a, b)
+	f.useRegs = oldRegs
 }
 
 func cgConcatExp(f *funcInfo, node *ast.ConcatExp, a int) {
@@ -98,10 +187,10 @@ func cgConcatExp(f *funcInfo, node *ast.ConcatExp, a int) {
 		cgExp(f, exp, a, 1)
 	}
 
-	c := f.usedRegs - 1
+	c := f.useRegs - 1
 	b := c - len(node.Exps) + 1
 	f.freeRegs(c - b + 1)
-	f.emitABC(luavm.OP_CONCAT, a, b, c)
+	f.emitABC(node.Line, luavm.OP_CONCAT, a, b, c)
 }
 
 func cgBinopExp(f *funcInfo, node *ast.BinopExp, a int) {
@@ -110,55 +199,114 @@ func cgBinopExp(f *funcInfo, node *ast.BinopExp, a int) {
 		b := f.allocReg()
 		cgExp(f, node.Exp1, b, 1)
 		f.freeReg()
-		if node.Op == lexer.TOKEN_OP_ADD {
-			f.emitTestSet(a, b, 0)
-		}else{
-			f.emitTestSet(a, b, 1)
+		if node.Op == lexer.TOKEN_OP_AND {
+			f.emitTestSet(node.Line, a, b, 0)
+		} else {
+			f.emitTestSet(node.Line, a, b, 1)
 		}
-		pcOfJmp := f.emitJmp(0, 0)
+		pcOfJmp := f.emitJmp(node.Line, 0, 0)
 
-		b := f.allocReg()
+		b = f.allocReg()
 		cgExp(f, node.Exp2, b, 1)
 		f.freeReg()
 
-		f.emitMove(a, b)
-		f.fixSbx(pcOfJmp, f.pc() - pcOfJmp)
+		f.emitMove(node.Line, a, b)
+		f.fixSbx(pcOfJmp, f.pc()-pcOfJmp)
 	default:
-		b := f.allocReg()
-		cgExp(f, node.Exp1, b, 1)
-		c := f.allocReg()
-		cgExp(f, node.Exp2, c, 1)
-		f.emitBinaryOp(node.Op, a, b, c)
-		f.freeRegs(2)
+		oldRegs := f.useRegs
+		b, _ := exp2OpArg(f, node.Exp1, ARG_RK)
+		c, _ := exp2OpArg(f, node.Exp2, ARG_RK)
+		f.emitBinaryOp(node.Line, node.Op, a, b, c)
+		f.useRegs = oldRegs
 	}
 }
 
+// cgCondJmp 和lcode.c的luaK_goiftrue一样：条件成立时接着往下执行，不成立时跳走。
+// 返回跳转指令的pc，由调用者修正sBx；条件是恒为真的常量时不生成代码，返回-1
+func cgCondJmp(f *funcInfo, node ast.Exp, jmpA int) int {
+	line := lastLineOf(node)
+	switch exp := node.(type) {
+	case *ast.TrueExp, *ast.IntegerExp, *ast.FloatExp, *ast.StringExp:
+		return -1
+	case *ast.ParensExp:
+		return cgCondJmp(f, exp.Exp, jmpA)
+	case *ast.BinopExp:
+		if opcode, swap, ok := compareOp(exp.Op); ok {
+			oldRegs := f.useRegs
+			b, _ := exp2OpArg(f, exp.Exp1, ARG_RK)
+			c, _ := exp2OpArg(f, exp.Exp2, ARG_RK)
+			f.useRegs = oldRegs
+			if swap {
+				b, c = c, b
+			}
+			a := 0 // 比较的结果和a不同时跳过后面的JMP
+			if exp.Op == lexer.TOKEN_OP_NE {
+				a = 1
+			}
+			f.emitABC(line, opcode, a, b, c)
+			return f.emitJmp(line, jmpA, 0)
+		}
+	}
+	oldRegs := f.useRegs
+	r, _ := exp2OpArg(f, node, ARG_REG)
+	f.useRegs = oldRegs
+	f.emitTest(line, r, 0)
+	return f.emitJmp(line, jmpA, 0)
+}
+
+// compareOp 比较运算对应的指令，>和>=交换操作数后用LT和LE
+func compareOp(op int) (opcode int, swap, ok bool) {
+	switch op {
+	case lexer.TOKEN_OP_EQ, lexer.TOKEN_OP_NE:
+		return luavm.OP_EQ, false, true
+	case lexer.TOKEN_OP_LT:
+		return luavm.OP_LT, false, true
+	case lexer.TOKEN_OP_GT:
+		return luavm.OP_LT, true, true
+	case lexer.TOKEN_OP_LE:
+		return luavm.OP_LE, false, true
+	case lexer.TOKEN_OP_GE:
+		return luavm.OP_LE, true, true
+	}
+	return 0, false, false
+}
+
 func cgNameExp(f *funcInfo, node *ast.NameExp, a int) {
 	if r := f.slotOfLocVar(node.Name); r >= 0 {
-		f.emitMove(a, r)
-	}else if idx := f.indexOfUpval(node.Name); idx >= 0 {
-		f.emitGetUpval(a, idx)
-	}else{
-		taExp := &TableAccessExp {
-			PrefixExp : &NameExp{0, "_Env"},
-			KeyExp: &StringExp{0, node.Name},
+		f.emitMove(node.Line, a, r)
+	} else if idx := f.indexOfUpval(node.Name); idx >= 0 {
+		f.emitGetUpval(node.Line, a, idx)
+	} else {
+		taExp := &ast.TableAccessExp{
+			LastLine:  node.Line,
+			PrefixExp: &ast.NameExp{Line: node.Line, Name: "_ENV"},
+			KeyExp:    &ast.StringExp{Line: node.Line, Val: node.Name},
 		}
 		cgTableAccessExp(f, taExp, a)
 	}
 }
 
+// cgTableAccessExp 表是upvalue(比如全局变量的_ENV)时用GETTABUP，键是常量时用RK
 func cgTableAccessExp(f *funcInfo, node *ast.TableAccessExp, a int) {
-	b := f.allocReg()
-	cgExp(f, node.PrefixExp, b, 1)
-	c := f.allocReg()
-	cgExp(f, node.KeyExp, c, 1)
-	f.emitGetTable(a, b, c)
-	f.freeRegs(2)
+	oldRegs := f.useRegs
+	b, kindB := exp2OpArg(f, node.PrefixExp, ARG_RU)
+	c, _ := exp2OpArg(f, node.KeyExp, ARG_RK)
+	f.useRegs = oldRegs
+	if kindB == ARG_UPVAL {
+		f.emitGetTabUp(node.LastLine, a, b, c)
+	} else {
+		f.emitGetTable(node.LastLine, a, b, c)
+	}
+}
+
+func cgFuncCallExp(f *funcInfo, node *ast.FuncCallExp, a, n int) {
+	nArgs := prepFuncCall(f, node, a)
+	f.emitCall(node.Line, a, nArgs, n)
 }
 
-func cgFuncCallExp(f *funcInfo, node *ast.FuncCallExp, a, n int){
+func cgTailCallExp(f *funcInfo, node *ast.FuncCallExp, a int) {
 	nArgs := prepFuncCall(f, node, a)
-	f.emitCall(a, nArgs, n)
+	f.emitTailCall(node.Line, a, nArgs)
 }
 
 func prepFuncCall(f *funcInfo, node *ast.FuncCallExp, a int) int {
@@ -168,26 +316,96 @@ func prepFuncCall(f *funcInfo, node *ast.FuncCallExp, a int) int {
 	cgExp(f, node.PrefixExp, a, 1)
 
 	if node.NameExp != nil {
-		c := 0x100 + f.indexOfConstant(node.NameExp.Str)
-		f.emitSelf(a, a, c)
+		f.allocReg()
+		if idx := f.indexOfConstant(node.NameExp.Val); idx <= 0xFF {
+			f.emitSelf(node.Line, a, a, 0x100+idx)
+		} else {
+			c := f.allocReg()
+			f.emitLoadK(node.Line, c, node.NameExp.Val)
+			f.emitSelf(node.Line, a, a, c)
+			f.freeReg()
+		}
 	}
 
 	for i, arg := range node.Args {
 		tmp := f.allocReg()
-		if i == nArgs - 1 && isVarargOrFuncCall(arg) {
+		if i == nArgs-1 && isVarargOrFuncCall(arg) {
 			lastArgVarargOrFuncCall = true
 			cgExp(f, arg, tmp, -1)
-		}else{
+		} else {
 			cgExp(f, arg, tmp, 1)
 		}
 	}
 	f.freeRegs(nArgs)
 
 	if node.NameExp != nil {
+		f.freeReg()
 		nArgs++
 	}
 	if lastArgVarargOrFuncCall {
 		nArgs = -1
 	}
 	return nArgs
-}
\ No newline at end of file
+}
+
+// lastLineOf 表达式最后一个token所在的行，luac在这一行生成把表达式的值存起来的指令
+func lastLineOf(exp ast.Exp) int {
+	switch x := exp.(type) {
+	case *ast.NilExp:
+		return x.Line
+	case *ast.TrueExp:
+		return x.Line
+	case *ast.FalseExp:
+		return x.Line
+	case *ast.IntegerExp:
+		return x.Line
+	case *ast.FloatExp:
+		return x.Line
+	case *ast.StringExp:
+		return x.Line
+	case *ast.VarargExp:
+		return x.Line
+	case *ast.NameExp:
+		return x.Line
+	case *ast.FuncDefExp:
+		return x.LastLine
+	case *ast.TableConstructorExp:
+		return x.LastLine
+	case *ast.TableAccessExp:
+		return x.LastLine
+	case *ast.FuncCallExp:
+		return x.LastLine
+	case *ast.ParensExp:
+		return lastLineOf(x.Exp)
+	case *ast.UnopExp:
+		return lastLineOf(x.Exp)
+	case *ast.BinopExp:
+		return lastLineOf(x.Exp2)
+	case *ast.ConcatExp:
+		return lastLineOf(x.Exps[len(x.Exps)-1])
+	}
+	return 0
+}
+
+// lineOf 表达式第一个token所在的行
+func lineOf(exp ast.Exp) int {
+	switch x := exp.(type) {
+	case *ast.TableAccessExp:
+		return lineOf(x.PrefixExp)
+	case *ast.FuncCallExp:
+		return lineOf(x.PrefixExp)
+	case *ast.ParensExp:
+		return lineOf(x.Exp)
+	case *ast.BinopExp:
+		return lineOf(x.Exp1)
+	case *ast.ConcatExp:
+		return lineOf(x.Exps[0])
+	case *ast.UnopExp:
+		return x.Line
+	case *ast.TableConstructorExp:
+		return x.Line
+	case *ast.FuncDefExp:
+		return x.Line
+	}
+	return lastLineOf(exp)
+}
@@ -0,0 +1,96 @@
+package codegen
+
+import (
+	"go/binchunk"
+	"go/compiler/ast"
+)
+
+//GenProto 把整个chunk当作一个变长参数的main函数来编译
+func GenProto(chunk *ast.Block) *binchunk.Prototype {
+	fd := &ast.FuncDefExp{
+		LastLine: chunk.LastLine,
+		IsVararg: true,
+		Block:    chunk,
+	}
+	f := newFuncInfo(nil, fd)
+	f.addLocalVar("_ENV", 0)
+	cgFuncDefExp(f, fd, 0)
+	main := f.subFuncs[0]
+	// 和luac一样，main函数的upvalue 0总是_ENV，即使chunk里没有用到全局变量
+	main.indexOfUpval("_ENV")
+	return toProto(main)
+}
+
+func toProto(f *funcInfo) *binchunk.Prototype {
+	proto := &binchunk.Prototype{
+		LineDefine:      uint32(f.line),
+		LastLineDefined: uint32(f.lastLine),
+		NumParams:       byte(f.numParams),
+		MaxStatckSize:   byte(f.maxRegs),
+		Code:            f.insts,
+		Constants:       getConstants(f),
+		Upvalues:        getUpvalues(f),
+		Protos:          toProtos(f.subFuncs),
+		LineInfo:        f.lineNums,
+		LocVars:         getLocVars(f),
+		UpvalueNames:    getUpvalueNames(f),
+	}
+	if f.line == 0 {
+		proto.LastLineDefined = 0
+	}
+	if proto.MaxStatckSize < 2 {
+		proto.MaxStatckSize = 2
+	}
+	if f.isVararg {
+		proto.IsVarargs = 1
+	}
+	return proto
+}
+
+func toProtos(fs []*funcInfo) []*binchunk.Prototype {
+	protos := make([]*binchunk.Prototype, len(fs))
+	for i, f := range fs {
+		protos[i] = toProto(f)
+	}
+	return protos
+}
+
+func getConstants(f *funcInfo) []interface{} {
+	consts := make([]interface{}, len(f.constants))
+	for k, idx := range f.constants {
+		consts[idx] = k
+	}
+	return consts
+}
+
+func getUpvalues(f *funcInfo) []binchunk.Upvalue {
+	upvals := make([]binchunk.Upvalue, len(f.upvalues))
+	for _, uv := range f.upvalues {
+		if uv.locVarSlot >= 0 { // 捕获的是外层函数的局部变量
+			upvals[uv.index] = binchunk.Upvalue{Instatck: 1, Idx: byte(uv.locVarSlot)}
+		} else {
+			upvals[uv.index] = binchunk.Upvalue{Instatck: 0, Idx: byte(uv.upvalIndex)}
+		}
+	}
+	return upvals
+}
+
+func getLocVars(f *funcInfo) []binchunk.LocVar {
+	locVars := make([]binchunk.LocVar, len(f.locVars))
+	for i, locVar := range f.locVars {
+		locVars[i] = binchunk.LocVar{
+			VarName: locVar.name,
+			StartPC: uint32(locVar.startPC),
+			EndPC:   uint32(locVar.endPC),
+		}
+	}
+	return locVars
+}
+
+func getUpvalueNames(f *funcInfo) []string {
+	names := make([]string, len(f.upvalues))
+	for name, uv := range f.upvalues {
+		names[uv.index] = name
+	}
+	return names
+}
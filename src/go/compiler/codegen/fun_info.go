@@ -1,8 +1,10 @@
 package codegen
 
 import (
+	"fmt"
+	"go/compiler/ast"
+	"go/compiler/lexer"
 	"go/luavm"
-	"go/lexer"
 )
 
 var arithAndBitwiseBinops = map[int]int{
@@ -26,7 +28,30 @@ type localVarInfo struct {
 	scopeLv  int
 	slot     int
 	captured bool
-	endPC 	 int
+	startPC  int
+	endPC    int
+}
+
+type labelInfo struct {
+	name    string
+	line    int
+	pc      int
+	nactvar int
+}
+
+type gotoInfo struct {
+	name    string
+	line    int
+	pc      int
+	nactvar int
+}
+
+// labelScope 记录一个block里定义的label和还没找到label的goto
+type labelScope struct {
+	nactvar     int
+	untilFollow bool
+	labels      []*labelInfo
+	gotos       []*gotoInfo
 }
 
 type upvalInfo struct {
@@ -43,9 +68,11 @@ type funcInfo struct {
 	locVars   []*localVarInfo
 	locNames  map[string]*localVarInfo
 	breaks    [][]int
+	labels    []*labelScope
 	parent    *funcInfo
 	upvalues  map[string]upvalInfo
 	insts     []uint32
+	lineNums  []uint32 //每条指令对应的行号
 	line      int
 	lastLine  int
 	numParams int
@@ -53,7 +80,12 @@ type funcInfo struct {
 	subFuncs  []*funcInfo
 }
 
-func newFuncInfo(parent *funcInfo, fd *FuncDefExp) *funcInfo {
+// syntaxError 代码生成阶段发现的错误也是语法错误，chunk名字由compiler补上
+func syntaxError(line int, f string, a ...interface{}) {
+	panic(&lexer.SyntaxError{Line: line, Msg: fmt.Sprintf(f, a...)})
+}
+
+func newFuncInfo(parent *funcInfo, fd *ast.FuncDefExp) *funcInfo {
 	return &funcInfo{
 		parent:    parent,
 		subFuncs:  []*funcInfo{},
@@ -62,13 +94,16 @@ func newFuncInfo(parent *funcInfo, fd *FuncDefExp) *funcInfo {
 		upvalues:  map[string]upvalInfo{},
 		constants: map[interface{}]int{},
 		breaks:    make([][]int, 1),
+		labels:    []*labelScope{{}},
 		insts:     make([]uint32, 0, 8),
+		lineNums:  make([]uint32, 0, 8),
+		line:      fd.Line,
+		lastLine:  fd.LastLine,
 		numParams: len(fd.ParList),
 		isVararg:  fd.IsVararg,
 	}
 }
 
-
 func (f *funcInfo) indexOfConstant(k interface{}) int {
 	if idx, ok := f.constants[k]; ok {
 		return idx
@@ -81,7 +116,7 @@ func (f *funcInfo) indexOfConstant(k interface{}) int {
 func (f *funcInfo) allocReg() int {
 	f.useRegs++
 	if f.useRegs >= 255 {
-		panic("function or expression need to much regs!")
+		syntaxError(f.line, "function or expression needs too many registers")
 	}
 	if f.useRegs > f.maxRegs {
 		f.maxRegs = f.useRegs
@@ -113,14 +148,17 @@ func (f *funcInfo) enterScope(breakable bool) {
 	} else {
 		f.breaks = append(f.breaks, nil)
 	}
+	f.labels = append(f.labels, &labelScope{nactvar: f.useRegs})
 }
 
-func (f *funcInfo) addLocalVar(name string) int {
+//addLocalVar 变量从startPC开始可见
+func (f *funcInfo) addLocalVar(name string, startPC int) int {
 	newVar := &localVarInfo{
 		name:    name,
 		pre:     f.locNames[name],
 		scopeLv: f.scopeLv,
 		slot:    f.allocReg(),
+		startPC: startPC,
 	}
 	f.locVars = append(f.locVars, newVar)
 	f.locNames[name] = newVar
@@ -134,9 +172,9 @@ func (f *funcInfo) slotOfLocVar(name string) int {
 	return -1
 }
 
-func (f *funcInfo) exitScope() {
-
-	//TODO 没理解咋回事
+//exitScope 本层的局部变量到endPC为止都可见(不包括endPC)
+func (f *funcInfo) exitScope(endPC int) {
+	// break 要跳到循环后面，跳出时顺便关闭本层被捕获的局部变量
 	pendingBreakJmps := f.breaks[len(f.breaks)-1]
 	f.breaks = f.breaks[:len(f.breaks)-1]
 
@@ -147,32 +185,142 @@ func (f *funcInfo) exitScope() {
 		f.insts[pc] = uint32(i)
 	}
 
+	f.moveGotosOut()
+
 	f.scopeLv--
 	for _, locVar := range f.locNames {
 		if locVar.scopeLv > f.scopeLv {
-			f.removeLocVar(locVar)
+			f.removeLocVar(locVar, endPC)
 		}
 	}
 }
 
-func (f *funcInfo) removeLocVar(locVar *localVarInfo) {
+func (f *funcInfo) removeLocVar(locVar *localVarInfo, endPC int) {
 	f.freeReg()
+	locVar.endPC = endPC
 	if locVar.pre == nil {
 		delete(f.locNames, locVar.name)
 	} else if locVar.pre.scopeLv == locVar.scopeLv {
-		f.removeLocVar(locVar.pre)
+		f.removeLocVar(locVar.pre, endPC)
 	} else {
 		f.locNames[locVar.name] = locVar.pre
 	}
 }
 
-func (f *funcInfo) addBreakJmp(pc int) {
+func (f *funcInfo) addBreakJmp(pc, line int) {
 	for i := f.scopeLv; i >= 0; i-- {
 		if f.breaks[i] != nil {
 			f.breaks[i] = append(f.breaks[i], pc)
+			return
+		}
+	}
+	syntaxError(line, "<break> at line %d not inside a loop", line)
+}
+
+// addLabel 和lua 5.3的checkrepeated一样只检查当前block里的label，内层block可以再定义同名的label
+func (f *funcInfo) addLabel(name string, line int, atEnd bool) {
+	scope := f.labels[len(f.labels)-1]
+	for _, label := range scope.labels {
+		if label.name == name {
+			syntaxError(line, "label '%s' already defined on line %d", name, label.line)
+		}
+	}
+
+	label := &labelInfo{name: name, line: line, pc: f.pc() + 1, nactvar: f.useRegs}
+	// block末尾的label(后面只有空语句)不在本block局部变量的作用域里
+	if atEnd && !scope.untilFollow {
+		label.nactvar = scope.nactvar
+	}
+	scope.labels = append(scope.labels, label)
+
+	gotos := scope.gotos[:0]
+	for _, gt := range scope.gotos {
+		if gt.name == name {
+			f.closeGoto(gt, label)
+		} else {
+			gotos = append(gotos, gt)
+		}
+	}
+	scope.gotos = gotos
+}
+
+func (f *funcInfo) addGoto(name string, line, pc int) {
+	gt := &gotoInfo{name: name, line: line, pc: pc, nactvar: f.useRegs}
+	scope := f.labels[len(f.labels)-1]
+	if !f.findLabel(scope, gt) {
+		scope.gotos = append(scope.gotos, gt)
+	}
+}
+
+// findLabel 在已经定义的label里找goto的目标，往回跳时顺便关闭中间被捕获的局部变量
+func (f *funcInfo) findLabel(scope *labelScope, gt *gotoInfo) bool {
+	for _, label := range scope.labels {
+		if label.name == gt.name {
+			if gt.nactvar > label.nactvar && f.hasCapturedLocVar(label.nactvar) {
+				f.fixA(gt.pc, label.nactvar+1)
+			}
+			f.closeGoto(gt, label)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *funcInfo) closeGoto(gt *gotoInfo, label *labelInfo) {
+	if gt.nactvar < label.nactvar {
+		syntaxError(gt.line, "<goto %s> at line %d jumps into the scope of local '%s'",
+			gt.name, gt.line, f.nameOfLocVar(gt.nactvar))
+	}
+	f.fixSbx(gt.pc, label.pc-gt.pc-1)
+}
+
+// moveGotosOut 离开block时把没找到label的goto交给外层block
+func (f *funcInfo) moveGotosOut() {
+	scope := f.labels[len(f.labels)-1]
+	f.labels = f.labels[:len(f.labels)-1]
+	if len(f.labels) == 0 {
+		if len(scope.gotos) > 0 {
+			gt := scope.gotos[0]
+			syntaxError(gt.line, "no visible label '%s' for <goto> at line %d", gt.name, gt.line)
+		}
+		return
+	}
+
+	upval := f.hasCapturedLocVar(scope.nactvar)
+	outer := f.labels[len(f.labels)-1]
+	for _, gt := range scope.gotos {
+		if gt.nactvar > scope.nactvar {
+			if upval {
+				f.fixA(gt.pc, scope.nactvar+1)
+			}
+			gt.nactvar = scope.nactvar
+		}
+		if !f.findLabel(outer, gt) {
+			outer.gotos = append(outer.gotos, gt)
+		}
+	}
+}
+
+func (f *funcInfo) hasCapturedLocVar(minSlot int) bool {
+	for _, locVar := range f.locNames {
+		for v := locVar; v != nil; v = v.pre {
+			if v.captured && v.slot >= minSlot {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *funcInfo) nameOfLocVar(slot int) string {
+	for _, locVar := range f.locNames {
+		for v := locVar; v != nil; v = v.pre {
+			if v.slot == slot {
+				return v.name
+			}
 		}
 	}
-	panic("<breaks> at line ? not inside a loop")
+	return "?"
 }
 
 func (f *funcInfo) indexOfUpval(name string) int {
@@ -204,12 +352,19 @@ func (f *funcInfo) pc() int {
 
 func (f *funcInfo) fixSbx(pc, sBx int) {
 	i := f.insts[pc]
-	i = i << 18 >> 18                  // clear sBx
+	i = i << 18 >> 18                        // clear sBx
 	i = i | uint32(sBx+luavm.MAXARG_sBx)<<14 // reset sBx
 	f.insts[pc] = i
 }
 
-// todo: rename?
+func (f *funcInfo) fixA(pc, a int) {
+	i := f.insts[pc]
+	i = i &^ (0xFF << 6) // clear A
+	i = i | uint32(a)<<6 // reset A
+	f.insts[pc] = i
+}
+
+// fixEndPC 调整最近声明的名字为name的局部变量的endPC
 func (f *funcInfo) fixEndPC(name string, delta int) {
 	for i := len(f.locVars) - 1; i >= 0; i-- {
 		locVar := f.locVars[i]
@@ -220,198 +375,206 @@ func (f *funcInfo) fixEndPC(name string, delta int) {
 	}
 }
 
-func (f *funcInfo) emitABC(opcode, a, b, c int) {
+func (f *funcInfo) emitABC(line, opcode, a, b, c int) {
 	i := b<<23 | c<<14 | a<<6 | opcode
 	f.insts = append(f.insts, uint32(i))
+	f.lineNums = append(f.lineNums, uint32(line))
 }
 
-func (f *funcInfo) emitABx(opcode, a, bx int) {
+func (f *funcInfo) emitABx(line, opcode, a, bx int) {
 	i := bx<<14 | a<<6 | opcode
 	f.insts = append(f.insts, uint32(i))
+	f.lineNums = append(f.lineNums, uint32(line))
 }
 
-func (f *funcInfo) emitAsBx(opcode, a, b int) {
+func (f *funcInfo) emitAsBx(line, opcode, a, b int) {
 	i := (b+luavm.MAXARG_sBx)<<14 | a<<6 | opcode
 	f.insts = append(f.insts, uint32(i))
+	f.lineNums = append(f.lineNums, uint32(line))
 }
 
-func (f *funcInfo) emitAx(opcode, ax int) {
+func (f *funcInfo) emitAx(line, opcode, ax int) {
 	i := ax<<6 | opcode
 	f.insts = append(f.insts, uint32(i))
+	f.lineNums = append(f.lineNums, uint32(line))
 }
 
 // r[a] = r[b]
-func (f *funcInfo) emitMove( a, b int) {
-	f.emitABC( luavm.OP_MOVE, a, b, 0)
+func (f *funcInfo) emitMove(line, a, b int) {
+	f.emitABC(line, luavm.OP_MOVE, a, b, 0)
 }
 
 // r[a], r[a+1], ..., r[a+b] = nil
-func (f *funcInfo) emitLoadNil( a, n int) {
-	f.emitABC( luavm.OP_LOADNIL, a, n-1, 0)
+func (f *funcInfo) emitLoadNil(line, a, n int) {
+	f.emitABC(line, luavm.OP_LOADNIL, a, n-1, 0)
 }
 
 // r[a] = (bool)b; if (c) pc++
-func (f *funcInfo) emitLoadBool( a, b, c int) {
-	f.emitABC( luavm.OP_LOADBOOL, a, b, c)
+func (f *funcInfo) emitLoadBool(line, a, b, c int) {
+	f.emitABC(line, luavm.OP_LOADBOOL, a, b, c)
 }
 
 // r[a] = kst[bx]
-func (f *funcInfo) emitLoadK( a int, k interface{}) {
+func (f *funcInfo) emitLoadK(line, a int, k interface{}) {
 	idx := f.indexOfConstant(k)
 	if idx < (1 << 18) {
-		f.emitABx( luavm.OP_LOADK, a, idx)
+		f.emitABx(line, luavm.OP_LOADK, a, idx)
 	} else {
-		f.emitABx( luavm.OP_LOADKX, a, 0)
-		f.emitAx( luavm.OP_EXTRAARG, idx)
+		f.emitABx(line, luavm.OP_LOADKX, a, 0)
+		f.emitAx(line, luavm.OP_EXTRAARG, idx)
 	}
 }
 
 // r[a], r[a+1], ..., r[a+b-2] = vararg
-func (f *funcInfo) emitVararg( a, n int) {
-	f.emitABC( luavm.OP_VARARG, a, n+1, 0)
+func (f *funcInfo) emitVararg(line, a, n int) {
+	f.emitABC(line, luavm.OP_VARARG, a, n+1, 0)
 }
 
 // r[a] = emitClosure(proto[bx])
-func (f *funcInfo) emitClosure( a, bx int) {
-	f.emitABx( luavm.OP_CLOSURE, a, bx)
+func (f *funcInfo) emitClosure(line, a, bx int) {
+	f.emitABx(line, luavm.OP_CLOSURE, a, bx)
 }
 
 // r[a] = {}
-func (f *funcInfo) emitNewTable( a, nArr, nRec int) {
-	f.emitABC( luavm.OP_NEWTABLE,
+func (f *funcInfo) emitNewTable(line, a, nArr, nRec int) {
+	f.emitABC(line, luavm.OP_NEWTABLE,
 		a, luavm.Int2fb(nArr), luavm.Int2fb(nRec))
 }
 
 // r[a][(c-1)*FPF+i] := r[a+i], 1 <= i <= b
-func (f *funcInfo) emitSetList( a, b, c int) {
-	f.emitABC( luavm.OP_SETLIST, a, b, c)
+func (f *funcInfo) emitSetList(line, a, b, c int) {
+	if c <= 0x1FF {
+		f.emitABC(line, luavm.OP_SETLIST, a, b, c)
+	} else {
+		f.emitABC(line, luavm.OP_SETLIST, a, b, 0)
+		f.emitAx(line, luavm.OP_EXTRAARG, c-1)
+	}
 }
 
 // r[a] := r[b][rk(c)]
-func (f *funcInfo) emitGetTable( a, b, c int) {
-	f.emitABC( luavm.OP_GETTABLE, a, b, c)
+func (f *funcInfo) emitGetTable(line, a, b, c int) {
+	f.emitABC(line, luavm.OP_GETTABLE, a, b, c)
 }
 
 // r[a][rk(b)] = rk(c)
-func (f *funcInfo) emitSetTable( a, b, c int) {
-	f.emitABC( luavm.OP_SETTABLE, a, b, c)
+func (f *funcInfo) emitSetTable(line, a, b, c int) {
+	f.emitABC(line, luavm.OP_SETTABLE, a, b, c)
 }
 
 // r[a] = upval[b]
-func (f *funcInfo) emitGetUpval( a, b int) {
-	f.emitABC( luavm.OP_GETUPVAL, a, b, 0)
+func (f *funcInfo) emitGetUpval(line, a, b int) {
+	f.emitABC(line, luavm.OP_GETUPVAL, a, b, 0)
 }
 
 // upval[b] = r[a]
-func (f *funcInfo) emitSetUpval( a, b int) {
-	f.emitABC( luavm.OP_SETUPVAL, a, b, 0)
+func (f *funcInfo) emitSetUpval(line, a, b int) {
+	f.emitABC(line, luavm.OP_SETUPVAL, a, b, 0)
 }
 
 // r[a] = upval[b][rk(c)]
-func (f *funcInfo) emitGetTabUp( a, b, c int) {
-	f.emitABC( luavm.OP_GETTABUP, a, b, c)
+func (f *funcInfo) emitGetTabUp(line, a, b, c int) {
+	f.emitABC(line, luavm.OP_GETTABUP, a, b, c)
 }
 
 // upval[a][rk(b)] = rk(c)
-func (f *funcInfo) emitSetTabUp( a, b, c int) {
-	f.emitABC( luavm.OP_SETTABUP, a, b, c)
+func (f *funcInfo) emitSetTabUp(line, a, b, c int) {
+	f.emitABC(line, luavm.OP_SETTABUP, a, b, c)
 }
 
 // r[a], ..., r[a+c-2] = r[a](r[a+1], ..., r[a+b-1])
-func (f *funcInfo) emitCall( a, nArgs, nRet int) {
-	f.emitABC( luavm.OP_CALL, a, nArgs+1, nRet+1)
+func (f *funcInfo) emitCall(line, a, nArgs, nRet int) {
+	f.emitABC(line, luavm.OP_CALL, a, nArgs+1, nRet+1)
 }
 
 // return r[a](r[a+1], ... ,r[a+b-1])
-func (f *funcInfo) emitTailCall( a, nArgs int) {
-	f.emitABC( luavm.OP_TAILCALL, a, nArgs+1, 0)
+func (f *funcInfo) emitTailCall(line, a, nArgs int) {
+	f.emitABC(line, luavm.OP_TAILCALL, a, nArgs+1, 0)
 }
 
 // return r[a], ... ,r[a+b-2]
-func (f *funcInfo) emitReturn( a, n int) {
-	f.emitABC( luavm.OP_RETURN, a, n+1, 0)
+func (f *funcInfo) emitReturn(line, a, n int) {
+	f.emitABC(line, luavm.OP_RETURN, a, n+1, 0)
 }
 
 // r[a+1] := r[b]; r[a] := r[b][rk(c)]
-func (f *funcInfo) emitSelf( a, b, c int) {
-	f.emitABC( luavm.OP_SELF, a, b, c)
+func (f *funcInfo) emitSelf(line, a, b, c int) {
+	f.emitABC(line, luavm.OP_SELF, a, b, c)
 }
 
 // pc+=sBx; if (a) close all upvalues >= r[a - 1]
-func (f *funcInfo) emitJmp( a, sBx int) int {
-	f.emitAsBx( luavm.OP_JMP, a, sBx)
+func (f *funcInfo) emitJmp(line, a, sBx int) int {
+	f.emitAsBx(line, luavm.OP_JMP, a, sBx)
 	return len(f.insts) - 1
 }
 
 // if not (r[a] <=> c) then pc++
-func (f *funcInfo) emitTest( a, c int) {
-	f.emitABC( luavm.OP_TEST, a, 0, c)
+func (f *funcInfo) emitTest(line, a, c int) {
+	f.emitABC(line, luavm.OP_TEST, a, 0, c)
 }
 
 // if (r[b] <=> c) then r[a] := r[b] else pc++
-func (f *funcInfo) emitTestSet( a, b, c int) {
-	f.emitABC( luavm.OP_TESTSET, a, b, c)
+func (f *funcInfo) emitTestSet(line, a, b, c int) {
+	f.emitABC(line, luavm.OP_TESTSET, a, b, c)
 }
 
-func (f *funcInfo) emitForPrep( a, sBx int) int {
-	f.emitAsBx( luavm.OP_FORPREP, a, sBx)
+func (f *funcInfo) emitForPrep(line, a, sBx int) int {
+	f.emitAsBx(line, luavm.OP_FORPREP, a, sBx)
 	return len(f.insts) - 1
 }
 
-func (f *funcInfo) emitForLoop( a, sBx int) int {
-	f.emitAsBx( luavm.OP_FORLOOP, a, sBx)
+func (f *funcInfo) emitForLoop(line, a, sBx int) int {
+	f.emitAsBx(line, luavm.OP_FORLOOP, a, sBx)
 	return len(f.insts) - 1
 }
 
-func (f *funcInfo) emitTForCall( a, c int) {
-	f.emitABC( luavm.OP_TFORCALL, a, 0, c)
+func (f *funcInfo) emitTForCall(line, a, c int) {
+	f.emitABC(line, luavm.OP_TFORCALL, a, 0, c)
 }
 
-func (f *funcInfo) emitTForLoop( a, sBx int) {
-	f.emitAsBx( luavm.OP_TFORLOOP, a, sBx)
+func (f *funcInfo) emitTForLoop(line, a, sBx int) {
+	f.emitAsBx(line, luavm.OP_TFORLOOP, a, sBx)
 }
 
 // r[a] = op r[b]
-func (f *funcInfo) emitUnaryOp( op, a, b int) {
+func (f *funcInfo) emitUnaryOp(line, op, a, b int) {
 	switch op {
 	case lexer.TOKEN_OP_NOT:
-		f.emitABC( luavm.OP_NOT, a, b, 0)
+		f.emitABC(line, luavm.OP_NOT, a, b, 0)
 	case lexer.TOKEN_OP_BNOT:
-		f.emitABC( luavm.OP_BNOT, a, b, 0)
+		f.emitABC(line, luavm.OP_BNOT, a, b, 0)
 	case lexer.TOKEN_OP_LEN:
-		f.emitABC( luavm.OP_LEN, a, b, 0)
+		f.emitABC(line, luavm.OP_LEN, a, b, 0)
 	case lexer.TOKEN_OP_UNM:
-		f.emitABC( luavm.OP_UNM, a, b, 0)
+		f.emitABC(line, luavm.OP_UNM, a, b, 0)
 	}
 }
 
 // r[a] = rk[b] op rk[c]
 // arith & bitwise & relational
-func (f *funcInfo) emitBinaryOp( op, a, b, c int) {
+func (f *funcInfo) emitBinaryOp(line, op, a, b, c int) {
 	if opcode, found := arithAndBitwiseBinops[op]; found {
-		f.emitABC( opcode, a, b, c)
+		f.emitABC(line, opcode, a, b, c)
 	} else {
 		switch op {
 		case lexer.TOKEN_OP_EQ:
-			f.emitABC( luavm.OP_EQ, 1, b, c)
+			f.emitABC(line, luavm.OP_EQ, 1, b, c)
 		case lexer.TOKEN_OP_NE:
-			f.emitABC( luavm.OP_EQ, 0, b, c)
+			f.emitABC(line, luavm.OP_EQ, 0, b, c)
 		case lexer.TOKEN_OP_LT:
-			f.emitABC( luavm.OP_LT, 1, b, c)
+			f.emitABC(line, luavm.OP_LT, 1, b, c)
 		case lexer.TOKEN_OP_GT:
-			f.emitABC( luavm.OP_LT, 1, c, b)
+			f.emitABC(line, luavm.OP_LT, 1, c, b)
 		case lexer.TOKEN_OP_LE:
-			f.emitABC( luavm.OP_LE, 1, b, c)
+			f.emitABC(line, luavm.OP_LE, 1, b, c)
 		case lexer.TOKEN_OP_GE:
-			f.emitABC( luavm.OP_LE, 1, c, b)
+			f.emitABC(line, luavm.OP_LE, 1, c, b)
 		}
-		f.emitJmp( 0, 1)
-		f.emitLoadBool( a, 0, 1)
-		f.emitLoadBool( a, 1, 0)
+		f.emitJmp(line, 0, 1)
+		f.emitLoadBool(line, a, 0, 1)
+		f.emitLoadBool(line, a, 1, 0)
 	}
 }
 
-
 func (f *funcInfo) getJmpArgA() int {
 	hasCapturedLocVars := false
 	minSlotOfLocVars := f.maxRegs
@@ -434,9 +597,9 @@ func (f *funcInfo) getJmpArgA() int {
 	}
 }
 
-func (f *funcInfo) closeOpenUpvals() {
+func (f *funcInfo) closeOpenUpvals(line int) {
 	a := f.getJmpArgA()
 	if a > 0 {
-		f.emitJmp(a, 0)
+		f.emitJmp(line, a, 0)
 	}
-}
\ No newline at end of file
+}
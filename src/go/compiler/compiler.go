@@ -0,0 +1,89 @@
+package compiler
+
+import (
+	"fmt"
+	"go/binchunk"
+	"go/compiler/codegen"
+	"go/compiler/lexer"
+	"go/compiler/parser"
+	"strings"
+)
+
+//SyntaxError 语法错误，编译失败时Compile返回的就是*SyntaxError
+type SyntaxError = lexer.SyntaxError
+
+//Mode 控制编译的选项，可以按位组合
+type Mode uint
+
+const (
+	StripDebug Mode = 1 << iota //不保留行号、局部变量和upvalue的名字，和luac -s一样
+)
+
+//Compile 把lua源码编译成函数原型，等价于luac；函数原型带有完整的调试信息
+func Compile(chunk, chunkName string) (*binchunk.Prototype, error) {
+	return CompileMode(chunk, chunkName, 0)
+}
+
+//CompileMode 和Compile一样，由mode决定是否去掉调试信息
+func CompileMode(chunk, chunkName string, mode Mode) (proto *binchunk.Prototype, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if synErr, ok := r.(*SyntaxError); ok {
+				synErr.ChunkName = chunkName
+				proto, err = nil, synErr
+			} else {
+				proto, err = nil, fmt.Errorf("%s: internal compiler error: %v", chunkName, r)
+			}
+		}
+	}()
+
+	block, err := parser.Parse(chunk, chunkName)
+	if err != nil {
+		return nil, err
+	}
+	proto = codegen.GenProto(block)
+	setSource(proto, chunkName)
+	if mode&StripDebug != 0 {
+		stripDebug(proto)
+	}
+	return proto, nil
+}
+
+//SkipComment 和luaL_loadfile一样跳过文件开头UTF-8的BOM和第一行的#注释(比如#!/usr/bin/env lua)，
+//返回跳过的字节数；第一行结尾的换行不跳过，所以剩下的源码行号不变
+func SkipComment(src string) int {
+	n := 0
+	if strings.HasPrefix(src, "\xEF\xBB\xBF") {
+		n = 3
+	}
+	if !strings.HasPrefix(src[n:], "#") {
+		return n
+	}
+	if i := strings.IndexAny(src[n:], "\r\n"); i >= 0 {
+		return n + i
+	}
+	return len(src)
+}
+
+//MaskComment 把SkipComment跳过的部分换成空格，源码里所有位置的行号和列号都不变
+func MaskComment(src string) string {
+	n := SkipComment(src)
+	return strings.Repeat(" ", n) + src[n:]
+}
+
+func setSource(proto *binchunk.Prototype, source string) {
+	proto.Source = source
+	for _, p := range proto.Protos {
+		setSource(p, source)
+	}
+}
+
+//stripDebug 去掉行号、局部变量和upvalue的名字，Source留给错误信息用
+func stripDebug(proto *binchunk.Prototype) {
+	proto.LineInfo = nil
+	proto.LocVars = nil
+	proto.UpvalueNames = nil
+	for _, p := range proto.Protos {
+		stripDebug(p)
+	}
+}
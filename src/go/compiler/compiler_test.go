@@ -0,0 +1,168 @@
+package compiler
+
+import (
+	"bytes"
+	"go/binchunk"
+	"go/binchunk/disasm"
+	"go/luavm"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//TestCompileMatchesLuac ch13/luac.out是luac 5.3编译ch13/test.lua的结果，
+//全局变量要用GETTABUP，常量要放进RK，指令和寄存器个数都应该和它一样
+func TestCompileMatchesLuac(t *testing.T) {
+	src, err := ioutil.ReadFile("../../lua/ch13/test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("../../lua/ch13/luac.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Compile(string(src), "@test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := binchunk.UndumpErr(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareCode(t, "main", got, want)
+}
+
+//TestCompileDumpMatchesLuac ch06/test.lua没有用到全局变量，main函数也要有_ENV这个upvalue，Dump出来和luac.out逐字节相同
+func TestCompileDumpMatchesLuac(t *testing.T) {
+	src, err := ioutil.ReadFile("../../lua/ch06/test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("../../lua/ch06/luac.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto, err := Compile(string(src), "@test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := binchunk.Dump(proto, false); !bytes.Equal(got, want) {
+		t.Errorf("Dump differs from luac.out\ngot:\n%swant:\n%s", listing(proto), listing(binchunk.Undump(want)))
+	}
+}
+
+func compareCode(t *testing.T, name string, got, want *binchunk.Prototype) {
+	t.Helper()
+	if !reflect.DeepEqual(got.Code, want.Code) {
+		t.Errorf("%s: code differs\ngot:\n%swant:\n%s", name, listing(got), listing(want))
+	}
+	if got.MaxStatckSize != want.MaxStatckSize {
+		t.Errorf("%s: MaxStatckSize = %d, want %d", name, got.MaxStatckSize, want.MaxStatckSize)
+	}
+	if len(got.Protos) != len(want.Protos) {
+		t.Fatalf("%s: %d functions, want %d", name, len(got.Protos), len(want.Protos))
+	}
+	for i := range got.Protos {
+		compareCode(t, name+"/"+want.Protos[i].Source, got.Protos[i], want.Protos[i])
+	}
+}
+
+func listing(proto *binchunk.Prototype) string {
+	var buf bytes.Buffer
+	p := *proto
+	p.Protos = nil
+	disasm.Fprint(&buf, &p, false)
+	return buf.String()
+}
+
+func TestCompileRKOperands(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string //main函数的指令，不包括最后的RETURN
+	}{
+		{"x = y", []string{"GETTABUP", "SETTABUP"}},
+		{"x.a = 1", []string{"GETTABUP", "SETTABLE"}},
+		{"local t; t[1] = t.k + 2", []string{"LOADNIL", "GETTABLE", "ADD", "SETTABLE"}},
+		{"local a; a = a * 2", []string{"LOADNIL", "MUL"}},
+		{"local a; if a > 1 then a = 0 end", []string{"LOADNIL", "LT", "JMP", "LOADK"}},
+		{"local a = 5 ~ 3", []string{"LOADK"}},
+	}
+	for _, tt := range tests {
+		proto, err := Compile(tt.src, "=test")
+		if err != nil {
+			t.Fatalf("%q: %v", tt.src, err)
+		}
+		var got []string
+		for _, i := range proto.Code[:len(proto.Code)-1] {
+			got = append(got, strings.TrimSpace(luavm.Instruction(i).OpName()))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSkipComment(t *testing.T) {
+	tests := []struct {
+		src  string
+		skip int
+	}{
+		{"print(1)", 0},
+		{"\xEF\xBB\xBFprint(1)", 3},
+		{"#!/usr/bin/env lua\nprint(1)", 18},
+		{"\xEF\xBB\xBF# comment\r\nprint(1)", 12},
+		{"#only a comment", 15},
+		{"-- #not skipped\n", 0},
+	}
+	for _, tt := range tests {
+		if got := SkipComment(tt.src); got != tt.skip {
+			t.Errorf("SkipComment(%q) = %d, want %d", tt.src, got, tt.skip)
+		}
+		masked := MaskComment(tt.src)
+		if len(masked) != len(tt.src) || masked[tt.skip:] != tt.src[tt.skip:] {
+			t.Errorf("MaskComment(%q) = %q", tt.src, masked)
+		}
+		if _, err := Compile(tt.src[tt.skip:], "=test"); err != nil {
+			t.Errorf("Compile(%q): %v", tt.src[tt.skip:], err)
+		}
+	}
+}
+
+//TestCompileGoto label只和同一个block里的label冲突，goto不能跳进局部变量的作用域
+func TestCompileGoto(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{"::a:: do ::a:: end", ""},
+		{"::a:: do goto a end", ""},
+		{"do ::a:: goto a end ::a::", ""},
+		{"do goto a local x ::a:: end", ""},
+		{"while true do goto continue local x = 1 ::continue:: end", ""},
+		{"::a:: ::a::", "test:1: label 'a' already defined on line 1"},
+		{"::a:: do end\n::a::", "test:2: label 'a' already defined on line 1"},
+		{"goto a", "test:1: no visible label 'a' for <goto> at line 1"},
+		{"do ::a:: end goto a", "test:1: no visible label 'a' for <goto> at line 1"},
+		{"goto a local x ::a:: print(x)", "test:1: <goto a> at line 1 jumps into the scope of local 'x'"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src, "=test")
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("%q: error %q, want %q", tt.src, got, tt.err)
+		}
+	}
+
+	//内层block的同名label遮住外层的，goto跳到离它最近的那个
+	proto, err := Compile("::a:: local x do ::a:: goto a end", "=test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jmp := luavm.Instruction(proto.Code[1])
+	if _, sBx := jmp.AsBx(); strings.TrimSpace(jmp.OpName()) != "JMP" || sBx != -1 {
+		t.Errorf("goto compiled to %s", listing(proto))
+	}
+}
@@ -0,0 +1,107 @@
+package lexer
+
+import "strings"
+
+//Mode 控制词法分析器的行为
+type Mode uint
+
+const (
+	KeepComments Mode = 1 << iota //记录注释和token流，见Tokens()
+)
+
+//Comment 源码中的一条注释，Text是注释的原文，包括开头的--
+type Comment struct {
+	Pos  Pos
+	End  Pos
+	Text string
+}
+
+//IsLong 是否是--[[ ]]形式的长注释，长注释后面可以接着写代码
+func (comment *Comment) IsLong() bool {
+	return strings.HasPrefix(comment.Text, "--[") && reOpeningLongBracket.MatchString(comment.Text[2:])
+}
+
+//Token KeepComments模式下记录的一个token
+type Token struct {
+	Kind     int
+	Text     string //token的原文，TOKEN_EOF是空串
+	Pos      Pos
+	End      Pos
+	Leading  []*Comment //token前面的注释，不包括和上一个token在同一行开始的注释
+	Trailing []*Comment //token后面、在同一行开始的注释
+}
+
+//NewLexerMode 创建一个按mode工作的词法分析器
+func NewLexerMode(chunk, chunkName string, mode Mode) *Lexer {
+	lexer := NewLexer(chunk, chunkName)
+	lexer.mode = mode
+	return lexer
+}
+
+//Tokens 返回到目前为止扫描过的token(包括LookAhead看过的)，只在KeepComments模式下有效；
+//一个token的Trailing要等到扫描下一个token时才确定
+func (lexer *Lexer) Tokens() []*Token {
+	return lexer.tokens
+}
+
+//Comments 按出现顺序返回扫描过的所有注释，只在KeepComments模式下有效
+func (lexer *Lexer) Comments() []*Comment {
+	var comments []*Comment
+	for _, token := range lexer.tokens {
+		comments = append(comments, token.Leading...)
+		comments = append(comments, token.Trailing...)
+	}
+	return append(comments, lexer.comments...)
+}
+
+//Tokenize 把整个chunk切成token流，包括最后的TOKEN_EOF，注释挂在token上
+func Tokenize(chunk, chunkName string) (tokens []*Token, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			synErr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			tokens, err = nil, synErr
+		}
+	}()
+
+	lexer := NewLexerMode(chunk, chunkName, KeepComments)
+	for {
+		if _, kind, _ := lexer.NextToken(); kind == TOKEN_EOF {
+			return lexer.tokens, nil
+		}
+	}
+}
+
+func (lexer *Lexer) addComment(start Pos) {
+	end := lexer.pos()
+	comment := &Comment{Pos: start, End: end, Text: lexer.src[start.Offset:end.Offset]}
+	lexer.comments = append(lexer.comments, comment)
+}
+
+//addToken 记录刚扫描完的token，并把它前面的注释分给上一个token或者它自己
+func (lexer *Lexer) addToken(kind int) {
+	if n := len(lexer.tokens); n > 0 && lexer.tokens[n-1].Kind == TOKEN_EOF {
+		return //到了末尾以后反复调用NextToken
+	}
+	token := &Token{
+		Kind: kind,
+		Text: lexer.src[lexer.tokenStart.Offset:lexer.tokenEnd.Offset],
+		Pos:  lexer.tokenStart,
+		End:  lexer.tokenEnd,
+	}
+	var prev *Token
+	if n := len(lexer.tokens); n > 0 {
+		prev = lexer.tokens[n-1]
+	}
+	for _, comment := range lexer.comments {
+		if prev != nil && comment.Pos.Line == prev.End.Line {
+			prev.Trailing = append(prev.Trailing, comment)
+		} else {
+			token.Leading = append(token.Leading, comment)
+		}
+	}
+	lexer.comments = nil
+	lexer.tokens = append(lexer.tokens, token)
+}
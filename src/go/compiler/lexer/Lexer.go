@@ -18,17 +18,34 @@ var reDecEscapeSeq = regexp.MustCompile(`^\\[0-9]{1,3}`)
 var reHexEscapeSeq = regexp.MustCompile(`^\\x[0-9a-fA-F]{2}`)
 var reUnicodeEscapeSeq = regexp.MustCompile(`^\\u\{[0-9a-fA-F]+\}`)
 
+//Pos 源码中的一个位置，Line和Column从1开始，Column和Offset都按字节计算
+type Pos struct {
+	Line   int
+	Column int
+	Offset int
+}
+
 type Lexer struct {
-	chunk         string
-	chunkName     string
-	line          int
-	nextToken     string
-	nextTokenKind int
-	nextTokenLine int
+	src            string //完整的源码，用来计算偏移
+	chunk          string
+	chunkName      string
+	line           int
+	lineStart      int //当前行第一个字节的偏移
+	tokenStart     Pos //当前token的起点和终点(不含)
+	tokenEnd       Pos
+	nextToken      string
+	nextTokenKind  int
+	nextTokenLine  int
+	nextTokenStart Pos
+	nextTokenEnd   Pos
+	mode           Mode
+	tokens         []*Token   //KeepComments模式下扫描过的token
+	comments       []*Comment //还没有分给token的注释
+	errh           func(*SyntaxError)
 }
 
 func NewLexer(chunk, chunkName string) *Lexer {
-	return &Lexer{chunk, chunkName, 1, "", 0, 0}
+	return &Lexer{src: chunk, chunk: chunk, chunkName: chunkName, line: 1}
 }
 
 func (lexer *Lexer) NextToken() (line, kind int, token string) {
@@ -37,11 +54,27 @@ func (lexer *Lexer) NextToken() (line, kind int, token string) {
 		kind = lexer.nextTokenKind
 		token = lexer.nextToken
 		lexer.line = lexer.nextTokenLine
+		lexer.tokenStart = lexer.nextTokenStart
+		lexer.tokenEnd = lexer.nextTokenEnd
 		lexer.nextTokenLine = 0
 		return
 	}
 
-	lexer.skipWhiteSpace()
+	if lexer.errh != nil {
+		line, kind, token = lexer.scanTokenRecover()
+	} else {
+		lexer.skipWhiteSpace()
+		lexer.tokenStart = lexer.pos()
+		line, kind, token = lexer.scanToken()
+	}
+	lexer.tokenEnd = lexer.pos()
+	if lexer.mode&KeepComments != 0 {
+		lexer.addToken(kind)
+	}
+	return
+}
+
+func (lexer *Lexer) scanToken() (line, kind int, token string) {
 	if len(lexer.chunk) == 0 {
 		return lexer.line, TOKEN_EOF, "EOF"
 	}
@@ -182,7 +215,7 @@ func (lexer *Lexer) NextToken() (line, kind int, token string) {
 		}
 	}
 
-	lexer.error("unexpected symbol near %q", c)
+	lexer.error(string(c), "unexpected symbol")
 	return
 }
 
@@ -190,12 +223,14 @@ func (lexer *Lexer) skipWhiteSpace() {
 	for len(lexer.chunk) > 0 {
 		if lexer.test("--") {
 			lexer.skipComment()
-		} else if lexer.test("\r\n") || lexer.test("\n\\r") {
+		} else if lexer.test("\r\n") || lexer.test("\n\r") {
 			lexer.next(2)
 			lexer.line++
+			lexer.lineStart = lexer.offset()
 		} else if lexer.isNewLine(lexer.chunk[0]) {
 			lexer.next(1)
 			lexer.line++
+			lexer.lineStart = lexer.offset()
 		} else if lexer.isWhiteSpace(lexer.chunk[0]) {
 			lexer.next(1)
 		} else {
@@ -212,6 +247,22 @@ func (lexer *Lexer) next(n int) {
 	lexer.chunk = lexer.chunk[n:]
 }
 
+func (lexer *Lexer) offset() int {
+	return len(lexer.src) - len(lexer.chunk)
+}
+
+func (lexer *Lexer) pos() Pos {
+	offset := lexer.offset()
+	return Pos{Line: lexer.line, Column: offset - lexer.lineStart + 1, Offset: offset}
+}
+
+// fixLineStart 扫描完可能跨行的token之后重新定位当前行的开头
+func (lexer *Lexer) fixLineStart(start int) {
+	if i := strings.LastIndexAny(lexer.src[start:lexer.offset()], "\r\n"); i >= 0 {
+		lexer.lineStart = start + i + 1
+	}
+}
+
 func (lexer *Lexer) isWhiteSpace(c byte) bool {
 	switch c {
 	case '\t', '\n', '\v', '\f', '\r', ' ':
@@ -225,33 +276,37 @@ func (lexer *Lexer) isNewLine(c byte) bool {
 }
 
 func (lexer *Lexer) skipComment() {
+	lexer.tokenStart = lexer.pos()
 	lexer.next(2)
-	if lexer.test("[") {
-		if reOpeningLongBracket.FindString(lexer.chunk) != "" {
-			lexer.scanLongString()
-			return
+	if lexer.test("[") && reOpeningLongBracket.FindString(lexer.chunk) != "" {
+		lexer.scanLongString()
+	} else {
+		for len(lexer.chunk) > 0 && !lexer.isNewLine(lexer.chunk[0]) {
+			lexer.next(1)
 		}
 	}
-	for len(lexer.chunk) > 0 && !lexer.isNewLine(lexer.chunk[0]) {
-		lexer.next(1)
+	if lexer.mode&KeepComments != 0 {
+		lexer.addComment(lexer.tokenStart)
 	}
 }
 
 func (lexer *Lexer) scanLongString() string {
 	openingLongBracket := reOpeningLongBracket.FindString(lexer.chunk)
 	if openingLongBracket == "" {
-		lexer.error("invalid long string delimiter near '%s'", lexer.chunk[0:2])
+		lexer.error(lexer.chunk[0:2], "invalid long string delimiter")
 	}
+	start := lexer.offset()
 	closingLongBracket := strings.Replace(openingLongBracket, "[", "]", -1)
 	closingLongBracketIdx := strings.Index(lexer.chunk, closingLongBracket)
 	if closingLongBracketIdx < 0 {
-		lexer.error("unfinished long string or comment")
+		lexer.error("<eof>", "unfinished long string or comment")
 	}
 
 	str := lexer.chunk[len(openingLongBracket):closingLongBracketIdx]
 	lexer.next(closingLongBracketIdx + len(closingLongBracket))
 	str = reNewLine.ReplaceAllString(str, "\n")
 	lexer.line += strings.Count(str, "\n")
+	lexer.fixLineStart(start)
 
 	//TODO 如果开头有多个\n，就无法替换了？
 	if len(str) > 0 && str[0] == '\n' {
@@ -262,15 +317,17 @@ func (lexer *Lexer) scanLongString() string {
 
 func (lexer *Lexer) scanShortString() string {
 	if str := reShortStr.FindString(lexer.chunk); str != "" {
+		start := lexer.offset()
 		lexer.next(len(str))
 		str = str[1 : len(str)-1]
 		if strings.Index(str, `\`) >= 0 {
 			lexer.line += len(reNewLine.FindAllString(str, -1))
+			lexer.fixLineStart(start)
 			str = lexer.escape(str)
 		}
 		return str
 	}
-	lexer.error("unfinished string")
+	lexer.error(lexer.restOfLine(), "unfinished string")
 	return ""
 }
 
@@ -285,7 +342,7 @@ func (lexer *Lexer) escape(str string) string {
 		}
 
 		if len(str) == 1 {
-			lexer.error("unfinished string")
+			lexer.error(lexer.src[lexer.tokenStart.Offset:lexer.offset()], "unfinished string")
 		}
 
 		switch str[1] {
@@ -337,7 +394,7 @@ func (lexer *Lexer) escape(str string) string {
 					str = str[len(found):]
 					continue
 				}
-				lexer.error("decimal escape too large near '%s'", found)
+				lexer.error(found, "decimal escape too large")
 			}
 		case 'x': // \xXX
 			if found := reHexEscapeSeq.FindString(str); found != "" {
@@ -354,7 +411,7 @@ func (lexer *Lexer) escape(str string) string {
 					str = str[len(found):]
 					continue
 				}
-				lexer.error("UTF-8 value too large near '%s'", found)
+				lexer.error(found, "UTF-8 value too large")
 			}
 		case 'z':
 			str = str[2:]
@@ -363,7 +420,7 @@ func (lexer *Lexer) escape(str string) string {
 			}
 			continue
 		}
-		lexer.error("invalid escape sequence near '\\%c'", str[1])
+		lexer.error(`\`+string(str[1]), "invalid escape sequence")
 	}
 
 	return buf.String()
@@ -385,10 +442,38 @@ func (lexer *Lexer) scan(re *regexp.Regexp) string {
 	panic("unreachable!!")
 }
 
-func (lexer *Lexer) error(f string, a ...interface{}) {
-	err := fmt.Sprintf(f, a...)
-	err = fmt.Sprintf("%s:%d: %s", lexer.chunkName, lexer.line, err)
-	panic(err)
+// error 在当前token的位置抛出*SyntaxError，near是错误信息里附带的token
+func (lexer *Lexer) error(near, f string, a ...interface{}) {
+	panic(lexer.newError(lexer.tokenStart, near, f, a...))
+}
+
+func (lexer *Lexer) newError(pos Pos, near, f string, a ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		ChunkName: lexer.chunkName,
+		Line:      pos.Line,
+		Column:    pos.Column,
+		Token:     near,
+		Msg:       fmt.Sprintf(f, a...),
+	}
+}
+
+//Error 报告当前token(最近一次NextToken返回的token)附近的语法错误
+func (lexer *Lexer) Error(f string, a ...interface{}) {
+	lexer.error(lexer.tokenText(), f, a...)
+}
+
+func (lexer *Lexer) tokenText() string {
+	if lexer.tokenStart.Offset >= len(lexer.src) {
+		return "<eof>"
+	}
+	return lexer.src[lexer.tokenStart.Offset:lexer.tokenEnd.Offset]
+}
+
+func (lexer *Lexer) restOfLine() string {
+	if i := strings.IndexAny(lexer.chunk, "\r\n"); i >= 0 {
+		return lexer.chunk[:i]
+	}
+	return lexer.chunk
 }
 
 func isLetter(c byte) bool {
@@ -404,11 +489,14 @@ func (lexer *Lexer) LookAhead() int {
 		return lexer.nextTokenKind
 	}
 	currentLine := lexer.line
+	tokenStart, tokenEnd := lexer.tokenStart, lexer.tokenEnd
 	line, kind, token := lexer.NextToken()
 	lexer.line = currentLine
 	lexer.nextTokenLine = line
 	lexer.nextTokenKind = kind
 	lexer.nextToken = token
+	lexer.nextTokenStart, lexer.nextTokenEnd = lexer.tokenStart, lexer.tokenEnd
+	lexer.tokenStart, lexer.tokenEnd = tokenStart, tokenEnd
 	return kind
 }
 
@@ -416,10 +504,35 @@ func (lexer *Lexer) Line() int {
 	return lexer.line
 }
 
+//TokenStart 返回当前token(最近一次NextToken返回的token)的起点
+func (lexer *Lexer) TokenStart() Pos {
+	return lexer.tokenStart
+}
+
+//TokenEnd 返回当前token的终点，指向token最后一个字节的下一个位置
+func (lexer *Lexer) TokenEnd() Pos {
+	return lexer.tokenEnd
+}
+
+//LookAheadPos 返回下一个token的起点
+func (lexer *Lexer) LookAheadPos() Pos {
+	lexer.LookAhead()
+	return lexer.nextTokenStart
+}
+
+//LookAheadError 返回下一个token附近的语法错误，既不抛出，也不消耗这个token
+func (lexer *Lexer) LookAheadError(f string, a ...interface{}) *SyntaxError {
+	near := "<eof>"
+	if lexer.LookAhead() != TOKEN_EOF {
+		near = lexer.src[lexer.nextTokenStart.Offset:lexer.nextTokenEnd.Offset]
+	}
+	return lexer.newError(lexer.nextTokenStart, near, f, a...)
+}
+
 func (lexer *Lexer) NextTokenOfKind(kind int) (line int, token string) {
 	line, _kind, token := lexer.NextToken()
 	if kind != _kind {
-		lexer.error("syntax error near '%s'", token)
+		lexer.Error("'%s' expected", TokenName(kind))
 	}
 	return line, token
 }
@@ -0,0 +1,153 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+//SyntaxError 编译期间发现的语法错误，Line和Column从1开始，Column按字节计算，为0时表示列号未知
+type SyntaxError struct {
+	ChunkName string
+	Line      int
+	Column    int
+	Token     string //出错位置附近的token，可能为空
+	Msg       string
+}
+
+//Error 和luac的错误信息一样，chunk名字用ChunkID转换：test.lua:1: unexpected symbol near '='
+func (err *SyntaxError) Error() string {
+	chunkID := ChunkID(err.ChunkName)
+	switch err.Token {
+	case "":
+		return fmt.Sprintf("%s:%d: %s", chunkID, err.Line, err.Msg)
+	case "<eof>":
+		return fmt.Sprintf("%s:%d: %s near %s", chunkID, err.Line, err.Msg, err.Token)
+	default:
+		return fmt.Sprintf("%s:%d: %s near '%s'", chunkID, err.Line, err.Msg, err.Token)
+	}
+}
+
+//LUA_IDSIZE 和luaconf.h一样，错误信息里chunk名字的最大长度，包括C字符串结尾的'\0'
+const LUA_IDSIZE = 60
+
+/*
+ChunkID 和luaO_chunkid一样把chunk名字变成错误信息里的写法：
+"=stdin"去掉"="，"@test.lua"去掉"@"，文件名太长时只保留结尾；
+其他的名字是源码本身，写成[string "第一行..."]。
+*/
+func ChunkID(source string) string {
+	const bufflen = LUA_IDSIZE - 1
+	switch {
+	case strings.HasPrefix(source, "="):
+		if len(source) <= LUA_IDSIZE {
+			return source[1:]
+		}
+		return source[1 : 1+bufflen]
+	case strings.HasPrefix(source, "@"):
+		if len(source) <= LUA_IDSIZE {
+			return source[1:]
+		}
+		return "..." + source[len(source)-(bufflen-3):]
+	}
+	const pre, rets, pos = "[string \"", "...", "\"]"
+	avail := bufflen - len(pre) - len(rets) - len(pos)
+	nl := strings.IndexByte(source, '\n')
+	if len(source) < avail && nl < 0 {
+		return pre + source + pos
+	}
+	line := source
+	if nl >= 0 {
+		line = source[:nl]
+	}
+	if len(line) > avail {
+		line = line[:avail]
+	}
+	return pre + line + rets + pos
+}
+
+var tokenNames = map[int]string{
+	TOKEN_EOF:        "<eof>",
+	TOKEN_VARARG:     "...",
+	TOKEN_SEP_SEMI:   ";",
+	TOKEN_SEP_COMMA:  ",",
+	TOKEN_SEP_DOT:    ".",
+	TOKEN_SEP_COLON:  ":",
+	TOKEN_SEP_LABEL:  "::",
+	TOKEN_SEP_LPAREN: "(",
+	TOKEN_SEP_RPAREN: ")",
+	TOKEN_SEP_LBRACK: "[",
+	TOKEN_SEP_RBRACK: "]",
+	TOKEN_SEP_LCURLY: "{",
+	TOKEN_SEP_RCURLY: "}",
+	TOKEN_OP_ASSIGN:  "=",
+	TOKEN_IDENTIFIER: "<name>",
+	TOKEN_NUMBER:     "<number>",
+	TOKEN_STRING:     "<string>",
+}
+
+//TokenName 返回某一类token在错误信息里的写法
+func TokenName(kind int) string {
+	if name, found := tokenNames[kind]; found {
+		return name
+	}
+	for name, k := range keywords {
+		if k == kind {
+			return name
+		}
+	}
+	return "?"
+}
+
+//SetErrorHandler 设置词法错误的处理函数：设置以后词法错误不再panic，而是交给h，
+//然后跳过出错的字符(没有结尾的字符串跳过这一行，没有结尾的长字符串和长注释跳到末尾)接着扫描；
+//Error报告的语法错误不受影响
+func (lexer *Lexer) SetErrorHandler(h func(*SyntaxError)) {
+	lexer.errh = h
+}
+
+//scanTokenRecover 在有错误处理函数时扫描下一个token
+func (lexer *Lexer) scanTokenRecover() (line, kind int, token string) {
+	for {
+		err := lexer.try(func() {
+			lexer.skipWhiteSpace()
+			lexer.tokenStart = lexer.pos()
+			line, kind, token = lexer.scanToken()
+		})
+		if err == nil {
+			return
+		}
+		lexer.errh(err)
+		switch {
+		case err.Msg == "unfinished long string or comment":
+			lexer.skip(len(lexer.chunk))
+		case lexer.offset() > lexer.tokenStart.Offset:
+			//已经越过了出错的token，比如字符串里错误的转义
+		case err.Msg == "unfinished string":
+			lexer.skip(len(lexer.restOfLine()))
+		default:
+			lexer.skip(1)
+		}
+	}
+}
+
+func (lexer *Lexer) try(f func()) (err *SyntaxError) {
+	defer func() {
+		if r := recover(); r != nil {
+			synErr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = synErr
+		}
+	}()
+	f()
+	return nil
+}
+
+//skip 跳过n个字节，维护行号
+func (lexer *Lexer) skip(n int) {
+	start := lexer.offset()
+	lexer.line += len(reNewLine.FindAllString(lexer.chunk[:n], -1))
+	lexer.next(n)
+	lexer.fixLineStart(start)
+}
@@ -0,0 +1,45 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkID(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	tests := []struct {
+		source, want string
+	}{
+		{"=stdin", "stdin"},
+		{"@test.lua", "test.lua"},
+		{"=" + long, long[:59]},
+		{"@" + long, "..." + long[:56]},
+		{"x = 1", `[string "x = 1"]`},
+		{"x = 1\ny = 2", `[string "x = 1..."]`},
+		{long, `[string "` + long[:45] + `..."]`},
+	}
+	for _, tt := range tests {
+		if got := ChunkID(tt.source); got != tt.want {
+			t.Errorf("ChunkID(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestSyntaxErrorUsesChunkID(t *testing.T) {
+	tests := []struct {
+		err  SyntaxError
+		want string
+	}{
+		{SyntaxError{ChunkName: "@/tmp/s.lua", Line: 1, Token: "=", Msg: "unexpected symbol"},
+			"/tmp/s.lua:1: unexpected symbol near '='"},
+		{SyntaxError{ChunkName: "=stdin", Line: 2, Token: "<eof>", Msg: "'end' expected"},
+			"stdin:2: 'end' expected near <eof>"},
+		{SyntaxError{ChunkName: "return +", Line: 1, Msg: "unexpected symbol"},
+			`[string "return +"]:1: unexpected symbol`},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
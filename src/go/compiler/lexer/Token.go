@@ -90,3 +90,9 @@ var keywords = map[string]int{
 	"until":    TOKEN_KW_UNTIL,
 	"while":    TOKEN_KW_WHILE,
 }
+
+//IsKeyword 判断name是不是lua的保留字，保留字不能用作变量名和table的.key
+func IsKeyword(name string) bool {
+	_, found := keywords[name]
+	return found
+}
@@ -2,10 +2,10 @@ package main
 
 import (
 	"fmt"
+	"go/compiler/ast"
 	"go/compiler/lexer"
 	"go/compiler/parser"
 	"io/ioutil"
-	"encoding/json"
 )
 
 func main() {
@@ -21,8 +21,11 @@ func testParse() {
 		panic(err)
 	}
 	chunk, chunkName := string(data), "test"
-	astLua := parser.Parse(chunk, chunkName)
-	b, err := json.Marshal(astLua)
+	astLua, err := parser.Parse(chunk, chunkName)
+	if err != nil {
+		panic(err)
+	}
+	b, err := ast.EncodeJSON(astLua)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"go/compiler/ast"
+	"go/compiler/lexer"
+)
+
+//foldBlock 自底向上遍历语法树，用optimizeXXX把能在编译期算出来的表达式替换成常量
+func foldBlock(block *ast.Block) {
+	ast.Rewrite(block, nil, func(c *ast.Cursor) bool {
+		switch exp := c.Node().(type) {
+		case *ast.UnopExp:
+			c.Replace(optimizeUnaryOp(exp))
+		case *ast.BinopExp:
+			c.Replace(foldBinop(exp))
+		}
+		return true
+	})
+}
+
+func foldBinop(exp *ast.BinopExp) ast.Exp {
+	switch exp.Op {
+	case lexer.TOKEN_OP_OR:
+		return optimizeLogicalOr(exp)
+	case lexer.TOKEN_OP_AND:
+		return optimizeLogicalAnd(exp)
+	case lexer.TOKEN_OP_BAND, lexer.TOKEN_OP_BOR, lexer.TOKEN_OP_BXOR, lexer.TOKEN_OP_SHL, lexer.TOKEN_OP_SHR:
+		return optimizeBitwiseBinaryOp(exp)
+	case lexer.TOKEN_OP_ADD, lexer.TOKEN_OP_SUB, lexer.TOKEN_OP_MUL, lexer.TOKEN_OP_DIV,
+		lexer.TOKEN_OP_IDIV, lexer.TOKEN_OP_MOD, lexer.TOKEN_OP_POW:
+		return optimizeArithBinaryOp(exp)
+	}
+	return exp
+}
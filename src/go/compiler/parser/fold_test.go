@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"go/compiler/ast"
+	"testing"
+)
+
+func TestFoldBitwise(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int64
+	}{
+		{"return 5 & 3", 1},
+		{"return 5 | 3", 7},
+		{"return 5 ~ 3", 6},
+		{"return 5 ~ 3.0", 6},
+		{"return 1 << 4", 16},
+		{"return 256 >> 4", 16},
+	}
+	for _, tt := range tests {
+		block, err := Parse(tt.src, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp, ok := block.RetExps[0].(*ast.IntegerExp); !ok || exp.Val != tt.want {
+			t.Errorf("%q: folded to %#v, want %d", tt.src, block.RetExps[0], tt.want)
+		}
+	}
+
+	//不折叠时保留原来的运算
+	block, err := ParseMode("return 5 ~ 3", "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := block.RetExps[0].(*ast.BinopExp); !ok {
+		t.Errorf("ParseMode without FoldConstants: %#v", block.RetExps[0])
+	}
+}
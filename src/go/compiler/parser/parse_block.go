@@ -7,25 +7,125 @@ import (
 	"math"
 )
 
-func Parse(chunk, chunkName string) *ast.Block{
-	le := lexer.NewLexer(chunk, chunkName)
+//Mode 控制解析器的行为，可以按位组合
+type Mode uint
+
+const (
+	FoldConstants Mode = 1 << iota //折叠常量表达式，比如1+2直接变成3，not nil直接变成true
+	RecoverErrors                  //遇到语法错误不停下来，而是收集所有错误并返回带BadStat/BadExp的不完整语法树
+)
+
+//Parse 把lua源码解析成语法树并折叠常量，语法错误以*lexer.SyntaxError的形式返回
+func Parse(chunk, chunkName string) (*ast.Block, error) {
+	return ParseMode(chunk, chunkName, FoldConstants)
+}
+
+//ParseMode 和Parse一样，但由mode决定是否折叠常量；不折叠时语法树和源码一一对应，格式化之类的工具需要这样；
+//mode包含RecoverErrors时，有语法错误也会返回语法树，错误以ErrorList的形式返回
+func ParseMode(chunk, chunkName string, mode Mode) (*ast.Block, error) {
+	return parse(lexer.NewLexer(chunk, chunkName), mode)
+}
+
+//ParseComments 和ParseMode一样，同时保留源码中的注释，并按位置把它们挂到语法树节点上
+func ParseComments(chunk, chunkName string, mode Mode) (*ast.Block, ast.CommentMap, error) {
+	le := lexer.NewLexerMode(chunk, chunkName, lexer.KeepComments)
+	block, err := parse(le, mode)
+	if block == nil {
+		return nil, nil, err
+	}
+	return block, ast.NewCommentMap(block, le.Comments()), err
+}
+
+//parser 解析时的状态：嵌入词法分析器，解析函数照旧直接调用它的方法
+type parser struct {
+	*lexer.Lexer
+	mode       Mode
+	errors     ErrorList //RecoverErrors模式下收集到的错误
+	statErrors int       //当前语句开始时已经收集到的错误数
+}
+
+func parse(le *lexer.Lexer, mode Mode) (block *ast.Block, err error) {
+	p := &parser{Lexer: le, mode: mode}
+	if mode&RecoverErrors != 0 {
+		le.SetErrorHandler(p.report)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if synErr, ok := r.(*lexer.SyntaxError); ok {
+				block, err = nil, synErr
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	block = parseChunk(p)
+	if mode&FoldConstants != 0 {
+		foldBlock(block)
+	}
+	if len(p.errors) > 0 {
+		return block, p.errors.sorted()
+	}
+	return block, nil
+}
+
+func parseChunk(le *parser) *ast.Block {
 	block := parseBlock(le)
-	le.NextTokenOfKind(lexer.TOKEN_EOF)
+	if le.mode&RecoverErrors == 0 {
+		le.NextTokenOfKind(lexer.TOKEN_EOF)
+		return block
+	}
+	//多出来的end、until之类的关键字：跳过它接着解析后面的语句
+	for le.LookAhead() != lexer.TOKEN_EOF {
+		le.statErrors = len(le.errors)
+		le.report(le.LookAheadError("'%s' expected", lexer.TokenName(lexer.TOKEN_EOF)))
+		le.NextToken()
+		block.Stats = append(block.Stats, &ast.BadStat{Span: _tokenSpan(le)})
+		rest := parseBlock(le)
+		block.Stats = append(block.Stats, rest.Stats...)
+		if rest.RetExps != nil {
+			block.RetExps = rest.RetExps
+		}
+		block.LastLine = rest.LastLine
+		block.Span = _spanFrom(le, block.Pos)
+	}
 	return block
 }
 
-func parseBlock(le *lexer.Lexer) *ast.Block {
-	return &ast.Block{
+func parseBlock(le *parser) *ast.Block {
+	start := le.LookAheadPos()
+	block := &ast.Block{
 		Stats:    parseStats(le),
 		RetExps:  parseRetExps(le),
 		LastLine: le.Line(),
 	}
+	block.Span = _spanFrom(le, start)
+	return block
+}
+
+// _spanFrom 从start到当前token的终点，中间一个token都没有读时是空区间
+func _spanFrom(le *parser, start ast.Pos) ast.Span {
+	end := le.TokenEnd()
+	if end.Offset < start.Offset {
+		end = start
+	}
+	return ast.Span{Pos: start, End: end}
+}
+
+// _tokenSpan 当前token的区间
+func _tokenSpan(le *parser) ast.Span {
+	return ast.Span{Pos: le.TokenStart(), End: le.TokenEnd()}
 }
 
-func parseStats(lexer *lexer.Lexer) []ast.Stat {
+func parseStats(le *parser) []ast.Stat {
 	stats := make([]ast.Stat, 0, 8)
-	for !_isReturnOrBlockEnd(lexer.LookAhead()) {
-		stat := parseStat(lexer)
+	for !_isReturnOrBlockEnd(le.LookAhead()) {
+		var stat ast.Stat
+		if le.mode&RecoverErrors != 0 {
+			stat = parseStatRecover(le)
+		} else {
+			stat = parseStat(le)
+		}
 		if _, ok := stat.(*ast.EmptyStat); !ok {
 			stats = append(stats, stat)
 		}
@@ -40,15 +140,28 @@ func _isReturnOrBlockEnd(tokenKind int) bool {
 	return false
 }
 
-func parseRetExps(le *lexer.Lexer) []ast.Exp {
+func parseRetExps(le *parser) []ast.Exp {
 	if le.LookAhead() != lexer.TOKEN_KW_RETURN {
 		return nil
 	}
 	le.NextToken()
+	if le.mode&RecoverErrors != 0 {
+		var exps []ast.Exp
+		start := le.LookAheadPos()
+		if le.protect(func() { exps = _parseRetExpList(le) }) {
+			return exps
+		}
+		return []ast.Exp{&ast.BadExp{Span: _spanFrom(le, start), Line: le.Line()}}
+	}
+	return _parseRetExpList(le)
+}
+
+func _parseRetExpList(le *parser) []ast.Exp {
 	switch le.LookAhead() {
 	case lexer.TOKEN_EOF, lexer.TOKEN_KW_END, lexer.TOKEN_KW_ELSE, lexer.TOKEN_KW_ELSEIF, lexer.TOKEN_KW_UNTIL:
 		return []ast.Exp{}
 	case lexer.TOKEN_SEP_SEMI:
+		le.NextToken()
 		return []ast.Exp{}
 	default:
 		exps := parseExpList(le)
@@ -57,10 +170,9 @@ func parseRetExps(le *lexer.Lexer) []ast.Exp {
 		}
 		return exps
 	}
-	return nil
 }
 
-func parseExpList(le *lexer.Lexer) []ast.Exp {
+func parseExpList(le *parser) []ast.Exp {
 	exps := make([]ast.Exp, 0, 4)
 	exps = append(exps, parseExp(le))
 	for le.LookAhead() == lexer.TOKEN_SEP_COMMA {
@@ -70,7 +182,7 @@ func parseExpList(le *lexer.Lexer) []ast.Exp {
 	return exps
 }
 
-func parseStat(le *lexer.Lexer) ast.Stat {
+func parseStat(le *parser) ast.Stat {
 	switch le.LookAhead() {
 	case lexer.TOKEN_SEP_SEMI:
 		return parseEmptyStat(le)
@@ -99,58 +211,64 @@ func parseStat(le *lexer.Lexer) ast.Stat {
 	}
 }
 
-func parseEmptyStat(le *lexer.Lexer) *ast.EmptyStat {
+func parseEmptyStat(le *parser) *ast.EmptyStat {
 	le.NextTokenOfKind(lexer.TOKEN_SEP_SEMI)
-	return &ast.EmptyStat{}
+	return &ast.EmptyStat{Span: _tokenSpan(le)}
 }
 
-func parseBreakStat(le *lexer.Lexer) *ast.BreakStat {
+func parseBreakStat(le *parser) *ast.BreakStat {
 	le.NextTokenOfKind(lexer.TOKEN_KW_BREAK)
-	return &ast.BreakStat{le.Line()}
+	return &ast.BreakStat{Span: _tokenSpan(le), Line: le.Line()}
 }
 
-func parseLabelStat(le *lexer.Lexer) *ast.LabelStat {
+func parseLabelStat(le *parser) *ast.LabelStat {
 	le.NextTokenOfKind(lexer.TOKEN_SEP_LABEL)
-	_, name := le.NextIdentifier()
+	start := le.TokenStart()
+	line, name := le.NextIdentifier()
 	le.NextTokenOfKind(lexer.TOKEN_SEP_LABEL)
-	return &ast.LabelStat{name}
+	return &ast.LabelStat{Span: _spanFrom(le, start), Line: line, Name: name}
 }
 
-func parseGoToStat(le *lexer.Lexer) *ast.GotoStat {
-	le.NextTokenOfKind(lexer.TOKEN_KW_GOTO)
+func parseGoToStat(le *parser) *ast.GotoStat {
+	line, _ := le.NextTokenOfKind(lexer.TOKEN_KW_GOTO)
+	start := le.TokenStart()
 	_, name := le.NextIdentifier()
-	return &ast.GotoStat{name}
+	return &ast.GotoStat{Span: _spanFrom(le, start), Line: line, Name: name}
 }
 
-func parseDoStat(le *lexer.Lexer) *ast.DoStat {
+func parseDoStat(le *parser) *ast.DoStat {
 	le.NextTokenOfKind(lexer.TOKEN_KW_DO)
+	start := le.TokenStart()
 	block := parseBlock(le)
 	le.NextTokenOfKind(lexer.TOKEN_KW_END)
-	return &ast.DoStat{block}
+	return &ast.DoStat{Span: _spanFrom(le, start), Block: block}
 }
 
-func parseWhileStat(le *lexer.Lexer) *ast.WhileStat {
+func parseWhileStat(le *parser) *ast.WhileStat {
 	le.NextTokenOfKind(lexer.TOKEN_KW_WHILE)
+	start := le.TokenStart()
 	exp := parseExp(le)
 	le.NextTokenOfKind(lexer.TOKEN_KW_DO)
 	block := parseBlock(le)
 	le.NextTokenOfKind(lexer.TOKEN_KW_END)
-	return &ast.WhileStat{exp, block}
+	return &ast.WhileStat{Span: _spanFrom(le, start), Exp: exp, Block: block}
 }
 
-func parseRepeatStat(le *lexer.Lexer) *ast.RepeatStat {
+func parseRepeatStat(le *parser) *ast.RepeatStat {
 	le.NextTokenOfKind(lexer.TOKEN_KW_REPEAT)
+	start := le.TokenStart()
 	block := parseBlock(le)
 	le.NextTokenOfKind(lexer.TOKEN_KW_UNTIL)
 	exp := parseExp(le)
-	return &ast.RepeatStat{block, exp}
+	return &ast.RepeatStat{Span: _spanFrom(le, start), Block: block, Exp: exp}
 }
 
-func parseIfStat(le *lexer.Lexer) *ast.IfStat {
+func parseIfStat(le *parser) *ast.IfStat {
 	exps := make([]ast.Exp, 0, 4)
 	blocks := make([]*ast.Block, 0, 4)
 
 	le.NextTokenOfKind(lexer.TOKEN_KW_IF)
+	start := le.TokenStart()
 	exps = append(exps, parseExp(le))
 	le.NextTokenOfKind(lexer.TOKEN_KW_THEN)
 	blocks = append(blocks, parseBlock(le))
@@ -164,24 +282,26 @@ func parseIfStat(le *lexer.Lexer) *ast.IfStat {
 
 	if le.LookAhead() == lexer.TOKEN_KW_ELSE {
 		le.NextToken()
-		exps = append(exps, &ast.TrueExp{le.Line()})
+		exps = append(exps, &ast.TrueExp{Span: _tokenSpan(le), Line: le.Line()})
 		blocks = append(blocks, parseBlock(le))
 	}
 	le.NextTokenOfKind(lexer.TOKEN_KW_END)
-	return &ast.IfStat{exps, blocks}
+	return &ast.IfStat{Span: _spanFrom(le, start), Exps: exps, Blocks: blocks}
 }
 
-func parseForStat(le *lexer.Lexer) ast.Stat {
+func parseForStat(le *parser) ast.Stat {
 	lineOfFor, _ := le.NextTokenOfKind(lexer.TOKEN_KW_FOR)
+	start := le.TokenStart()
 	_, name := le.NextIdentifier()
+	nameSpan := _tokenSpan(le)
 	if le.LookAhead() == lexer.TOKEN_OP_ASSIGN {
-		return _finishForNumStat(le, lineOfFor, name)
+		return _finishForNumStat(le, start, lineOfFor, name, nameSpan)
 	} else {
-		return _finishForInStat(le, lineOfFor, name)
+		return _finishForInStat(le, start, name, nameSpan)
 	}
 }
 
-func _finishForNumStat(le *lexer.Lexer, lineOfFor int, varName string) *ast.ForNumStat {
+func _finishForNumStat(le *parser, start ast.Pos, lineOfFor int, varName string, varSpan ast.Span) *ast.ForNumStat {
 	le.NextTokenOfKind(lexer.TOKEN_OP_ASSIGN)
 	initExp := parseExp(le)
 	le.NextTokenOfKind(lexer.TOKEN_SEP_COMMA)
@@ -192,16 +312,19 @@ func _finishForNumStat(le *lexer.Lexer, lineOfFor int, varName string) *ast.ForN
 		le.NextToken()
 		stepExp = parseExp(le)
 	} else {
-		stepExp = &ast.IntegerExp{le.Line(), 1}
+		end := le.TokenEnd()
+		stepExp = &ast.IntegerExp{Span: ast.Span{Pos: end, End: end}, Line: le.Line(), Val: 1}
 	}
 	lineOfDo, _ := le.NextTokenOfKind(lexer.TOKEN_KW_DO)
 	block := parseBlock(le)
 	le.NextTokenOfKind(lexer.TOKEN_KW_END)
 
 	return &ast.ForNumStat{
+		Span:      _spanFrom(le, start),
 		LineOfFor: lineOfFor,
 		LineOfDo:  lineOfDo,
 		VarName:   varName,
+		VarSpan:   varSpan,
 		InitExp:   initExp,
 		LimitExp:  limitExp,
 		StepExp:   stepExp,
@@ -209,73 +332,81 @@ func _finishForNumStat(le *lexer.Lexer, lineOfFor int, varName string) *ast.ForN
 	}
 }
 
-func _finishForInStat(le *lexer.Lexer, lineOfFor int, varName string) *ast.ForInStat {
-	nameList := _finishNameList(le, varName)
+func _finishForInStat(le *parser, start ast.Pos, varName string, varSpan ast.Span) *ast.ForInStat {
+	nameList, nameSpans := _finishNameList(le, varName, varSpan)
 	le.NextTokenOfKind(lexer.TOKEN_KW_IN)
 	expList := parseExpList(le)
 	lineOfDo, _ := le.NextTokenOfKind(lexer.TOKEN_KW_DO)
 	block := parseBlock(le)
 	le.NextTokenOfKind(lexer.TOKEN_KW_END)
-	return &ast.ForInStat{lineOfDo, nameList, expList, block}
+	return &ast.ForInStat{Span: _spanFrom(le, start), LineOfDo: lineOfDo, NameList: nameList, NameSpans: nameSpans, ExpList: expList, Block: block}
 }
 
-func _finishNameList(le *lexer.Lexer, name0 string) []string {
-	names := []string{name0}
-	if le.LookAhead() == lexer.TOKEN_SEP_COMMA {
+func _finishNameList(le *parser, name0 string, span0 ast.Span) ([]string, []ast.Span) {
+	names, spans := []string{name0}, []ast.Span{span0}
+	for le.LookAhead() == lexer.TOKEN_SEP_COMMA {
 		le.NextToken()
 		_, name := le.NextIdentifier()
 		names = append(names, name)
+		spans = append(spans, _tokenSpan(le))
 	}
-	return names
+	return names, spans
 }
 
-func parseLocalAssignOrFuncDefStat(le *lexer.Lexer) ast.Stat {
+func parseLocalAssignOrFuncDefStat(le *parser) ast.Stat {
 	le.NextTokenOfKind(lexer.TOKEN_KW_LOCAL)
+	start := le.TokenStart()
 	if le.LookAhead() == lexer.TOKEN_KW_FUNCTION {
-		return _finishLocalFuncDefStat(le)
+		return _finishLocalFuncDefStat(le, start)
 	} else {
-		return _finishLocalVarDeclStat(le)
+		return _finishLocalVarDeclStat(le, start)
 	}
 }
 
-func _finishLocalFuncDefStat(le *lexer.Lexer) *ast.LocalFuncDefStat {
+func _finishLocalFuncDefStat(le *parser, start ast.Pos) *ast.LocalFuncDefStat {
 	le.NextTokenOfKind(lexer.TOKEN_KW_FUNCTION)
+	fnStart := le.TokenStart()
 	_, name := le.NextIdentifier()
-	fsExp := parseFuncDefExp(le)
-	return &ast.LocalFuncDefStat{name, fsExp}
+	nameSpan := _tokenSpan(le)
+	fsExp := parseFuncDefExp(le, fnStart)
+	return &ast.LocalFuncDefStat{Span: _spanFrom(le, start), Name: name, NameSpan: nameSpan, Exp: fsExp}
 }
 
-func _finishLocalVarDeclStat(le *lexer.Lexer) *ast.LocalVarDeclStat {
+func _finishLocalVarDeclStat(le *parser, start ast.Pos) *ast.LocalVarDeclStat {
 	_, name0 := le.NextIdentifier()
-	nameList := _finishNameList(le, name0)
+	nameList, nameSpans := _finishNameList(le, name0, _tokenSpan(le))
 	var expList []ast.Exp = nil
 	if le.LookAhead() == lexer.TOKEN_OP_ASSIGN {
 		le.NextToken()
 		expList = parseExpList(le)
 	}
 	lastLine := le.Line()
-	return &ast.LocalVarDeclStat{lastLine, nameList, expList}
+	return &ast.LocalVarDeclStat{Span: _spanFrom(le, start), LastLine: lastLine, NameList: nameList, NameSpans: nameSpans, ExpList: expList}
 }
 
-func parseAssignOrCallStat(le *lexer.Lexer) ast.Stat {
+func parseAssignOrCallStat(le *parser) ast.Stat {
+	start := le.LookAheadPos()
 	prefixExp := parsePrefixExp(le)
-	if fc, ok := prefixExp.(*ast.FuncCallExp); ok {
+	if fc, ok := prefixExp.(*ast.FuncCallExp); ok && !_isAssignFollow(le.LookAhead()) {
 		return fc
 	} else {
-		return parseAssignStat(le, prefixExp)
+		return parseAssignStat(le, start, prefixExp)
 	}
 }
 
-func parseAssignStat(le *lexer.Lexer, var0 ast.Exp) *ast.AssignStat {
+func _isAssignFollow(tokenKind int) bool {
+	return tokenKind == lexer.TOKEN_OP_ASSIGN || tokenKind == lexer.TOKEN_SEP_COMMA
+}
+
+func parseAssignStat(le *parser, start ast.Pos, var0 ast.Exp) *ast.AssignStat {
 	varList := _finishVarList(le, var0)
 	le.NextTokenOfKind(lexer.TOKEN_OP_ASSIGN)
 	expList := parseExpList(le)
 	lastLine := le.Line()
-	return &ast.AssignStat{lastLine, varList, expList}
-
+	return &ast.AssignStat{Span: _spanFrom(le, start), LastLine: lastLine, VarList: varList, ExpList: expList}
 }
 
-func _finishVarList(le *lexer.Lexer, var0 ast.Exp) []ast.Exp {
+func _finishVarList(le *parser, var0 ast.Exp) []ast.Exp {
 	vars := []ast.Exp{_checkVar(le, var0)}
 	for le.LookAhead() == lexer.TOKEN_SEP_COMMA {
 		le.NextToken()
@@ -285,80 +416,89 @@ func _finishVarList(le *lexer.Lexer, var0 ast.Exp) []ast.Exp {
 	return vars
 }
 
-func _checkVar(le *lexer.Lexer, exp ast.Exp) ast.Exp {
+func _checkVar(le *parser, exp ast.Exp) ast.Exp {
 	switch exp.(type) {
 	case *ast.NameExp, *ast.TableAccessExp:
 		return exp
 	}
-	le.NextTokenOfKind(-1)
+	le.NextToken()
+	le.Error("syntax error")
 	panic("unreachable!!!!")
 }
 
-func parseFuncDefStat(le *lexer.Lexer) *ast.AssignStat {
+func parseFuncDefStat(le *parser) *ast.AssignStat {
 	le.NextTokenOfKind(lexer.TOKEN_KW_FUNCTION)
+	start := le.TokenStart()
 	fnExp, hasColon := _parseFuncName(le)
-	fdExp := parseFuncDefExp(le)
+	fdExp := parseFuncDefExp(le, start)
 	if hasColon {
 		fdExp.ParList = append(fdExp.ParList, "")
 		copy(fdExp.ParList[1:], fdExp.ParList)
 		fdExp.ParList[0] = "self"
+		fdExp.ParSpans = append([]ast.Span{ast.SpanOf(fnExp.(*ast.TableAccessExp).KeyExp)}, fdExp.ParSpans...)
 	}
 	return &ast.AssignStat{
+		Span:     fdExp.Span,
 		LastLine: fdExp.Line,
 		VarList:  []ast.Exp{fnExp},
 		ExpList:  []ast.Exp{fdExp},
 	}
 }
 
-func _parseFuncName(le *lexer.Lexer) (exp ast.Exp, hasColon bool) {
+func _parseFuncName(le *parser) (exp ast.Exp, hasColon bool) {
 	line, name := le.NextIdentifier()
-	exp = &ast.NameExp{line, name}
-	for le.LookAhead() == lexer.TOKEN_SEP_COMMA {
+	start := le.TokenStart()
+	exp = &ast.NameExp{Span: _tokenSpan(le), Line: line, Name: name}
+	for le.LookAhead() == lexer.TOKEN_SEP_DOT {
 		le.NextToken()
 		line, name := le.NextIdentifier()
-		idx := &ast.StringExp{line, name}
-		exp = &ast.TableAccessExp{line, exp, idx}
+		idx := &ast.StringExp{Span: _tokenSpan(le), Line: line, Val: name}
+		exp = &ast.TableAccessExp{Span: _spanFrom(le, start), LastLine: line, PrefixExp: exp, KeyExp: idx}
 	}
-	if le.LookAhead() == lexer.TOKEN_SEP_COMMA {
+	if le.LookAhead() == lexer.TOKEN_SEP_COLON {
 		le.NextToken()
 		line, name := le.NextIdentifier()
-		idx := &ast.StringExp{line, name}
-		exp = &ast.TableAccessExp{line, exp, idx}
+		idx := &ast.StringExp{Span: _tokenSpan(le), Line: line, Val: name}
+		exp = &ast.TableAccessExp{Span: _spanFrom(le, start), LastLine: line, PrefixExp: exp, KeyExp: idx}
 		hasColon = true
 	}
 	return
 }
 
-//========================================================= Exp ===============================================
-func parseExp(le *lexer.Lexer) ast.Exp {
+// ========================================================= Exp ===============================================
+func parseExp(le *parser) ast.Exp {
 	return parseExp12(le)
 }
 
-func parseExp12(le *lexer.Lexer) ast.Exp {
+func parseExp12(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp11(le)
 	for le.LookAhead() == lexer.TOKEN_OP_OR {
 		line, op, _ := le.NextToken()
-		_exp := &ast.BinopExp{line, op, exp, parseExp11(le)}
-		exp = optimizeLogicalOr(_exp)
+		exp2 := parseExp11(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
-func parseExp11(le *lexer.Lexer) ast.Exp {
+func parseExp11(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp10(le)
 	for le.LookAhead() == lexer.TOKEN_OP_AND {
 		line, op, _ := le.NextToken()
-		_exp := &ast.BinopExp{line, op, exp, parseExp10(le)}
-		exp = optimizeLogicalAnd(_exp)
+		exp2 := parseExp10(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
-func parseExp10(le *lexer.Lexer) ast.Exp {
+func parseExp10(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp9(le)
 	for isExp10Op(le.LookAhead()) {
 		line, op, _ := le.NextToken()
-		exp = &ast.BinopExp{line, op, exp, parseExp9(le)}
+		exp2 := parseExp9(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
@@ -372,48 +512,54 @@ func isExp10Op(opType int) bool {
 }
 
 // A | B
-func parseExp9(le *lexer.Lexer) ast.Exp {
+func parseExp9(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp8(le)
 	for le.LookAhead() == lexer.TOKEN_OP_BOR {
 		line, op, _ := le.NextToken()
-		_exp := &ast.BinopExp{line, op, exp, parseExp8(le)}
-		exp = optimizeBitwiseBinaryOp(_exp)
+		exp2 := parseExp8(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
-func parseExp8(le *lexer.Lexer) ast.Exp {
+func parseExp8(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp7(le)
 	for le.LookAhead() == lexer.TOKEN_OP_WAVE {
 		line, op, _ := le.NextToken()
-		exp = &ast.BinopExp{line, op, exp, parseExp7(le)}
+		exp2 := parseExp7(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
 // A & B
-func parseExp7(le *lexer.Lexer) ast.Exp {
+func parseExp7(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp6(le)
 	for le.LookAhead() == lexer.TOKEN_OP_BAND {
 		line, op, _ := le.NextToken()
-		_exp := &ast.BinopExp{line, op, exp, parseExp6(le)}
-		exp = optimizeBitwiseBinaryOp(_exp)
+		exp2 := parseExp6(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
 // A << B , A >>B
-func parseExp6(le *lexer.Lexer) ast.Exp {
+func parseExp6(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp5(le)
 	for le.LookAhead() == lexer.TOKEN_OP_SHR || le.LookAhead() == lexer.TOKEN_OP_SHL {
 		line, op, _ := le.NextToken()
-		_exp := &ast.BinopExp{line, op, exp, parseExp5(le)}
-		exp = optimizeBitwiseBinaryOp(_exp)
+		exp2 := parseExp5(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
-func parseExp5(le *lexer.Lexer) ast.Exp {
+func parseExp5(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp4(le)
 	if le.LookAhead() != lexer.TOKEN_OP_CONCAT {
 		return exp
@@ -424,116 +570,124 @@ func parseExp5(le *lexer.Lexer) ast.Exp {
 		line, _, _ = le.NextToken()
 		exps = append(exps, parseExp4(le))
 	}
-	return &ast.ConcatExp{line, exps}
+	return &ast.ConcatExp{Span: _spanFrom(le, start), Line: line, Exps: exps}
 }
 
 // A + B,  A - B
-func parseExp4(le *lexer.Lexer) ast.Exp {
+func parseExp4(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp3(le)
-	if le.LookAhead() == lexer.TOKEN_OP_ADD || le.LookAhead() == lexer.TOKEN_OP_MINUS {
+	for le.LookAhead() == lexer.TOKEN_OP_ADD || le.LookAhead() == lexer.TOKEN_OP_MINUS {
 		line, op, _ := le.NextToken()
-		_exp := &ast.BinopExp{line, op, exp, parseExp3(le)}
-		exp = optimizeArithBinaryOp(_exp)
+		exp2 := parseExp3(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
-func parseExp3(le *lexer.Lexer) ast.Exp {
+func parseExp3(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp2(le)
 	for le.LookAhead() == lexer.TOKEN_OP_MUL || le.LookAhead() == lexer.TOKEN_OP_DIV || le.LookAhead() == lexer.TOKEN_OP_IDIV || le.LookAhead() == lexer.TOKEN_OP_MOD {
 		line, op, _ := le.NextToken()
-		_exp := &ast.BinopExp{line, op, exp, parseExp2(le)}
-		exp = optimizeArithBinaryOp(_exp)
+		exp2 := parseExp2(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
-func parseExp2(le *lexer.Lexer) ast.Exp {
+func parseExp2(le *parser) ast.Exp {
 	switch le.LookAhead() {
 	case lexer.TOKEN_OP_LEN, lexer.TOKEN_OP_NOT, lexer.TOKEN_OP_MINUS, lexer.TOKEN_OP_BNOT:
 		line, op, _ := le.NextToken()
-		exp := &ast.UnopExp{line, op, parseExp2(le)}
-		return optimizeUnaryOp(exp)
+		start := le.TokenStart()
+		exp := &ast.UnopExp{Line: line, Op: op, Exp: parseExp2(le)}
+		exp.Span = _spanFrom(le, start)
+		return exp
 	}
 	return parseExp1(le)
 }
 
-func parseExp1(le *lexer.Lexer) ast.Exp {
+func parseExp1(le *parser) ast.Exp {
+	start := le.LookAheadPos()
 	exp := parseExp0(le)
 	if le.LookAhead() == lexer.TOKEN_OP_POW {
 		line, op, _ := le.NextToken()
-		exp = &ast.BinopExp{line, op, exp, parseExp1(le)}
-		exp = optimizePow(exp)
+		exp2 := parseExp2(le)
+		exp = &ast.BinopExp{Span: _spanFrom(le, start), Line: line, Op: op, Exp1: exp, Exp2: exp2}
 	}
 	return exp
 }
 
-func parseExp0(le *lexer.Lexer) ast.Exp {
+func parseExp0(le *parser) ast.Exp {
 	switch le.LookAhead() {
 	case lexer.TOKEN_VARARG:
 		line, _, _ := le.NextToken()
-		return &ast.VarargExp{line}
+		return &ast.VarargExp{Span: _tokenSpan(le), Line: line}
 	case lexer.TOKEN_KW_NIL:
 		line, _, _ := le.NextToken()
-		return &ast.NilExp{line}
+		return &ast.NilExp{Span: _tokenSpan(le), Line: line}
 	case lexer.TOKEN_KW_FALSE:
 		line, _, _ := le.NextToken()
-		return &ast.FalseExp{line}
+		return &ast.FalseExp{Span: _tokenSpan(le), Line: line}
 	case lexer.TOKEN_KW_TRUE:
 		line, _, _ := le.NextToken()
-		return &ast.TrueExp{line}
+		return &ast.TrueExp{Span: _tokenSpan(le), Line: line}
 	case lexer.TOKEN_STRING:
 		line, _, str := le.NextToken()
-		return &ast.StringExp{line, str}
+		return &ast.StringExp{Span: _tokenSpan(le), Line: line, Val: str}
 	case lexer.TOKEN_NUMBER:
 		return parseNumberExp(le)
 	case lexer.TOKEN_SEP_LCURLY:
 		return parseTableConstructorExp(le)
 	case lexer.TOKEN_KW_FUNCTION:
 		le.NextToken()
-		return parseFuncDefExp(le)
+		return parseFuncDefExp(le, le.TokenStart())
 	default:
 		return parsePrefixExp(le)
 	}
 }
 
-func parseNumberExp(le *lexer.Lexer) ast.Exp {
+func parseNumberExp(le *parser) ast.Exp {
 	line, _, token := le.NextToken()
 	if i, ok := number.ParseInteger(token); ok {
-		return &ast.IntegerExp{line, i}
+		return &ast.IntegerExp{Span: _tokenSpan(le), Line: line, Val: i}
 	} else if f, ok := number.ParseFloat(token); ok {
-		return &ast.FloatExp{line, f}
+		return &ast.FloatExp{Span: _tokenSpan(le), Line: line, Val: f}
 	} else {
-		panic("not a number: " + token)
+		le.Error("malformed number")
+		return nil
 	}
 }
 
-
-
-func parseFuncDefExp(le *lexer.Lexer) *ast.FuncDefExp {
+// parseFuncDefExp 解析函数的参数列表和函数体，start是function关键字的起点
+func parseFuncDefExp(le *parser, start ast.Pos) *ast.FuncDefExp {
 	line := le.Line()
 	le.NextTokenOfKind(lexer.TOKEN_SEP_LPAREN)
-	parList, isVararg := _parseParList(le)
+	parList, parSpans, isVararg := _parseParList(le)
 	le.NextTokenOfKind(lexer.TOKEN_SEP_RPAREN)
 	block := parseBlock(le)
 	lastLine, _ := le.NextTokenOfKind(lexer.TOKEN_KW_END)
-	return &ast.FuncDefExp{line, lastLine, parList, isVararg, block}
+	return &ast.FuncDefExp{Span: _spanFrom(le, start), Line: line, LastLine: lastLine, ParList: parList, ParSpans: parSpans, IsVararg: isVararg, Block: block}
 }
 
-func _parseParList(le *lexer.Lexer) (names []string, isVararg bool) {
+func _parseParList(le *parser) (names []string, spans []ast.Span, isVararg bool) {
 	switch le.LookAhead() {
 	case lexer.TOKEN_SEP_RPAREN:
-		return nil, false
+		return nil, nil, false
 	case lexer.TOKEN_VARARG:
-		return nil, true
+		le.NextToken()
+		return nil, nil, true
 	}
 	_, name := le.NextIdentifier()
 	names = append(names, name)
+	spans = append(spans, _tokenSpan(le))
 	for le.LookAhead() == lexer.TOKEN_SEP_COMMA {
 		le.NextToken()
 		if le.LookAhead() == lexer.TOKEN_IDENTIFIER {
 			_, name := le.NextIdentifier()
 			names = append(names, name)
+			spans = append(spans, _tokenSpan(le))
 		} else {
 			le.NextTokenOfKind(lexer.TOKEN_VARARG)
 			isVararg = true
@@ -543,16 +697,17 @@ func _parseParList(le *lexer.Lexer) (names []string, isVararg bool) {
 	return
 }
 
-func parseTableConstructorExp(le *lexer.Lexer) *ast.TableConstructorExp {
+func parseTableConstructorExp(le *parser) *ast.TableConstructorExp {
 	line := le.Line()
 	le.NextTokenOfKind(lexer.TOKEN_SEP_LCURLY)
+	start := le.TokenStart()
 	ks, vs := _parseFieldList(le)
 	le.NextTokenOfKind(lexer.TOKEN_SEP_RCURLY)
 	lastLine := le.Line()
-	return &ast.TableConstructorExp{line, lastLine, ks, vs}
+	return &ast.TableConstructorExp{Span: _spanFrom(le, start), Line: line, LastLine: lastLine, KeyExps: ks, ValExps: vs}
 }
 
-func _parseFieldList(le *lexer.Lexer) (ks, vs []ast.Exp) {
+func _parseFieldList(le *parser) (ks, vs []ast.Exp) {
 	if le.LookAhead() != lexer.TOKEN_SEP_RCURLY {
 		k, v := _parseField(le)
 		ks = append(ks, k)
@@ -575,7 +730,7 @@ func _isFieldSep(tokenKind int) bool {
 	return tokenKind == lexer.TOKEN_SEP_COMMA || tokenKind == lexer.TOKEN_SEP_SEMI
 }
 
-func _parseField(le *lexer.Lexer) (k, v ast.Exp) {
+func _parseField(le *parser) (k, v ast.Exp) {
 	if le.LookAhead() == lexer.TOKEN_SEP_LBRACK {
 		le.NextToken()
 		k = parseExp(le)
@@ -586,26 +741,36 @@ func _parseField(le *lexer.Lexer) (k, v ast.Exp) {
 	}
 	exp := parseExp(le)
 	if nameExp, ok := exp.(*ast.NameExp); ok {
-		le.NextToken()
-		k = &ast.StringExp{nameExp.Line, nameExp.Name}
-		v = parseExp(le)
-		return
+		if le.LookAhead() == lexer.TOKEN_OP_ASSIGN {
+			le.NextToken()
+			k = &ast.StringExp{Span: nameExp.Span, Line: nameExp.Line, Val: nameExp.Name}
+			v = parseExp(le)
+			return
+		}
 	}
 	return nil, exp
 }
 
-func parsePrefixExp(le *lexer.Lexer) ast.Exp {
+func parsePrefixExp(le *parser) ast.Exp {
 	var exp ast.Exp
-	if le.LookAhead() == lexer.TOKEN_IDENTIFIER {
+	start := le.LookAheadPos()
+	switch le.LookAhead() {
+	case lexer.TOKEN_IDENTIFIER:
 		line, name := le.NextIdentifier()
-		exp = &ast.NameExp{line, name}
-	} else {
+		exp = &ast.NameExp{Span: _tokenSpan(le), Line: line, Name: name}
+	case lexer.TOKEN_SEP_LPAREN:
 		exp = parseParensExp(le)
+	default:
+		if le.mode&RecoverErrors != 0 {
+			return parseBadExp(le)
+		}
+		le.NextToken()
+		le.Error("unexpected symbol")
 	}
-	return _finishPrefixExp(le, exp)
+	return _finishPrefixExp(le, start, exp)
 }
 
-func _finishPrefixExp(le *lexer.Lexer, exp ast.Exp) ast.Exp {
+func _finishPrefixExp(le *parser, start ast.Pos, exp ast.Exp) ast.Exp {
 	for {
 		tokenType := le.LookAhead()
 		switch tokenType {
@@ -613,50 +778,50 @@ func _finishPrefixExp(le *lexer.Lexer, exp ast.Exp) ast.Exp {
 			le.NextToken()
 			keyExp := parseExp(le)
 			le.NextTokenOfKind(lexer.TOKEN_SEP_RBRACK)
-			exp = &ast.TableAccessExp{le.Line(), exp, keyExp}
+			exp = &ast.TableAccessExp{Span: _spanFrom(le, start), LastLine: le.Line(), PrefixExp: exp, KeyExp: keyExp}
 		case lexer.TOKEN_SEP_DOT:
 			le.NextToken()
 			line, name := le.NextIdentifier()
-			keyExp := &ast.StringExp{line, name}
-			exp = &ast.TableAccessExp{le.Line(), exp, keyExp}
+			keyExp := &ast.StringExp{Span: _tokenSpan(le), Line: line, Val: name}
+			exp = &ast.TableAccessExp{Span: _spanFrom(le, start), LastLine: le.Line(), PrefixExp: exp, KeyExp: keyExp}
 		case lexer.TOKEN_SEP_COLON, lexer.TOKEN_SEP_LPAREN, lexer.TOKEN_SEP_LCURLY, lexer.TOKEN_STRING:
-			exp = _finishFuncCallExp(le, exp)
+			exp = _finishFuncCallExp(le, start, exp)
 		default:
 			return exp
 		}
 	}
-	return exp
 }
 
-func parseParensExp(le *lexer.Lexer) ast.Exp {
+func parseParensExp(le *parser) ast.Exp {
 	le.NextTokenOfKind(lexer.TOKEN_SEP_LPAREN)
+	start := le.TokenStart()
 	exp := parseExp(le)
 	le.NextTokenOfKind(lexer.TOKEN_SEP_RPAREN)
 	switch exp.(type) {
 	case *ast.VarargExp, *ast.FuncCallExp, *ast.NameExp, *ast.TableAccessExp:
-		return &ast.ParensExp{exp}
+		return &ast.ParensExp{Span: _spanFrom(le, start), Exp: exp}
 	}
 	return exp
 }
 
-func _finishFuncCallExp(le *lexer.Lexer, prefixExp ast.Exp) *ast.FuncCallExp {
+func _finishFuncCallExp(le *parser, start ast.Pos, prefixExp ast.Exp) *ast.FuncCallExp {
 	nameExp := _parseNameExp(le)
 	line := le.Line()
 	args := _parseArgs(le)
 	lastLine := le.Line()
-	return &ast.FuncCallExp{line, lastLine, prefixExp, nameExp, args}
+	return &ast.FuncCallExp{Span: _spanFrom(le, start), Line: line, LastLine: lastLine, PrefixExp: prefixExp, NameExp: nameExp, Args: args}
 }
 
-func _parseNameExp(le *lexer.Lexer) *ast.StringExp {
+func _parseNameExp(le *parser) *ast.StringExp {
 	if le.LookAhead() == lexer.TOKEN_SEP_COLON {
 		le.NextToken()
 		line, name := le.NextIdentifier()
-		return &ast.StringExp{line, name}
+		return &ast.StringExp{Span: _tokenSpan(le), Line: line, Val: name}
 	}
 	return nil
 }
 
-func _parseArgs(le *lexer.Lexer) (args []ast.Exp) {
+func _parseArgs(le *parser) (args []ast.Exp) {
 	switch le.LookAhead() {
 	case lexer.TOKEN_SEP_LPAREN:
 		le.NextToken()
@@ -666,14 +831,17 @@ func _parseArgs(le *lexer.Lexer) (args []ast.Exp) {
 		le.NextTokenOfKind(lexer.TOKEN_SEP_RPAREN)
 	case lexer.TOKEN_SEP_LCURLY:
 		args = []ast.Exp{parseTableConstructorExp(le)}
+	case lexer.TOKEN_STRING:
+		line, _, str := le.NextToken()
+		args = []ast.Exp{&ast.StringExp{Span: _tokenSpan(le), Line: line, Val: str}}
 	default:
-		line, str := le.NextTokenOfKind(lexer.TOKEN_STRING)
-		args = []ast.Exp{&ast.StringExp{line, str}}
+		le.NextToken()
+		le.Error("function arguments expected")
 	}
 	return
 }
 
-//{{{{{{{ 优化相关
+// {{{{{{{ 优化相关
 func optimizeLogicalOr(exp *ast.BinopExp) ast.Exp {
 	if isTrue(exp.Exp1) {
 		return exp.Exp1 // true or x => true
@@ -699,15 +867,15 @@ func optimizeBitwiseBinaryOp(exp *ast.BinopExp) ast.Exp {
 		if j, ok := castToInt(exp.Exp2); ok {
 			switch exp.Op {
 			case lexer.TOKEN_OP_BAND:
-				return &ast.IntegerExp{exp.Line, i & j}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: i & j}
 			case lexer.TOKEN_OP_BOR:
-				return &ast.IntegerExp{exp.Line, i | j}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: i | j}
 			case lexer.TOKEN_OP_BXOR:
-				return &ast.IntegerExp{exp.Line, i ^ j}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: i ^ j}
 			case lexer.TOKEN_OP_SHL:
-				return &ast.IntegerExp{exp.Line, number.ShiftLeft(i, j)}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: number.ShiftLeft(i, j)}
 			case lexer.TOKEN_OP_SHR:
-				return &ast.IntegerExp{exp.Line, number.ShiftRight(i, j)}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: number.ShiftRight(i, j)}
 			}
 		}
 	}
@@ -719,18 +887,18 @@ func optimizeArithBinaryOp(exp *ast.BinopExp) ast.Exp {
 		if y, ok := exp.Exp2.(*ast.IntegerExp); ok {
 			switch exp.Op {
 			case lexer.TOKEN_OP_ADD:
-				return &ast.IntegerExp{exp.Line, x.Val + y.Val}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: x.Val + y.Val}
 			case lexer.TOKEN_OP_SUB:
-				return &ast.IntegerExp{exp.Line, x.Val - y.Val}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: x.Val - y.Val}
 			case lexer.TOKEN_OP_MUL:
-				return &ast.IntegerExp{exp.Line, x.Val * y.Val}
+				return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: x.Val * y.Val}
 			case lexer.TOKEN_OP_IDIV:
 				if y.Val != 0 {
-					return &ast.IntegerExp{exp.Line, number.IFloorDiv(x.Val, y.Val)}
+					return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: number.IFloorDiv(x.Val, y.Val)}
 				}
 			case lexer.TOKEN_OP_MOD:
 				if y.Val != 0 {
-					return &ast.IntegerExp{exp.Line, number.IMod(x.Val, y.Val)}
+					return &ast.IntegerExp{Span: exp.Span, Line: exp.Line, Val: number.IMod(x.Val, y.Val)}
 				}
 			}
 		}
@@ -739,41 +907,31 @@ func optimizeArithBinaryOp(exp *ast.BinopExp) ast.Exp {
 		if g, ok := castToFloat(exp.Exp2); ok {
 			switch exp.Op {
 			case lexer.TOKEN_OP_ADD:
-				return &ast.FloatExp{exp.Line, f + g}
+				return &ast.FloatExp{Span: exp.Span, Line: exp.Line, Val: f + g}
 			case lexer.TOKEN_OP_SUB:
-				return &ast.FloatExp{exp.Line, f - g}
+				return &ast.FloatExp{Span: exp.Span, Line: exp.Line, Val: f - g}
 			case lexer.TOKEN_OP_MUL:
-				return &ast.FloatExp{exp.Line, f * g}
+				return &ast.FloatExp{Span: exp.Span, Line: exp.Line, Val: f * g}
 			case lexer.TOKEN_OP_DIV:
 				if g != 0 {
-					return &ast.FloatExp{exp.Line, f / g}
+					return &ast.FloatExp{Span: exp.Span, Line: exp.Line, Val: f / g}
 				}
 			case lexer.TOKEN_OP_IDIV:
 				if g != 0 {
-					return &ast.FloatExp{exp.Line, number.FFloorDiv(f, g)}
+					return &ast.FloatExp{Span: exp.Span, Line: exp.Line, Val: number.FFloorDiv(f, g)}
 				}
 			case lexer.TOKEN_OP_MOD:
 				if g != 0 {
-					return &ast.FloatExp{exp.Line, number.FMod(f, g)}
+					return &ast.FloatExp{Span: exp.Span, Line: exp.Line, Val: number.FMod(f, g)}
 				}
 			case lexer.TOKEN_OP_POW:
-				return &ast.FloatExp{exp.Line, math.Pow(f, g)}
+				return &ast.FloatExp{Span: exp.Span, Line: exp.Line, Val: math.Pow(f, g)}
 			}
 		}
 	}
 	return exp
 }
 
-func optimizePow(exp ast.Exp) ast.Exp {
-	if binop, ok := exp.(*ast.BinopExp); ok {
-		if binop.Op == lexer.TOKEN_OP_POW {
-			binop.Exp2 = optimizePow(binop.Exp2)
-		}
-		return optimizeArithBinaryOp(binop)
-	}
-	return exp
-}
-
 func optimizeUnaryOp(exp *ast.UnopExp) ast.Exp {
 	switch exp.Op {
 	case lexer.TOKEN_OP_UNM:
@@ -791,10 +949,12 @@ func optimizeUnm(exp *ast.UnopExp) ast.Exp {
 	switch x := exp.Exp.(type) { // number?
 	case *ast.IntegerExp:
 		x.Val = -x.Val
+		x.Span = exp.Span
 		return x
 	case *ast.FloatExp:
 		if x.Val != 0 {
 			x.Val = -x.Val
+			x.Span = exp.Span
 			return x
 		}
 	}
@@ -804,9 +964,9 @@ func optimizeUnm(exp *ast.UnopExp) ast.Exp {
 func optimizeNot(exp *ast.UnopExp) ast.Exp {
 	switch exp.Exp.(type) {
 	case *ast.NilExp, *ast.FalseExp: // false
-		return &ast.TrueExp{exp.Line}
+		return &ast.TrueExp{Span: exp.Span, Line: exp.Line}
 	case *ast.TrueExp, *ast.IntegerExp, *ast.FloatExp, *ast.StringExp: // true
-		return &ast.FalseExp{exp.Line}
+		return &ast.FalseExp{Span: exp.Span, Line: exp.Line}
 	default:
 		return exp
 	}
@@ -816,10 +976,11 @@ func optimizeBnot(exp *ast.UnopExp) ast.Exp {
 	switch x := exp.Exp.(type) { // number?
 	case *ast.IntegerExp:
 		x.Val = ^x.Val
+		x.Span = exp.Span
 		return x
 	case *ast.FloatExp:
 		if i, ok := number.FloatToInteger(x.Val); ok {
-			return &ast.IntegerExp{x.Line, ^i}
+			return &ast.IntegerExp{Span: exp.Span, Line: x.Line, Val: ^i}
 		}
 	}
 	return exp
@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"fmt"
+	"go/compiler/ast"
+	"go/compiler/lexer"
+	"sort"
+)
+
+//ErrorList RecoverErrors模式下收集到的语法错误，按位置排列
+type ErrorList []*lexer.SyntaxError
+
+func (list ErrorList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", list[0], len(list)-1)
+}
+
+func (list ErrorList) sorted() ErrorList {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Line != list[j].Line {
+			return list[i].Line < list[j].Line
+		}
+		return list[i].Column < list[j].Column
+	})
+	return list
+}
+
+//report 记下一个错误；一条语句只记第一个错误，后面的多半是它引起的，和上一个错误位置相同的也不记
+func (le *parser) report(err *lexer.SyntaxError) {
+	if n := len(le.errors); n > le.statErrors || n > 0 && le.errors[n-1].Line == err.Line && le.errors[n-1].Column == err.Column {
+		return
+	}
+	le.errors = append(le.errors, err)
+}
+
+//protect 把f当作一条语句执行，f抛出语法错误时记下错误，跳到下一个同步点并返回false
+func (le *parser) protect(f func()) (ok bool) {
+	start := le.LookAheadPos()
+	saved := le.statErrors
+	le.statErrors = len(le.errors)
+	defer func() {
+		if r := recover(); r != nil {
+			synErr, isSynErr := r.(*lexer.SyntaxError)
+			if !isSynErr {
+				panic(r)
+			}
+			le.report(synErr)
+			le.sync(start)
+			ok = false
+		}
+		le.statErrors = saved
+	}()
+	f()
+	return true
+}
+
+//sync 跳过token直到遇到能开始或者结束一条语句的关键字，或者另起一行的名字；
+//从start开始一个token都没读时至少跳过一个，保证解析能往前走
+func (le *parser) sync(start ast.Pos) {
+	if le.LookAheadPos().Offset == start.Offset && le.LookAhead() != lexer.TOKEN_EOF {
+		le.NextToken()
+	}
+	for kind := le.LookAhead(); kind != lexer.TOKEN_EOF && !_isSyncToken(kind); kind = le.LookAhead() {
+		if kind == lexer.TOKEN_IDENTIFIER && le.LookAheadPos().Line > le.TokenEnd().Line {
+			return
+		}
+		le.NextToken()
+	}
+}
+
+func _isSyncToken(tokenKind int) bool {
+	switch tokenKind {
+	case lexer.TOKEN_KW_LOCAL, lexer.TOKEN_KW_FUNCTION, lexer.TOKEN_KW_IF, lexer.TOKEN_KW_WHILE,
+		lexer.TOKEN_KW_FOR, lexer.TOKEN_KW_REPEAT, lexer.TOKEN_KW_DO, lexer.TOKEN_KW_RETURN,
+		lexer.TOKEN_KW_GOTO, lexer.TOKEN_KW_BREAK, lexer.TOKEN_SEP_LABEL,
+		lexer.TOKEN_KW_END, lexer.TOKEN_KW_ELSE, lexer.TOKEN_KW_ELSEIF, lexer.TOKEN_KW_UNTIL:
+		return true
+	}
+	return false
+}
+
+//parseStatRecover 解析一条语句，出错时用BadStat代替从语句开头到同步点之间的源码
+func parseStatRecover(le *parser) ast.Stat {
+	var stat ast.Stat
+	start := le.LookAheadPos()
+	if le.protect(func() { stat = parseStat(le) }) {
+		return stat
+	}
+	return &ast.BadStat{Span: _spanFrom(le, start)}
+}
+
+//parseBadExp 在该出现表达式的地方遇到了别的token：能跟在表达式后面的token留给外层解析，其它token当作写错的表达式跳过
+func parseBadExp(le *parser) *ast.BadExp {
+	err := le.LookAheadError("unexpected symbol")
+	if _isSyncToken(le.LookAhead()) || _isExpFollow(le.LookAhead()) {
+		le.report(err)
+		end := le.TokenEnd()
+		return &ast.BadExp{Span: ast.Span{Pos: end, End: end}, Line: le.Line()}
+	}
+	start := le.LookAheadPos()
+	line, kind, _ := le.NextToken()
+	le.report(err)
+	//少了左操作数的二元运算，比如x = * 3：同一行的右操作数也算在BadExp里，不然它会被当成下一条语句再报一次错
+	if _isBinop(kind) && le.LookAheadPos().Line == line {
+		parseExp(le)
+	}
+	return &ast.BadExp{Span: _spanFrom(le, start), Line: line}
+}
+
+func _isBinop(tokenKind int) bool {
+	switch tokenKind {
+	case lexer.TOKEN_OP_ADD, lexer.TOKEN_OP_MUL, lexer.TOKEN_OP_DIV, lexer.TOKEN_OP_IDIV, lexer.TOKEN_OP_POW,
+		lexer.TOKEN_OP_MOD, lexer.TOKEN_OP_BAND, lexer.TOKEN_OP_BOR, lexer.TOKEN_OP_SHR, lexer.TOKEN_OP_SHL,
+		lexer.TOKEN_OP_CONCAT, lexer.TOKEN_OP_LT, lexer.TOKEN_OP_LE, lexer.TOKEN_OP_GT, lexer.TOKEN_OP_GE,
+		lexer.TOKEN_OP_EQ, lexer.TOKEN_OP_NE, lexer.TOKEN_OP_AND, lexer.TOKEN_OP_OR:
+		return true
+	}
+	return false
+}
+
+func _isExpFollow(tokenKind int) bool {
+	switch tokenKind {
+	case lexer.TOKEN_EOF, lexer.TOKEN_KW_THEN, lexer.TOKEN_KW_IN, lexer.TOKEN_OP_ASSIGN,
+		lexer.TOKEN_SEP_RPAREN, lexer.TOKEN_SEP_RBRACK, lexer.TOKEN_SEP_RCURLY,
+		lexer.TOKEN_SEP_COMMA, lexer.TOKEN_SEP_SEMI:
+		return true
+	}
+	return false
+}
+
+//NextTokenOfKind RecoverErrors模式下缺少的关键字或者符号只记一个错误，当作已经读到了，不消耗下一个token
+func (le *parser) NextTokenOfKind(kind int) (line int, token string) {
+	if le.mode&RecoverErrors != 0 && kind != lexer.TOKEN_EOF && le.LookAhead() != kind {
+		le.report(le.LookAheadError("'%s' expected", lexer.TokenName(kind)))
+		return le.Line(), ""
+	}
+	return le.Lexer.NextTokenOfKind(kind)
+}
+
+//NextIdentifier RecoverErrors模式下缺少名字时不消耗下一个token，它可能是外层语句的end之类的关键字
+func (le *parser) NextIdentifier() (line int, token string) {
+	if le.mode&RecoverErrors != 0 && le.LookAhead() != lexer.TOKEN_IDENTIFIER {
+		panic(le.LookAheadError("'%s' expected", lexer.TokenName(lexer.TOKEN_IDENTIFIER)))
+	}
+	return le.Lexer.NextIdentifier()
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"fmt"
+	"go/compiler/ast"
+	"strings"
+	"testing"
+)
+
+//badNodes 按源码顺序列出语法树里的BadStat和BadExp及其位置
+func badNodes(block *ast.Block) string {
+	var list []string
+	ast.Inspect(block, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.BadStat, *ast.BadExp:
+			pos := node.NodeSpan().Pos
+			list = append(list, fmt.Sprintf("%T@%d:%d", node, pos.Line, pos.Column)[len("*ast."):])
+		}
+		return true
+	})
+	return strings.Join(list, " ")
+}
+
+//messages 把错误列表写成"行:列: 信息"
+func messages(err error) string {
+	var list []string
+	if errs, ok := err.(ErrorList); ok {
+		for _, e := range errs {
+			list = append(list, fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg))
+		}
+	}
+	return strings.Join(list, "; ")
+}
+
+//TestRecoverErrors 每条写错的语句报一个错误，BadStat/BadExp放在出错的位置
+func TestRecoverErrors(t *testing.T) {
+	tests := []struct {
+		src, errors, bad string
+	}{
+		{"local x = \nif x == then\n  print('ok'\nend\n",
+			"2:1: unexpected symbol; 2:9: unexpected symbol; 4:1: ')' expected", "BadExp@1:10 BadExp@2:8"},
+		{"x = = 1\ny = 2\nz = * 3\n",
+			"1:5: unexpected symbol; 3:5: unexpected symbol", "BadExp@1:4 BadStat@1:5 BadExp@3:5"},
+		{"print(1 +)\nlocal a = 1\n", "1:10: unexpected symbol", "BadExp@1:10"},
+		{"f(\ng()\n", "3:1: ')' expected", ""},
+		{"end\nx = 1\n", "1:1: '<eof>' expected", "BadStat@1:1"},
+		{"return 1 +\n", "2:1: unexpected symbol", "BadExp@1:11"},
+		{"for i = 1 do end\nwhile x do\n  y = )\nend\n",
+			"1:11: ',' expected; 3:7: unexpected symbol", "BadExp@1:10 BadExp@3:6 BadStat@3:7"},
+		{"x = *\ny = 1 .. \n", "1:5: unexpected symbol; 3:1: unexpected symbol", "BadExp@1:5 BadExp@2:9"},
+		{"function f()\n  x = = 1\n  y = * 2 +\nend\nlocal a = {\n  b = ,\n  c = ,\n}\n",
+			"2:7: unexpected symbol; 3:7: unexpected symbol; 6:7: unexpected symbol",
+			"BadExp@2:6 BadStat@2:7 BadExp@3:7 BadExp@6:6 BadExp@7:6"},
+	}
+	for _, tt := range tests {
+		block, err := ParseMode(tt.src, "test", RecoverErrors)
+		if block == nil {
+			t.Fatalf("%q: no tree", tt.src)
+		}
+		if got := messages(err); got != tt.errors {
+			t.Errorf("%q: errors %s, want %s", tt.src, got, tt.errors)
+		}
+		if got := badNodes(block); got != tt.bad {
+			t.Errorf("%q: bad nodes %s, want %s", tt.src, got, tt.bad)
+		}
+	}
+
+	//没有语法错误时和普通模式一样返回nil
+	if _, err := ParseMode("local x = 1", "test", RecoverErrors); err != nil {
+		t.Errorf("valid chunk: %v", err)
+	}
+}
@@ -0,0 +1,784 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"go/compiler/ast"
+	"go/compiler/lexer"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//QuoteStyle 短字符串用哪种引号
+type QuoteStyle int
+
+const (
+	DoubleQuote QuoteStyle = iota
+	SingleQuote
+)
+
+//Config 控制输出的格式，零值表示用tab缩进、双引号
+type Config struct {
+	Indent int //每一层缩进的空格数，为0时用tab
+	Quote  QuoteStyle
+}
+
+//CommentedNode 带注释的语法树，Comments一般来自parser.ParseComments
+type CommentedNode struct {
+	Node     interface{}
+	Comments ast.CommentMap
+}
+
+//Fprint 用默认格式把语法树节点写成lua源码
+func Fprint(w io.Writer, node interface{}) error {
+	return (&Config{}).Fprint(w, node)
+}
+
+//Fprint 把语法树节点(*ast.Block、Stat或Exp)写成lua源码，node是*CommentedNode时同时输出注释；
+//不会折叠常量，也不会改变求值顺序，但括号、数字和字符串的写法按cfg统一
+func (cfg *Config) Fprint(w io.Writer, node interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("printer: %v", r)
+		}
+	}()
+
+	p := &printer{cfg: cfg, tables: map[*ast.TableConstructorExp]bool{}}
+	if cn, ok := node.(*CommentedNode); ok {
+		p.comments, node = cn.Comments, cn.Node
+	}
+	switch x := node.(type) {
+	case *ast.Block:
+		p.stats(x)
+	case *ast.EmptyStat, *ast.BadStat, *ast.BreakStat, *ast.LabelStat, *ast.GotoStat, *ast.DoStat,
+		*ast.WhileStat, *ast.RepeatStat, *ast.IfStat, *ast.ForNumStat, *ast.ForInStat,
+		*ast.LocalVarDeclStat, *ast.AssignStat, *ast.LocalFuncDefStat:
+		p.stat(x)
+	default:
+		p.exp(x, precLowest)
+	}
+	_, err = w.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	cfg      *Config
+	buf      bytes.Buffer
+	indent   int
+	comments ast.CommentMap
+	tables   map[*ast.TableConstructorExp]bool //已经决定了的表构造器的格式，true表示每个字段占一行
+}
+
+func (p *printer) print(a ...string) {
+	for _, s := range a {
+		p.buf.WriteString(s)
+	}
+}
+
+func (p *printer) writeIndent() {
+	for i := 0; i < p.indent; i++ {
+		if p.cfg.Indent <= 0 {
+			p.buf.WriteByte('\t')
+		} else {
+			p.buf.WriteString(strings.Repeat(" ", p.cfg.Indent))
+		}
+	}
+}
+
+// ========================================================= Stat ===============================================
+
+//lines 记录同一层里上一次输出的内容在源码中结束的行号，用来保留空行
+type lines struct {
+	n, last int
+}
+
+//newLine 另起一行并缩进，源码里line和上一行之间有空行时最多保留一个
+func (p *printer) newLine(l *lines, line int) {
+	if l.n > 0 && l.last > 0 && line > l.last+1 {
+		p.print("\n")
+	}
+	p.writeIndent()
+	l.n++
+}
+
+var noComments = &ast.NodeComments{}
+
+func (p *printer) commentsOf(node interface{}) *ast.NodeComments {
+	if n, ok := node.(ast.Node); ok {
+		if nc := p.comments[n]; nc != nil {
+			return nc
+		}
+	}
+	return noComments
+}
+
+//leading 每条注释占一行
+func (p *printer) leading(l *lines, comments []*ast.Comment) {
+	for _, comment := range comments {
+		p.newLine(l, comment.Pos.Line)
+		p.print(comment.Text, "\n")
+		l.last = comment.End.Line
+	}
+}
+
+//trailing 注释接在当前行后面，原来不在同一行的另起一行；返回最后一条注释结束的行号
+func (p *printer) trailing(comments []*ast.Comment) int {
+	line := 0
+	for i, comment := range comments {
+		if i > 0 && comment.Pos.Line != line {
+			p.print("\n")
+			p.writeIndent()
+		} else {
+			p.print(" ")
+		}
+		p.print(comment.Text)
+		line = comment.End.Line
+	}
+	return line
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//stats 每条语句占一行，源码里语句之间的空行最多保留一个
+func (p *printer) stats(block *ast.Block) {
+	l := &lines{}
+	printed := false
+	for _, stat := range block.Stats {
+		if _, ok := stat.(*ast.EmptyStat); ok {
+			continue
+		}
+		span, nc := ast.SpanOf(stat), p.commentsOf(stat)
+		p.leading(l, nc.Leading)
+		p.newLine(l, span.Pos.Line)
+		//上一条语句以表达式结尾时，(开头的语句会被当成函数调用的参数
+		if printed && startsWithParen(stat) {
+			p.print(";")
+		}
+		p.stat(stat)
+		l.last = maxInt(span.End.Line, p.trailing(nc.Trailing))
+		p.print("\n")
+		printed = true
+	}
+
+	nc := p.commentsOf(block)
+	if block.RetExps != nil {
+		p.leading(l, nc.Leading)
+		line, lastLine := 0, 0
+		if n := len(block.RetExps); n > 0 {
+			line, lastLine = ast.SpanOf(block.RetExps[0]).Pos.Line, ast.SpanOf(block.RetExps[n-1]).End.Line
+		}
+		p.newLine(l, line)
+		p.print("return")
+		if len(block.RetExps) > 0 {
+			p.print(" ")
+			p.exps(block.RetExps)
+		}
+		l.last = maxInt(lastLine, p.trailing(nc.Trailing))
+		p.print("\n")
+	}
+	p.leading(l, nc.End)
+}
+
+//isEmpty block里没有任何要输出的东西
+func (p *printer) isEmpty(block *ast.Block) bool {
+	for _, stat := range block.Stats {
+		if _, ok := stat.(*ast.EmptyStat); !ok {
+			return false
+		}
+	}
+	nc := p.commentsOf(block)
+	return block.RetExps == nil && len(nc.Leading)+len(nc.Trailing)+len(nc.End) == 0
+}
+
+func startsWithParen(stat ast.Stat) bool {
+	var exp ast.Exp
+	switch x := stat.(type) {
+	case *ast.FuncCallStat:
+		exp = x
+	case *ast.AssignStat:
+		exp = x.VarList[0]
+	default:
+		return false
+	}
+	for {
+		switch x := exp.(type) {
+		case *ast.FuncCallExp:
+			exp = x.PrefixExp
+		case *ast.TableAccessExp:
+			exp = x.PrefixExp
+		case *ast.NameExp:
+			return false
+		default:
+			return true
+		}
+	}
+}
+
+//body 输出block和结尾的关键字，block里的语句多缩进一层
+func (p *printer) body(block *ast.Block, closing string) {
+	p.print("\n")
+	p.indent++
+	p.stats(block)
+	p.indent--
+	p.writeIndent()
+	p.print(closing)
+}
+
+func (p *printer) stat(stat ast.Stat) {
+	switch x := stat.(type) {
+	case *ast.EmptyStat:
+		p.print(";")
+	case *ast.BadStat:
+		panic("cannot print BadStat, the tree has syntax errors")
+	case *ast.FuncCallStat:
+		p.exp(x, precAtom)
+	case *ast.BreakStat:
+		p.print("break")
+	case *ast.LabelStat:
+		p.print("::", x.Name, "::")
+	case *ast.GotoStat:
+		p.print("goto ", x.Name)
+	case *ast.DoStat:
+		p.print("do")
+		p.body(x.Block, "end")
+	case *ast.WhileStat:
+		p.print("while ")
+		p.exp(x.Exp, precLowest)
+		p.print(" do")
+		p.body(x.Block, "end")
+	case *ast.RepeatStat:
+		p.print("repeat")
+		p.body(x.Block, "until ")
+		p.exp(x.Exp, precLowest)
+	case *ast.IfStat:
+		p.ifStat(x)
+	case *ast.ForNumStat:
+		p.print("for ", x.VarName, " = ")
+		p.exp(x.InitExp, precLowest)
+		p.print(", ")
+		p.exp(x.LimitExp, precLowest)
+		if !isDefaultStep(x.StepExp) {
+			p.print(", ")
+			p.exp(x.StepExp, precLowest)
+		}
+		p.print(" do")
+		p.body(x.Block, "end")
+	case *ast.ForInStat:
+		p.print("for ", strings.Join(x.NameList, ", "), " in ")
+		p.exps(x.ExpList)
+		p.print(" do")
+		p.body(x.Block, "end")
+	case *ast.LocalVarDeclStat:
+		p.print("local ", strings.Join(x.NameList, ", "))
+		if len(x.ExpList) > 0 {
+			p.print(" = ")
+			p.exps(x.ExpList)
+		}
+	case *ast.AssignStat:
+		p.assignStat(x)
+	case *ast.LocalFuncDefStat:
+		p.print("local function ", x.Name)
+		p.funcBody(x.Exp.ParList, x.Exp.IsVararg, x.Exp.Block)
+	default:
+		panic(fmt.Sprintf("unknown stat %T", stat))
+	}
+}
+
+//ifStat else分支在语法树里是条件为true的elseif
+func (p *printer) ifStat(stat *ast.IfStat) {
+	for i, exp := range stat.Exps {
+		if i == 0 {
+			p.print("if ")
+		} else if _, ok := exp.(*ast.TrueExp); ok && i == len(stat.Exps)-1 {
+			p.print("else")
+			p.body(stat.Blocks[i], "")
+			continue
+		} else {
+			p.print("elseif ")
+		}
+		p.exp(exp, precLowest)
+		p.print(" then")
+		p.body(stat.Blocks[i], "")
+	}
+	p.print("end")
+}
+
+//isDefaultStep 省略步长时解析器补上的就是整数1
+func isDefaultStep(exp ast.Exp) bool {
+	if exp == nil {
+		return true
+	}
+	i, ok := exp.(*ast.IntegerExp)
+	return ok && i.Val == 1
+}
+
+//assignStat function t.a.b:c() end 在语法树里是给t.a.b.c赋值一个第一个参数叫self的函数，
+//它和赋值语句的区间一样，据此还原成函数定义的写法
+func (p *printer) assignStat(stat *ast.AssignStat) {
+	if len(stat.VarList) == 1 && len(stat.ExpList) == 1 {
+		if fd, ok := stat.ExpList[0].(*ast.FuncDefExp); ok && fd.Span == stat.Span {
+			if name, ok := funcName(stat.VarList[0]); ok {
+				parList := fd.ParList
+				if _, isField := stat.VarList[0].(*ast.TableAccessExp); isField && len(parList) > 0 && parList[0] == "self" {
+					i := strings.LastIndex(name, ".")
+					name = name[:i] + ":" + name[i+1:]
+					parList = parList[1:]
+				}
+				p.print("function ", name)
+				p.funcBody(parList, fd.IsVararg, fd.Block)
+				return
+			}
+		}
+	}
+
+	for i, exp := range stat.VarList {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.exp(exp, precAtom)
+	}
+	p.print(" = ")
+	p.exps(stat.ExpList)
+}
+
+func funcName(exp ast.Exp) (string, bool) {
+	switch x := exp.(type) {
+	case *ast.NameExp:
+		return x.Name, true
+	case *ast.TableAccessExp:
+		if key, ok := x.KeyExp.(*ast.StringExp); ok && isName(key.Val) {
+			if prefix, ok := funcName(x.PrefixExp); ok {
+				return prefix + "." + key.Val, true
+			}
+		}
+	}
+	return "", false
+}
+
+//funcBody 空函数写在一行里
+func (p *printer) funcBody(parList []string, isVararg bool, block *ast.Block) {
+	params := parList
+	if isVararg {
+		params = append(params[:len(params):len(params)], "...")
+	}
+	p.print("(", strings.Join(params, ", "), ")")
+	if p.isEmpty(block) {
+		p.print(" end")
+	} else {
+		p.body(block, "end")
+	}
+}
+
+// ========================================================= Exp ===============================================
+
+//优先级从低到高，和lua手册3.4.8节一致；..和^是右结合的
+const (
+	precLowest = iota
+	precOr
+	precAnd
+	precCompare
+	precBor
+	precBxor
+	precBand
+	precShift
+	precConcat
+	precAdd
+	precMul
+	precUnary
+	precPow
+	precAtom
+)
+
+var binops = map[int]struct {
+	text string
+	prec int
+}{
+	lexer.TOKEN_OP_OR:     {"or", precOr},
+	lexer.TOKEN_OP_AND:    {"and", precAnd},
+	lexer.TOKEN_OP_LT:     {"<", precCompare},
+	lexer.TOKEN_OP_GT:     {">", precCompare},
+	lexer.TOKEN_OP_LE:     {"<=", precCompare},
+	lexer.TOKEN_OP_GE:     {">=", precCompare},
+	lexer.TOKEN_OP_NE:     {"~=", precCompare},
+	lexer.TOKEN_OP_EQ:     {"==", precCompare},
+	lexer.TOKEN_OP_BOR:    {"|", precBor},
+	lexer.TOKEN_OP_BXOR:   {"~", precBxor},
+	lexer.TOKEN_OP_BAND:   {"&", precBand},
+	lexer.TOKEN_OP_SHL:    {"<<", precShift},
+	lexer.TOKEN_OP_SHR:    {">>", precShift},
+	lexer.TOKEN_OP_CONCAT: {"..", precConcat},
+	lexer.TOKEN_OP_ADD:    {"+", precAdd},
+	lexer.TOKEN_OP_SUB:    {"-", precAdd},
+	lexer.TOKEN_OP_MUL:    {"*", precMul},
+	lexer.TOKEN_OP_DIV:    {"/", precMul},
+	lexer.TOKEN_OP_IDIV:   {"//", precMul},
+	lexer.TOKEN_OP_MOD:    {"%", precMul},
+	lexer.TOKEN_OP_POW:    {"^", precPow},
+}
+
+var unops = map[int]string{
+	lexer.TOKEN_OP_UNM:  "-",
+	lexer.TOKEN_OP_NOT:  "not ",
+	lexer.TOKEN_OP_LEN:  "#",
+	lexer.TOKEN_OP_BNOT: "~",
+}
+
+func precOf(exp ast.Exp) int {
+	switch x := exp.(type) {
+	case *ast.BinopExp:
+		return binops[x.Op].prec
+	case *ast.ConcatExp:
+		return precConcat
+	case *ast.UnopExp:
+		return precUnary
+	case *ast.IntegerExp:
+		if x.Val == math.MinInt64 {
+			return precAdd
+		} else if x.Val < 0 {
+			return precUnary
+		}
+	case *ast.FloatExp:
+		if math.IsInf(x.Val, 0) || math.IsNaN(x.Val) {
+			return precMul
+		} else if math.Signbit(x.Val) {
+			return precUnary
+		}
+	}
+	return precAtom
+}
+
+func (p *printer) exps(exps []ast.Exp) {
+	for i, exp := range exps {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.exp(exp, precLowest)
+	}
+}
+
+//exp 优先级低于prec时加上括号
+func (p *printer) exp(exp ast.Exp, prec int) {
+	if precOf(exp) < prec {
+		p.print("(")
+		p.exp(exp, precLowest)
+		p.print(")")
+		return
+	}
+
+	switch x := exp.(type) {
+	case *ast.BadExp:
+		panic("cannot print BadExp, the tree has syntax errors")
+	case *ast.NilExp:
+		p.print("nil")
+	case *ast.TrueExp:
+		p.print("true")
+	case *ast.FalseExp:
+		p.print("false")
+	case *ast.VarargExp:
+		p.print("...")
+	case *ast.IntegerExp:
+		p.integer(x.Val)
+	case *ast.FloatExp:
+		p.float(x.Val)
+	case *ast.StringExp:
+		p.string(x.Val)
+	case *ast.NameExp:
+		p.print(x.Name)
+	case *ast.UnopExp:
+		p.unop(x)
+	case *ast.BinopExp:
+		p.binop(x)
+	case *ast.ConcatExp:
+		for i, e := range x.Exps {
+			if i > 0 {
+				p.print(" .. ")
+			}
+			p.exp(e, precConcat+1)
+		}
+	case *ast.TableConstructorExp:
+		p.table(x)
+	case *ast.FuncDefExp:
+		p.print("function")
+		p.funcBody(x.ParList, x.IsVararg, x.Block)
+	case *ast.ParensExp:
+		p.print("(")
+		p.exp(x.Exp, precLowest)
+		p.print(")")
+	case *ast.TableAccessExp:
+		p.prefixExp(x.PrefixExp)
+		if key, ok := x.KeyExp.(*ast.StringExp); ok && isName(key.Val) {
+			p.print(".", key.Val)
+		} else {
+			p.print("[")
+			p.exp(x.KeyExp, precLowest)
+			p.print("]")
+		}
+	case *ast.FuncCallExp:
+		p.prefixExp(x.PrefixExp)
+		if x.NameExp != nil {
+			p.print(":", x.NameExp.Val)
+		}
+		p.print("(")
+		p.exps(x.Args)
+		p.print(")")
+	default:
+		panic(fmt.Sprintf("unknown exp %T", exp))
+	}
+}
+
+//prefixExp 只有变量、函数调用和括号表达式能直接跟.、[]和()
+func (p *printer) prefixExp(exp ast.Exp) {
+	switch exp.(type) {
+	case *ast.NameExp, *ast.ParensExp, *ast.TableAccessExp, *ast.FuncCallExp:
+		p.exp(exp, precAtom)
+	default:
+		p.print("(")
+		p.exp(exp, precLowest)
+		p.print(")")
+	}
+}
+
+func (p *printer) unop(exp *ast.UnopExp) {
+	op, found := unops[exp.Op]
+	if !found {
+		panic(fmt.Sprintf("unknown unary operator %d", exp.Op))
+	}
+	p.print(op)
+	if exp.Op == lexer.TOKEN_OP_UNM && startsWithMinus(exp.Exp) {
+		p.print(" ") // --会变成注释
+	}
+	p.exp(exp.Exp, precUnary)
+}
+
+func startsWithMinus(exp ast.Exp) bool {
+	switch x := exp.(type) {
+	case *ast.UnopExp:
+		return x.Op == lexer.TOKEN_OP_UNM
+	case *ast.IntegerExp, *ast.FloatExp:
+		return precOf(x) == precUnary //负数
+	}
+	return false
+}
+
+func (p *printer) binop(exp *ast.BinopExp) {
+	op, found := binops[exp.Op]
+	if !found {
+		panic(fmt.Sprintf("unknown binary operator %d", exp.Op))
+	}
+	switch exp.Op {
+	case lexer.TOKEN_OP_POW: // 2^-x 不需要括号
+		p.exp(exp.Exp1, op.prec+1)
+		p.print(op.text)
+		p.exp(exp.Exp2, precUnary)
+	case lexer.TOKEN_OP_CONCAT:
+		p.exp(exp.Exp1, op.prec+1)
+		p.print(" ", op.text, " ")
+		p.exp(exp.Exp2, op.prec)
+	default:
+		p.exp(exp.Exp1, op.prec)
+		p.print(" ", op.text, " ")
+		p.exp(exp.Exp2, op.prec+1)
+	}
+}
+
+func (p *printer) integer(i int64) {
+	if i == math.MinInt64 { //9223372036854775808会被当成浮点数
+		p.print("-9223372036854775807 - 1")
+	} else {
+		p.print(strconv.FormatInt(i, 10))
+	}
+}
+
+func (p *printer) float(f float64) {
+	switch {
+	case math.IsInf(f, 1):
+		p.print("1/0")
+	case math.IsInf(f, -1):
+		p.print("-1/0")
+	case math.IsNaN(f):
+		p.print("0/0")
+	default:
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0" //否则读回来就成了整数
+		}
+		p.print(s)
+	}
+}
+
+/*
+table 源码里跨了多行或者带注释的表构造器每个字段占一行；
+写在一行里时有字段输出成了多行(比如函数)也要每个字段占一行，否则再格式化一遍结果会变。
+*/
+func (p *printer) table(exp *ast.TableConstructorExp) {
+	if len(exp.ValExps) == 0 && !p.hasComments(exp) {
+		p.print("{}")
+		return
+	}
+	multiLine, decided := p.tables[exp]
+	if !decided {
+		multiLine = exp.Span.End.Line > exp.Span.Pos.Line || p.hasComments(exp)
+		if !multiLine {
+			start := p.buf.Len()
+			p.fields(exp, false)
+			multiLine = bytes.IndexByte(p.buf.Bytes()[start:], '\n') >= 0
+			if !multiLine {
+				p.tables[exp] = false
+				return
+			}
+			p.buf.Truncate(start)
+		}
+		p.tables[exp] = multiLine
+	}
+	p.fields(exp, multiLine)
+}
+
+func (p *printer) fields(exp *ast.TableConstructorExp, multiLine bool) {
+	l := &lines{}
+	p.print("{")
+	if multiLine {
+		p.print("\n")
+		p.indent++
+	}
+	for i, val := range exp.ValExps {
+		var key ast.Exp
+		if i < len(exp.KeyExps) {
+			key = exp.KeyExps[i]
+		}
+		nc := p.commentsOf(val)
+		if multiLine {
+			p.leading(l, nc.Leading)
+			if key != nil {
+				p.newLine(l, ast.SpanOf(key).Pos.Line)
+			} else {
+				p.newLine(l, ast.SpanOf(val).Pos.Line)
+			}
+		} else if i > 0 {
+			p.print(", ")
+		}
+		if key != nil {
+			if str, ok := key.(*ast.StringExp); ok && isName(str.Val) {
+				p.print(str.Val)
+			} else {
+				p.print("[")
+				p.exp(key, precLowest)
+				p.print("]")
+			}
+			p.print(" = ")
+		}
+		p.exp(val, precLowest)
+		if multiLine {
+			p.print(",")
+			l.last = maxInt(ast.SpanOf(val).End.Line, p.trailing(nc.Trailing))
+			p.print("\n")
+		}
+	}
+	if multiLine {
+		p.leading(l, p.commentsOf(exp).End)
+		p.indent--
+		p.writeIndent()
+	}
+	p.print("}")
+}
+
+func (p *printer) hasComments(exp *ast.TableConstructorExp) bool {
+	if len(p.commentsOf(exp).End) > 0 {
+		return true
+	}
+	for _, val := range exp.ValExps {
+		if nc := p.commentsOf(val); len(nc.Leading)+len(nc.Trailing) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isName(s string) bool {
+	if s == "" || lexer.IsKeyword(s) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ========================================================= String ===============================================
+
+//string 多行文本用长字符串，其他的用cfg指定的引号
+func (p *printer) string(s string) {
+	if canBeLongString(s) {
+		level := ""
+		for strings.Contains(s+"]", "]"+level+"]") {
+			level += "="
+		}
+		//紧跟在[[后面的换行会被忽略
+		p.print("[", level, "[\n", s, "]", level, "]")
+		return
+	}
+
+	quote := byte('"')
+	if p.cfg.Quote == SingleQuote {
+		quote = '\''
+	}
+	p.buf.WriteByte(quote)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == quote || c == '\\':
+			p.buf.WriteByte('\\')
+			p.buf.WriteByte(c)
+		case c == '\n':
+			p.print(`\n`)
+		case c == '\r':
+			p.print(`\r`)
+		case c == '\t':
+			p.print(`\t`)
+		case c < ' ' || c == 0x7F:
+			if i+1 < len(s) && isDigit(s[i+1]) {
+				fmt.Fprintf(&p.buf, `\%03d`, c)
+			} else {
+				fmt.Fprintf(&p.buf, `\%d`, c)
+			}
+		case c >= utf8.RuneSelf:
+			if r, size := utf8.DecodeRuneInString(s[i:]); r != utf8.RuneError || size > 1 {
+				p.print(s[i : i+size])
+				i += size
+				continue
+			}
+			fmt.Fprintf(&p.buf, `\x%02X`, c)
+		default:
+			p.buf.WriteByte(c)
+		}
+		i++
+	}
+	p.buf.WriteByte(quote)
+}
+
+//canBeLongString 长字符串里的\r会被换成\n，其他控制字符也不好看，只有普通的多行文本才用
+func canBeLongString(s string) bool {
+	if !strings.Contains(s, "\n") || !utf8.ValidString(s) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' && c != '\n' && c != '\t' || c == 0x7F {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
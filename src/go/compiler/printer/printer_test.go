@@ -0,0 +1,76 @@
+package printer
+
+import (
+	"bytes"
+	"go/compiler"
+	"go/compiler/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func format(t *testing.T, name, src string) string {
+	t.Helper()
+	block, comments, err := parser.ParseComments(src, "@"+name, 0)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, &CommentedNode{Node: block, Comments: comments}); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return buf.String()
+}
+
+//checkIdempotent fmt(fmt(x)) == fmt(x)，否则golua fmt -check会报告golua fmt -w刚写好的文件
+func checkIdempotent(t *testing.T, name, src string) {
+	t.Helper()
+	once := format(t, name, src)
+	if twice := format(t, name, once); twice != once {
+		t.Errorf("%s: formatting is not idempotent\nfirst:\n%s\nsecond:\n%s", name, once, twice)
+	}
+}
+
+func TestIdempotentOnLuaSources(t *testing.T) {
+	n := 0
+	err := filepath.Walk("../../../lua", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".lua") {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		src := string(data)
+		checkIdempotent(t, path, src[compiler.SkipComment(src):])
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("no lua sources found")
+	}
+}
+
+func TestTableLayout(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"t = {1, 2, x = 3}\n", "t = {1, 2, x = 3}\n"},
+		{"t = {f = function() end}\n", "t = {f = function() end}\n"},
+		{"t = {function() return 1 end, 2}\n", "t = {\n\tfunction()\n\t\treturn 1\n\tend,\n\t2,\n}\n"},
+		{"t = {{x = function() return 1 end}}\n", "t = {\n\t{\n\t\tx = function()\n\t\t\treturn 1\n\t\tend,\n\t},\n}\n"},
+		{"t = {'a\\nb'}\n", "t = {\n\t[[\na\nb]],\n}\n"},
+		{"t = {\n1, 2}\n", "t = {\n\t1,\n\t2,\n}\n"},
+	}
+	for _, tt := range tests {
+		if got := format(t, "test", tt.src); got != tt.want {
+			t.Errorf("%q:\ngot:\n%s\nwant:\n%s", tt.src, got, tt.want)
+		}
+		checkIdempotent(t, "test", tt.src)
+	}
+}
@@ -0,0 +1,259 @@
+package scope
+
+import "go/compiler/ast"
+
+type resolver struct {
+	info    *Info
+	scope   *Scope
+	methods map[*ast.FuncDefExp]bool //function a:b()定义的函数，第一个参数是隐含的self
+}
+
+//Resolve 解析chunk里所有的名字，chunk可以是parser.Parse或者ParseMode返回的语法树
+func Resolve(chunk *ast.Block) *Info {
+	r := &resolver{
+		info: &Info{
+			Env:    &Variable{Name: "_ENV", Kind: Env, Implicit: true},
+			Refs:   map[*ast.NameExp]*Ref{},
+			Scopes: map[ast.Node]*Scope{},
+		},
+		methods: map[*ast.FuncDefExp]bool{},
+	}
+	r.info.Root = r.open(FuncScope, chunk)
+	r.block(chunk)
+	return r.info
+}
+
+func (r *resolver) open(kind ScopeKind, node ast.Node) *Scope {
+	s := &Scope{Kind: kind, Node: node, Parent: r.scope}
+	if r.scope != nil {
+		r.scope.Children = append(r.scope.Children, s)
+	}
+	r.info.Scopes[node] = s
+	r.scope = s
+	return s
+}
+
+func (r *resolver) close() {
+	r.scope = r.scope.Parent
+}
+
+func (r *resolver) declare(name string, kind VarKind, decl ast.Node, index int, span ast.Span, start int) *Variable {
+	v := &Variable{Name: name, Kind: kind, Decl: decl, Index: index, Span: span, Start: start, Scope: r.scope}
+	r.scope.Vars = append(r.scope.Vars, v)
+	r.info.Vars = append(r.info.Vars, v)
+	return v
+}
+
+//lookup 当前可见的变量，和funcInfo.slotOfLocVar加indexOfUpval一样；同一作用域里后声明的遮住先声明的
+func (r *resolver) lookup(name string) *Variable {
+	for s := r.scope; s != nil; s = s.Parent {
+		for i := len(s.Vars) - 1; i >= 0; i-- {
+			if s.Vars[i].Name == name {
+				return s.Vars[i]
+			}
+		}
+	}
+	if name == "_ENV" {
+		return r.info.Env
+	}
+	return nil
+}
+
+//use 在当前函数里使用v，v属于外层函数时从当前函数到v所在的函数之间的每一层函数都要有这个upvalue
+func (r *resolver) use(v *Variable) RefKind {
+	var declFunc *Scope
+	if v.Scope != nil {
+		declFunc = v.Scope.Func()
+	}
+	fn := r.scope.Func()
+	if fn == declFunc {
+		return Local
+	}
+	v.Captured = v.Kind != Env
+	for ; fn != declFunc; fn = parentFunc(fn) {
+		if !hasUpvalue(fn, v) {
+			fn.Upvalues = append(fn.Upvalues, v)
+		}
+	}
+	return Upvalue
+}
+
+func parentFunc(fn *Scope) *Scope {
+	if fn.Parent == nil {
+		return nil
+	}
+	return fn.Parent.Func()
+}
+
+func hasUpvalue(fn *Scope, v *Variable) bool {
+	for _, uv := range fn.Upvalues {
+		if uv == v {
+			return true
+		}
+	}
+	return false
+}
+
+//ref 解析一个名字；全局变量只找到对应的_ENV，由调用者决定什么时候使用它
+func (r *resolver) ref(name *ast.NameExp, write bool) *Ref {
+	ref := &Ref{Name: name, Scope: r.scope, Write: write}
+	if v := r.lookup(name.Name); v != nil {
+		ref.Var = v
+		ref.Kind = r.use(v)
+		v.Refs = append(v.Refs, ref)
+	} else {
+		ref.Kind = Global
+		ref.Env = r.lookup("_ENV")
+	}
+	r.info.Refs[name] = ref
+	return ref
+}
+
+func (r *resolver) block(block *ast.Block) {
+	if block == nil {
+		return
+	}
+	for _, stat := range block.Stats {
+		r.stat(stat)
+	}
+	r.exps(block.RetExps)
+}
+
+//scopedBlock 在新的作用域里解析block，if的分支用block本身作为作用域的节点
+func (r *resolver) scopedBlock(kind ScopeKind, node ast.Node, block *ast.Block) {
+	if block == nil {
+		return
+	}
+	r.open(kind, node)
+	r.block(block)
+	r.close()
+}
+
+func (r *resolver) stat(stat ast.Stat) {
+	switch x := stat.(type) {
+	case *ast.LocalVarDeclStat:
+		r.exps(x.ExpList)
+		for i, name := range x.NameList {
+			r.declare(name, LocalVar, x, i, spanAt(x.NameSpans, i), x.End.Offset)
+		}
+	case *ast.LocalFuncDefStat:
+		r.declare(x.Name, LocalFunc, x, 0, x.NameSpan, x.NameSpan.End.Offset)
+		r.funcDef(x.Exp)
+	case *ast.AssignStat:
+		r.assign(x)
+	case *ast.DoStat:
+		r.scopedBlock(BlockScope, x, x.Block)
+	case *ast.WhileStat:
+		r.exp(x.Exp)
+		r.scopedBlock(LoopScope, x, x.Block)
+	case *ast.RepeatStat:
+		r.open(LoopScope, x)
+		r.block(x.Block)
+		r.exp(x.Exp)
+		r.close()
+	case *ast.IfStat:
+		for i, exp := range x.Exps {
+			r.exp(exp)
+			if i < len(x.Blocks) {
+				r.scopedBlock(BlockScope, x.Blocks[i], x.Blocks[i])
+			}
+		}
+	case *ast.ForNumStat:
+		r.exps([]ast.Exp{x.InitExp, x.LimitExp, x.StepExp})
+		r.open(LoopScope, x)
+		r.declare(x.VarName, ForVar, x, 0, x.VarSpan, blockStart(x.Block))
+		r.block(x.Block)
+		r.close()
+	case *ast.ForInStat:
+		r.exps(x.ExpList)
+		r.open(LoopScope, x)
+		for i, name := range x.NameList {
+			r.declare(name, ForVar, x, i, spanAt(x.NameSpans, i), blockStart(x.Block))
+		}
+		r.block(x.Block)
+		r.close()
+	default:
+		r.exp(stat)
+	}
+}
+
+//assign 和cgAssignStat的顺序一样：先是左边的表达式，再是右边，最后才通过_ENV给全局变量赋值
+func (r *resolver) assign(stat *ast.AssignStat) {
+	var globals []*Ref
+	for i, v := range stat.VarList {
+		if name, ok := v.(*ast.NameExp); ok {
+			if ref := r.ref(name, true); ref.Kind == Global {
+				globals = append(globals, ref)
+			}
+			continue
+		}
+		r.exp(v)
+		if i < len(stat.ExpList) {
+			if fn, ok := stat.ExpList[i].(*ast.FuncDefExp); ok && isMethod(v, fn) {
+				r.methods[fn] = true
+			}
+		}
+	}
+	r.exps(stat.ExpList)
+	for _, ref := range globals {
+		r.use(ref.Env)
+	}
+}
+
+//isMethod function a:b()的语法糖：隐含的self用的是方法名的区间
+func isMethod(v ast.Exp, fn *ast.FuncDefExp) bool {
+	access, ok := v.(*ast.TableAccessExp)
+	if !ok || len(fn.ParList) == 0 || fn.ParList[0] != "self" || len(fn.ParSpans) == 0 {
+		return false
+	}
+	key := ast.SpanOf(access.KeyExp)
+	return key != ast.Span{} && fn.ParSpans[0] == key
+}
+
+func (r *resolver) funcDef(fn *ast.FuncDefExp) {
+	r.open(FuncScope, fn)
+	for i, name := range fn.ParList {
+		span := spanAt(fn.ParSpans, i)
+		v := r.declare(name, Param, fn, i, span, span.End.Offset)
+		v.Implicit = i == 0 && r.methods[fn]
+	}
+	r.block(fn.Block)
+	r.close()
+}
+
+func (r *resolver) exps(exps []ast.Exp) {
+	for _, exp := range exps {
+		r.exp(exp)
+	}
+}
+
+//exp ast.Walk访问子表达式的顺序和codegen生成代码的顺序一样
+func (r *resolver) exp(exp ast.Exp) {
+	ast.Inspect(exp, func(node ast.Node) bool {
+		switch x := node.(type) {
+		case *ast.NameExp:
+			if ref := r.ref(x, false); ref.Kind == Global {
+				r.use(ref.Env)
+			}
+		case *ast.FuncDefExp:
+			r.funcDef(x)
+			return false
+		}
+		return true
+	})
+}
+
+func blockStart(block *ast.Block) int {
+	if block == nil {
+		return 0
+	}
+	return block.Pos.Offset
+}
+
+//spanAt 手工构造的语法树可能没有名字的区间
+func spanAt(spans []ast.Span, i int) ast.Span {
+	if i < len(spans) {
+		return spans[i]
+	}
+	return ast.Span{}
+}
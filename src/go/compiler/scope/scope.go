@@ -0,0 +1,146 @@
+/*
+Package scope 按编译器的规则解析名字：每个ast.NameExp是局部变量、upvalue还是全局变量，
+引用的是哪一个声明，以及完整的作用域树。规则和codegen的funcInfo一致：
+
+	local语句的表达式求值完以后变量才可见，local function的名字在函数体里就可见
+	函数的参数和函数体的局部变量在同一个作用域里
+	repeat的until条件能看到循环体里的局部变量
+	for循环变量只在循环体里可见
+	全局变量通过当时可见的_ENV访问，主chunk的_ENV是隐含的upvalue
+
+内层函数引用外层函数的局部变量时，中间的每一层函数都有这个upvalue，这和codegen的indexOfUpval一样，
+所以每个函数的Upvalues和codegen分配的upvalue下标一一对应。
+*/
+package scope
+
+import "go/compiler/ast"
+
+//ScopeKind 作用域的种类
+type ScopeKind int
+
+const (
+	FuncScope  ScopeKind = iota //函数，包括主chunk，参数也在这个作用域里
+	BlockScope                  //do语句和if的每个分支
+	LoopScope                   //while、repeat和for，break跳出的就是这种作用域
+)
+
+//VarKind 局部变量的种类
+type VarKind int
+
+const (
+	LocalVar  VarKind = iota //local声明的变量
+	LocalFunc                //local function声明的函数
+	Param                    //函数参数，包括方法隐含的self
+	ForVar                   //for循环变量
+	Env                      //主chunk隐含的_ENV
+)
+
+//RefKind 名字引用的种类
+type RefKind int
+
+const (
+	Global  RefKind = iota //通过_ENV访问的全局变量
+	Local                  //当前函数的局部变量
+	Upvalue                //外层函数的局部变量
+)
+
+var (
+	scopeKindNames = [...]string{FuncScope: "function", BlockScope: "block", LoopScope: "loop"}
+	varKindNames   = [...]string{LocalVar: "local", LocalFunc: "local function", Param: "parameter", ForVar: "for variable", Env: "_ENV"}
+	refKindNames   = [...]string{Global: "global", Local: "local", Upvalue: "upvalue"}
+)
+
+func (k ScopeKind) String() string { return scopeKindNames[k] }
+func (k VarKind) String() string   { return varKindNames[k] }
+func (k RefKind) String() string   { return refKindNames[k] }
+
+//Variable 一个局部变量
+type Variable struct {
+	Name     string
+	Kind     VarKind
+	Decl     ast.Node //声明它的节点：LocalVarDeclStat、LocalFuncDefStat、FuncDefExp(参数)、ForNumStat或者ForInStat，Env为nil
+	Index    int      //在声明里的下标，比如local a, b里b是1，第二个参数是1
+	Span     ast.Span //声明处名字的区间，方法隐含的self是方法名的区间
+	Start    int      //从这个字节偏移开始可见
+	Scope    *Scope   //声明它的作用域，Env为nil
+	Implicit bool     //方法隐含的self和主chunk的_ENV
+	Captured bool     //是否被内层函数当作upvalue引用
+	Refs     []*Ref   //引用它的名字，按codegen访问的顺序
+}
+
+//Ref 对一个名字的引用
+type Ref struct {
+	Name  *ast.NameExp
+	Kind  RefKind
+	Var   *Variable //Local和Upvalue时是引用的变量，Global时为nil
+	Env   *Variable //Global时是访问全局变量用的_ENV，其他时候为nil
+	Scope *Scope    //名字所在的最内层作用域
+	Write bool      //是否是赋值语句的目标
+}
+
+//Scope 作用域树的一个节点
+type Scope struct {
+	Kind ScopeKind
+	//FuncDefExp(主chunk是它的Block)、DoStat、WhileStat、RepeatStat、ForNumStat、ForInStat，if的分支是那个分支的Block
+	Node     ast.Node
+	Parent   *Scope
+	Children []*Scope
+	Vars     []*Variable //在这个作用域里声明的变量，按声明的顺序，可能同名
+	Upvalues []*Variable //只有FuncScope有：函数的upvalue，顺序就是codegen分配的upvalue下标
+}
+
+//Info 解析的结果
+type Info struct {
+	Root   *Scope      //主chunk
+	Env    *Variable   //主chunk隐含的_ENV
+	Vars   []*Variable //所有局部变量，按声明的顺序
+	Refs   map[*ast.NameExp]*Ref
+	Scopes map[ast.Node]*Scope //Scope.Node到作用域
+}
+
+//Func 返回s所在的函数的作用域
+func (s *Scope) Func() *Scope {
+	for s.Kind != FuncScope {
+		s = s.Parent
+	}
+	return s
+}
+
+//Contains offset是否在作用域的节点的区间里
+func (s *Scope) Contains(offset int) bool {
+	span := ast.SpanOf(s.Node)
+	return span.Pos.Offset <= offset && offset < span.End.Offset
+}
+
+//Innermost 返回包含offset的最内层作用域，s本身不包含offset时也返回s
+func (s *Scope) Innermost(offset int) *Scope {
+	for _, child := range s.Children {
+		if child.Contains(offset) {
+			return child.Innermost(offset)
+		}
+	}
+	return s
+}
+
+//LookupParent 从s开始向外找在offset处可见的名字为name的变量，找不到时返回nil
+func (s *Scope) LookupParent(name string, offset int) *Variable {
+	for ; s != nil; s = s.Parent {
+		for i := len(s.Vars) - 1; i >= 0; i-- {
+			if v := s.Vars[i]; v.Name == name && v.Start <= offset {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+//Lookup 源码中offset处的名字name引用的变量，nil表示全局变量；按位置查找，语法树要带有位置信息
+func (info *Info) Lookup(name string, offset int) *Variable {
+	if v := info.Root.Innermost(offset).LookupParent(name, offset); v != nil {
+		return v
+	}
+	if name == "_ENV" {
+		return info.Env
+	}
+	return nil
+}
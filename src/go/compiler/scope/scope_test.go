@@ -0,0 +1,140 @@
+package scope
+
+import (
+	"go/binchunk"
+	"go/compiler"
+	"go/compiler/ast"
+	"go/compiler/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//funcs 返回fn里直接定义的函数，顺序和codegen的Protos一样
+func funcs(fn *Scope) []*Scope {
+	var list []*Scope
+	var walk func(s *Scope)
+	walk = func(s *Scope) {
+		for _, child := range s.Children {
+			if child.Kind == FuncScope {
+				list = append(list, child)
+			} else {
+				walk(child)
+			}
+		}
+	}
+	walk(fn)
+	return list
+}
+
+func names(vars []*Variable) []string {
+	list := []string{}
+	for _, v := range vars {
+		list = append(list, v.Name)
+	}
+	return list
+}
+
+//checkUpvalues 每个函数的Upvalues和编译出来的UpvalueNames一样；
+//主chunk的upvalue只有Load设置的_ENV，codegen总是生成它而Resolve只在用到时才记录，所以不比较
+func checkUpvalues(t *testing.T, name string, fn *Scope, proto *binchunk.Prototype, main bool) {
+	t.Helper()
+	want := append([]string{}, proto.UpvalueNames...)
+	if got := names(fn.Upvalues); !main && !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: function at line %d: upvalues %v, want %v", name, proto.LineDefine, got, want)
+	}
+	children := funcs(fn)
+	if len(children) != len(proto.Protos) {
+		t.Fatalf("%s: function at line %d: %d functions, want %d", name, proto.LineDefine, len(children), len(proto.Protos))
+	}
+	for i, child := range children {
+		checkUpvalues(t, name, child, proto.Protos[i], false)
+	}
+}
+
+func resolveAndCompile(t *testing.T, name, src string) (*Info, *binchunk.Prototype) {
+	t.Helper()
+	block, err := parser.Parse(src, name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	proto, err := compiler.Compile(src, name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return Resolve(block), proto
+}
+
+func TestUpvaluesMatchCodegen(t *testing.T) {
+	sources := map[string]string{
+		"nested": `
+			local a, b, c = 1, 2, 3
+			local function f()
+				local function g() return c, a end
+				return b, g
+			end
+			function t(x) return function() return x, a, f end end`,
+		"env": `
+			local _ENV = {print = print}
+			local function f() print(1) end
+			x = function() local _ENV = {} return y end`,
+		"method": `
+			local obj = {}
+			function obj:m() return function() return self end end`,
+		"shadow": `
+			local a = 1
+			local a = 2
+			local function f() return a end
+			for i = 1, 2 do local g = function() return i, a end end`,
+	}
+	filepath.Walk("../../../lua", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, ".lua") {
+			if data, err := ioutil.ReadFile(path); err == nil {
+				src := string(data)
+				sources[path] = src[compiler.SkipComment(src):]
+			}
+		}
+		return nil
+	})
+	for name, src := range sources {
+		info, proto := resolveAndCompile(t, name, src)
+		checkUpvalues(t, name, info.Root, proto, true)
+	}
+}
+
+func TestRefs(t *testing.T) {
+	src := "local a = 1\nlocal function f(b) return a, b, c end\nlocal a = a"
+	block, err := parser.Parse(src, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := Resolve(block)
+	var got []string
+	ast.Inspect(block, func(node ast.Node) bool {
+		if name, ok := node.(*ast.NameExp); ok {
+			ref := info.Refs[name]
+			s := name.Name + " " + ref.Kind.String()
+			if ref.Var != nil {
+				s += " " + ref.Var.Kind.String()
+			}
+			got = append(got, s)
+		}
+		return true
+	})
+	want := []string{"a upvalue local", "b local parameter", "c global", "a local local"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("refs = %v, want %v", got, want)
+	}
+	if len(info.Vars) != 4 || !info.Vars[0].Captured || info.Vars[3].Captured {
+		t.Errorf("vars = %v", names(info.Vars))
+	}
+	if v := info.Lookup("a", len(src)); v != info.Vars[3] {
+		t.Errorf("Lookup(a) at the end = %v, want the second a", v)
+	}
+	if v := info.Lookup("a", strings.Index(src, "return")); v != info.Vars[0] {
+		t.Errorf("Lookup(a) in f = %v, want the first a", v)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+golua-c 是纯go实现的luac，把lua源码编译成二进制chunk：
+
+	usage: golua-c [options] [filenames]
+	  -l       列出字节码(-l -l列出常量、局部变量和upvalue)
+	  -j       以JSON的形式列出字节码，格式见disasm.Function
+	  -o name  输出到文件name(默认是luac.out)，-表示标准输出
+	  -p       只解析(编译)，不输出
+	  -s       去掉调试信息
+	  -v       显示版本信息
+	  --       不再处理选项
+	  -        不再处理选项，并且从标准输入读取
+
+多个文件合并成一个main函数，依次调用每个文件的chunk，和luac一样。
+输入也可以是二进制chunk，比如golua-c -l -p luac.out列出已经编译好的字节码。
+*/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/binchunk"
+	"go/binchunk/disasm"
+	"go/compiler"
+	"go/luavm"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	progName      = "golua-c"
+	defaultOutput = "luac.out"
+)
+
+type options struct {
+	listing   int //-l的个数
+	json      bool
+	dumping   bool
+	stripping bool
+	output    string //空串表示标准输出
+	files     []string
+}
+
+func main() {
+	opts := doArgs(os.Args[1:])
+
+	protos := make([]*binchunk.Prototype, len(opts.files))
+	for i, file := range opts.files {
+		proto, err := load(file)
+		if err != nil {
+			fatal(err.Error())
+		}
+		protos[i] = proto
+	}
+	proto := combine(protos)
+
+	if opts.json {
+		disasm.FprintJSON(os.Stdout, proto)
+	} else if opts.listing > 0 {
+		w := bufio.NewWriter(os.Stdout)
+		disasm.Fprint(w, proto, opts.listing > 1)
+		w.Flush()
+	}
+	if opts.dumping {
+		data := binchunk.Dump(proto, opts.stripping)
+		var err error
+		if opts.output == "" {
+			_, err = os.Stdout.Write(data)
+		} else {
+			err = ioutil.WriteFile(opts.output, data, 0666)
+		}
+		if err != nil {
+			fatal(fmt.Sprintf("cannot write %s: %v", outputName(opts.output), err))
+		}
+	}
+}
+
+//doArgs 和luac一样手工解析参数：-l可以重复，-既是选项的结束也是一个输入文件
+func doArgs(args []string) *options {
+	opts := &options{dumping: true, output: defaultOutput}
+	version := false
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" || arg[0] != '-' || arg == "-" {
+			break
+		}
+		if arg == "--" {
+			i++
+			break
+		}
+		switch arg {
+		case "-l":
+			opts.listing++
+		case "-j":
+			opts.json = true
+		case "-o":
+			i++
+			if i >= len(args) || args[i] == "" || (args[i][0] == '-' && args[i] != "-") {
+				usage("'-o' needs argument")
+			}
+			if opts.output = args[i]; opts.output == "-" {
+				opts.output = ""
+			}
+		case "-p":
+			opts.dumping = false
+		case "-s":
+			opts.stripping = true
+		case "-v":
+			version = true
+		default:
+			usage(fmt.Sprintf("unrecognized option '%s'", arg))
+		}
+	}
+	opts.files = args[i:]
+
+	if version {
+		fmt.Printf("%s: Lua %d.%d compatible compiler\n", progName, binchunk.LUA_VERSION>>4, binchunk.LUA_VERSION&0xF)
+		if len(opts.files) == 0 {
+			os.Exit(0)
+		}
+	}
+	if len(opts.files) == 0 {
+		//和luac一样，只列出或者只解析时默认读luac.out
+		if opts.listing == 0 && !opts.json && opts.dumping {
+			usage("no input files given")
+		}
+		opts.dumping = false
+		opts.files = []string{defaultOutput}
+	}
+	return opts
+}
+
+func usage(message string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", progName, message)
+	fmt.Fprintf(os.Stderr, "usage: %s [options] [filenames]\n"+
+		"Available options are:\n"+
+		"  -l       list (use -l -l for full listing)\n"+
+		"  -j       list as JSON\n"+
+		"  -o name  output to file 'name' (default is \"%s\")\n"+
+		"  -p       parse only\n"+
+		"  -s       strip debug information\n"+
+		"  -v       show version information\n"+
+		"  --       stop handling options\n"+
+		"  -        stop handling options and process stdin\n",
+		progName, defaultOutput)
+	os.Exit(1)
+}
+
+func fatal(message string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", progName, message)
+	os.Exit(1)
+}
+
+func outputName(output string) string {
+	if output == "" {
+		return "stdout"
+	}
+	return output
+}
+
+//load 编译一个文件，-表示标准输入；Source和luac一样是@文件名或者=stdin
+func load(file string) (proto *binchunk.Prototype, err error) {
+	var data []byte
+	source, name := "@"+file, file
+	if file == "-" {
+		source, name = "=stdin", "stdin"
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s", name)
+	}
+
+	if strings.HasPrefix(string(data), binchunk.LUA_SIGNATURE) {
+		if proto, err = binchunk.UndumpErr(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return proto, nil
+	}
+
+	src := string(data)
+	return compiler.Compile(src[compiler.SkipComment(src):], source)
+}
+
+//combine 多个chunk合并成一个main函数，依次调用每个chunk；和luac一样，
+//main函数的代码相当于编译n遍"(function()end)();"，每个chunk的_ENV改成main函数的upvalue
+func combine(protos []*binchunk.Prototype) *binchunk.Prototype {
+	if len(protos) == 1 {
+		return protos[0]
+	}
+	main := &binchunk.Prototype{
+		Source:        "=(luac)",
+		IsVarargs:     1,
+		MaxStatckSize: 2,
+		Upvalues:      []binchunk.Upvalue{{Instatck: 1, Idx: 0}},
+		Protos:        protos,
+		UpvalueNames:  []string{"_ENV"},
+	}
+	for i, proto := range protos {
+		main.Code = append(main.Code,
+			uint32(i<<14|luavm.OP_CLOSURE),    // CLOSURE 0 i
+			uint32(1<<23|1<<14|luavm.OP_CALL)) // CALL 0 1 1
+		if len(proto.Upvalues) > 0 {
+			proto.Upvalues[0].Instatck = 0
+		}
+	}
+	main.Code = append(main.Code, uint32(1<<23|luavm.OP_RETURN)) // RETURN 0 1
+	return main
+}
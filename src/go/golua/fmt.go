@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/compiler"
+	"go/compiler/parser"
+	"go/compiler/printer"
+	"io/ioutil"
+	"os"
+)
+
+//runFmt 和gofmt一样：不带文件时从标准输入读、向标准输出写；-w直接改写文件，-check只列出格式不对的文件
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "把结果写回源文件，而不是输出到标准输出")
+	check := flags.Bool("check", false, "只列出格式不对的文件，有这样的文件时退出码为1")
+	indent := flags.Int("indent", 0, "每一层缩进的空格数，0表示用tab")
+	quote := flags.String("quote", "double", "短字符串的引号：double或single")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: golua fmt [flags] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	cfg := &printer.Config{Indent: *indent}
+	switch *quote {
+	case "double":
+		cfg.Quote = printer.DoubleQuote
+	case "single":
+		cfg.Quote = printer.SingleQuote
+	default:
+		fmt.Fprintf(os.Stderr, "golua fmt: invalid -quote %q\n", *quote)
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "golua fmt: cannot use -w with standard input\n")
+			return 2
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err == nil {
+			err = fmtFile(cfg, "<standard input>", src, *check)
+		}
+		return report(err)
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		err := walkLuaFiles(path, func(file string, info os.FileInfo) error {
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if *write {
+				err = fmtWrite(cfg, file, src, info.Mode())
+			} else {
+				err = fmtFile(cfg, file, src, *check)
+			}
+			if code := report(err); code > status {
+				status = code
+			}
+			return nil
+		})
+		if err != nil {
+			report(err)
+			status = 2
+		}
+	}
+	return status
+}
+
+//errNotFormatted -check发现文件需要格式化
+type errNotFormatted string
+
+func (err errNotFormatted) Error() string {
+	return string(err)
+}
+
+//report 输出错误并返回对应的退出码
+func report(err error) int {
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case errNotFormatted:
+		fmt.Println(string(err))
+		return 1
+	default:
+		fmt.Fprintf(os.Stderr, "golua fmt: %v\n", err)
+		return 2
+	}
+}
+
+//format 不折叠常量，否则格式化会改变程序的语义
+//BOM和#开头的第一行原样保留
+func format(cfg *printer.Config, name string, src []byte) ([]byte, error) {
+	n := compiler.SkipComment(string(src))
+	block, comments, err := parser.ParseComments(string(src[n:]), "@"+name, 0)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(src[:n])
+	if len(bytes.TrimPrefix(src[:n], []byte("\xEF\xBB\xBF"))) > 0 {
+		buf.WriteString("\n")
+	}
+	if err := cfg.Fprint(&buf, &printer.CommentedNode{Node: block, Comments: comments}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func fmtFile(cfg *printer.Config, name string, src []byte, check bool) error {
+	res, err := format(cfg, name, src)
+	if err != nil {
+		return err
+	}
+	if check {
+		if !bytes.Equal(src, res) {
+			return errNotFormatted(name)
+		}
+		return nil
+	}
+	_, err = os.Stdout.Write(res)
+	return err
+}
+
+func fmtWrite(cfg *printer.Config, name string, src []byte, perm os.FileMode) error {
+	res, err := format(cfg, name, src)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	return ioutil.WriteFile(name, res, perm)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/compiler"
+	"go/lint"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//runLint 检查lua源码：不带文件时检查标准输入；有问题时退出码为1，出错时为2
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "以JSON数组的形式输出所有问题")
+	config := flags.String("config", "", "JSON格式的配置文件，字段见lint.Config")
+	globals := flags.String("globals", "", "逗号分隔的全局变量，脚本可以读写")
+	readGlobals := flags.String("read-globals", "", "逗号分隔的只读全局变量")
+	disable := flags.String("disable", "", "逗号分隔的不做的检查，比如unused-param,shadowed-local")
+	enable := flags.String("enable", "", "逗号分隔的默认不做的检查，比如max-arity")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: golua lint [flags] [path ...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	cfg := &lint.Config{}
+	if *config != "" {
+		data, err := ioutil.ReadFile(*config)
+		if err == nil {
+			err = json.Unmarshal(data, cfg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "golua lint: config: %v\n", err)
+			return 2
+		}
+	}
+	cfg.Globals = append(cfg.Globals, splitList(*globals)...)
+	cfg.ReadGlobals = append(cfg.ReadGlobals, splitList(*readGlobals)...)
+	cfg.Disable = append(cfg.Disable, splitList(*disable)...)
+	cfg.Enable = append(cfg.Enable, splitList(*enable)...)
+
+	issues := []lint.Issue{}
+	status := 0
+	if flags.NArg() == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "golua lint: %v\n", err)
+			return 2
+		}
+		issues = lint.Lint("<standard input>", compiler.MaskComment(string(src)), cfg)
+	}
+	for _, path := range flags.Args() {
+		err := walkLuaFiles(path, func(file string, info os.FileInfo) error {
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			issues = append(issues, lint.Lint(file, compiler.MaskComment(string(src)), cfg)...)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "golua lint: %v\n", err)
+			status = 2
+		}
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(issues, "", "  ")
+		fmt.Printf("%s\n", data)
+	} else {
+		for i := range issues {
+			fmt.Println(issues[i].String())
+		}
+	}
+	if len(issues) > 0 && status == 0 {
+		status = 1
+	}
+	return status
+}
+
+//splitList 把逗号分隔的列表拆开，去掉空白和空项
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/lsp"
+	"os"
+)
+
+//runLsp 在标准输入输出上运行语言服务器，编辑器负责启动这个进程
+func runLsp(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: golua lsp\n\n通过标准输入输出和编辑器交换LSP消息\n")
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	switch err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err {
+	case nil:
+		return 0
+	case lsp.ErrNoShutdown:
+		return 1
+	default:
+		fmt.Fprintf(os.Stderr, "golua lsp: %v\n", err)
+		return 1
+	}
+}
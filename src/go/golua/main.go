@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//command golua的一个子命令，args不包含子命令的名字，返回值是进程的退出码
+type command struct {
+	name  string
+	short string
+	run   func(args []string) int
+}
+
+var commands = []*command{
+	{"fmt", "格式化lua源码", runFmt},
+	{"lint", "静态检查lua源码", runLint},
+	{"lsp", "运行语言服务器(LSP)，通过标准输入输出通信", runLsp},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "golua: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: golua <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-8s %s\n", cmd.name, cmd.short)
+	}
+}
+
+//walkLuaFiles 对path下所有的.lua文件调用f，path本身是文件时不管后缀名都调用
+func walkLuaFiles(path string, f func(file string, info os.FileInfo) error) error {
+	return filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (file != path && !strings.HasSuffix(file, ".lua")) {
+			return nil
+		}
+		return f(file, info)
+	})
+}
@@ -0,0 +1,389 @@
+package lint
+
+import (
+	"go/compiler/ast"
+	"go/compiler/lexer"
+	"go/compiler/scope"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var varKindNames = map[scope.VarKind]string{
+	scope.LocalVar:  "local",
+	scope.LocalFunc: "local function",
+	scope.Param:     "parameter",
+	scope.ForVar:    "loop variable",
+}
+
+type checker struct {
+	chunkName string
+	src       string
+	issues    []Issue
+	info      *scope.Info
+	known     map[string]bool  //允许列表里的全局变量
+	readOnly  map[string]bool  //只读的全局变量
+	functions map[string]Arity //已知参数个数的函数
+	defined   map[string]bool  //本文件里赋过值的全局变量
+}
+
+func newChecker(chunkName, src string, cfg *Config) *checker {
+	c := &checker{
+		chunkName: chunkName,
+		src:       src,
+		known:     map[string]bool{},
+		readOnly:  map[string]bool{},
+		functions: map[string]Arity{},
+		defined:   map[string]bool{},
+	}
+	if !cfg.NoStd {
+		for _, name := range stdGlobals {
+			c.known[name] = true
+			c.readOnly[name] = true
+		}
+		for name, arity := range stdFunctions {
+			c.functions[name] = arity
+		}
+	}
+	for _, name := range cfg.Globals {
+		c.known[name] = true
+		c.readOnly[name] = false
+	}
+	for _, name := range cfg.ReadGlobals {
+		c.known[name] = true
+		c.readOnly[name] = true
+	}
+	for name, arity := range cfg.Functions {
+		c.functions[name] = arity
+		root := name
+		if i := strings.Index(name, "."); i >= 0 {
+			root = name[:i]
+		}
+		if !c.known[root] {
+			c.known[root] = true
+			c.readOnly[root] = true
+		}
+	}
+	return c
+}
+
+func (c *checker) check(block *ast.Block) {
+	c.info = scope.Resolve(block)
+	for _, v := range c.info.Vars {
+		c.checkShadowed(v)
+	}
+	for _, v := range c.info.Vars {
+		c.checkUnused(v)
+	}
+
+	//按源码的顺序访问名字，全局变量要等所有的赋值都找到以后才知道有没有定义
+	var reads []*scope.Ref
+	ast.Inspect(block, func(node ast.Node) bool {
+		switch x := node.(type) {
+		case *ast.Block:
+			c.reachability(x)
+		case *ast.FuncCallExp:
+			c.checkArity(x)
+		case *ast.NameExp:
+			ref := c.info.Refs[x]
+			if ref == nil {
+				break
+			}
+			if ref.Write {
+				c.checkAssign(ref)
+			} else if ref.Kind == scope.Global {
+				reads = append(reads, ref)
+			}
+		}
+		return true
+	})
+	for _, ref := range reads {
+		name := ref.Name.Name
+		if c.known[name] || c.defined[name] {
+			continue
+		}
+		if similar := c.suggest(name); similar != "" {
+			c.report(ref.Name.Span, "undefined-global", "accessing undefined global '%s' (did you mean '%s'?)", name, similar)
+		} else {
+			c.report(ref.Name.Span, "undefined-global", "accessing undefined global '%s'", name)
+		}
+	}
+}
+
+//checkShadowed 声明v的时候有没有同名的局部变量可见
+func (c *checker) checkShadowed(v *scope.Variable) {
+	if v.Implicit || strings.HasPrefix(v.Name, "_") {
+		return
+	}
+	prev := v.Scope.LookupParent(v.Name, v.Span.Pos.Offset)
+	if prev == nil {
+		return
+	}
+	what := "a local"
+	if prev.Scope.Func() != v.Scope.Func() {
+		what = "an upvalue"
+	}
+	c.report(v.Span, "shadowed-local", "%s '%s' shadows %s declared on line %d",
+		varKindNames[v.Kind], v.Name, what, prev.Span.Pos.Line)
+}
+
+func (c *checker) checkUnused(v *scope.Variable) {
+	if v.Implicit || strings.HasPrefix(v.Name, "_") || isRead(v) {
+		return
+	}
+	switch v.Kind {
+	case scope.Param:
+		for _, other := range v.Scope.Vars {
+			if other.Kind == scope.Param && other.Index > v.Index && isRead(other) {
+				return //后面的参数用到了，这个参数去不掉
+			}
+		}
+		c.report(v.Span, "unused-param", "unused parameter '%s'", v.Name)
+	case scope.LocalFunc:
+		c.report(v.Span, "unused-local", "unused local function '%s'", v.Name)
+	case scope.ForVar:
+		c.report(v.Span, "unused-local", "unused loop variable '%s'", v.Name)
+	default:
+		c.report(v.Span, "unused-local", "unused local variable '%s'", v.Name)
+	}
+}
+
+//isRead 变量有没有被读取过，赋值不算
+func isRead(v *scope.Variable) bool {
+	for _, ref := range v.Refs {
+		if !ref.Write {
+			return true
+		}
+	}
+	return false
+}
+
+//checkAssign 给for循环变量和只读全局变量赋值
+func (c *checker) checkAssign(ref *scope.Ref) {
+	name := ref.Name
+	switch {
+	case ref.Var != nil && ref.Var.Kind == scope.ForVar:
+		c.report(name.Span, "assign-to-constant", "assignment to loop variable '%s'", name.Name)
+	case ref.Kind == scope.Global:
+		if c.readOnly[name.Name] {
+			c.report(name.Span, "assign-to-constant", "assignment to read-only global '%s'", name.Name)
+		}
+		c.defined[name.Name] = true
+	}
+}
+
+//checkArity 参数太少是arity，太多是max-arity；
+//最后一个参数是函数调用或者...时参数个数不确定，只能检查是不是太多
+func (c *checker) checkArity(call *ast.FuncCallExp) {
+	if call.NameExp != nil {
+		return
+	}
+	name := c.globalName(call.PrefixExp)
+	arity, found := c.functions[name]
+	if name == "" || !found {
+		return
+	}
+	n := len(call.Args)
+	open := false
+	if n > 0 {
+		switch call.Args[n-1].(type) {
+		case *ast.FuncCallExp, *ast.VarargExp:
+			open = true
+			n--
+		}
+	}
+	got := arguments(n)
+	switch {
+	case arity.Max >= 0 && n > arity.Max:
+		if open {
+			got = "at least " + got
+		}
+		c.report(call.Span, "max-arity", "'%s' expects %s, got %s", name, expects(arity), got)
+	case !open && n < arity.Min:
+		c.report(call.Span, "arity", "'%s' expects %s, got %s", name, expects(arity), got)
+	}
+}
+
+func expects(arity Arity) string {
+	switch {
+	case arity.Max < 0:
+		return "at least " + arguments(arity.Min)
+	case arity.Min == arity.Max:
+		return arguments(arity.Min)
+	default:
+		return strconv.Itoa(arity.Min) + " to " + arguments(arity.Max)
+	}
+}
+
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return strconv.Itoa(n) + " arguments"
+}
+
+//globalName 没有被局部变量遮住的全局变量，或者os.time这样的全局变量的字段；别的表达式返回空串
+func (c *checker) globalName(exp ast.Exp) string {
+	switch x := exp.(type) {
+	case *ast.NameExp:
+		if ref := c.info.Refs[x]; ref != nil && ref.Kind == scope.Global {
+			return x.Name
+		}
+	case *ast.TableAccessExp:
+		key, ok := x.KeyExp.(*ast.StringExp)
+		if prefix := c.globalName(x.PrefixExp); ok && prefix != "" {
+			return prefix + "." + key.Val
+		}
+	}
+	return ""
+}
+
+//reachability 报告return、break、goto之后，到下一个label之前的语句
+func (c *checker) reachability(block *ast.Block) {
+	dead, reported := false, false
+	for _, stat := range block.Stats {
+		switch stat.(type) {
+		case *ast.LabelStat:
+			dead, reported = false, false
+			continue
+		case *ast.EmptyStat:
+			continue
+		}
+		if dead && !reported {
+			c.report(ast.SpanOf(stat), "unreachable", "unreachable code")
+			reported = true
+		}
+		if terminates(stat) {
+			dead = true
+		}
+	}
+	if dead && !reported && block.RetExps != nil {
+		c.report(c.returnSpan(block), "unreachable", "unreachable code")
+	}
+}
+
+//terminates 语句执行完之后不会接着执行后面的语句
+func terminates(stat ast.Stat) bool {
+	switch x := stat.(type) {
+	case *ast.BreakStat, *ast.GotoStat:
+		return true
+	case *ast.DoStat:
+		return blockTerminates(x.Block)
+	case *ast.IfStat:
+		//有else分支(最后一个条件是true)并且每个分支都跳走了
+		if len(x.Exps) == 0 {
+			return false
+		}
+		if _, ok := x.Exps[len(x.Exps)-1].(*ast.TrueExp); !ok {
+			return false
+		}
+		for _, block := range x.Blocks {
+			if !blockTerminates(block) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func blockTerminates(block *ast.Block) bool {
+	if block.RetExps != nil {
+		return true
+	}
+	dead := false
+	for _, stat := range block.Stats {
+		if _, ok := stat.(*ast.LabelStat); ok {
+			dead = false
+		} else if terminates(stat) {
+			dead = true
+		}
+	}
+	return dead
+}
+
+//returnSpan 语法树里没有return关键字的位置，从block的最后一条语句后面开始找
+func (c *checker) returnSpan(block *ast.Block) ast.Span {
+	from := block.Pos.Offset
+	if n := len(block.Stats); n > 0 {
+		from = ast.SpanOf(block.Stats[n-1]).End.Offset
+	}
+	le := lexer.NewLexer(c.src[from:], c.chunkName)
+	for {
+		if _, kind, _ := le.NextToken(); kind == lexer.TOKEN_KW_RETURN || kind == lexer.TOKEN_EOF {
+			break
+		}
+	}
+	return ast.Span{Pos: c.pos(from + le.TokenStart().Offset), End: c.pos(from + le.TokenEnd().Offset)}
+}
+
+//pos 把字节偏移换成行号和列号，换行的规则和词法分析器一样
+func (c *checker) pos(offset int) ast.Pos {
+	line, lineStart := 1, 0
+	for i := 0; i < offset; i++ {
+		if ch := c.src[i]; ch == '\r' || ch == '\n' {
+			if i+1 < len(c.src) && (c.src[i+1] == '\r' || c.src[i+1] == '\n') && c.src[i+1] != ch {
+				i++
+			}
+			line++
+			lineStart = i + 1
+		}
+	}
+	return ast.Pos{Line: line, Column: offset - lineStart + 1, Offset: offset}
+}
+
+//suggest 找一个和name拼写相近的全局变量，用于提示拼写错误
+func (c *checker) suggest(name string) string {
+	var names []string
+	for n := range c.known {
+		names = append(names, n)
+	}
+	for n := range c.defined {
+		if !c.known[n] {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	best, bestDist := "", (len(name)+1)/3+1
+	for _, n := range names {
+		if d := editDistance(name, n); d < bestDist {
+			best, bestDist = n, d
+		}
+	}
+	return best
+}
+
+//editDistance 编辑距离，交换相邻两个字符算一次编辑
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min(x int, ys ...int) int {
+	for _, y := range ys {
+		if y < x {
+			x = y
+		}
+	}
+	return x
+}
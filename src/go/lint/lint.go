@@ -0,0 +1,134 @@
+/*
+Package lint 对lua源码做静态检查，作用域规则和codegen一致。
+
+检查的问题(括号里是Issue.Code)：
+	语法错误(syntax)，有语法错误时不做其他检查
+	读取未定义的全局变量(undefined-global)，全局变量在允许列表里或者在本文件里赋过值才算定义过
+	没有用到的局部变量和参数(unused-local、unused-param)，以_开头的名字不检查
+	局部变量遮住外层的同名局部变量(shadowed-local)
+	return、break、goto之后执行不到的代码(unreachable)
+	给for循环变量或者只读全局变量赋值(assign-to-constant)
+	调用已知的函数时参数太少(arity)
+	调用已知的函数时参数太多(max-arity)，lua会忽略多余的参数，所以默认不检查，要用Config.Enable打开
+*/
+package lint
+
+import (
+	"fmt"
+	"go/compiler/ast"
+	"go/compiler/lexer"
+	"go/compiler/parser"
+	"sort"
+)
+
+//Issue 检查出的一个问题，行号和列号从1开始，列号按字节计算，为0时表示未知
+type Issue struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+//String 和编译器报错的格式一样：file:line:column: message [code]
+func (issue *Issue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s [%s]", issue.File, issue.Line, issue.Column, issue.Message, issue.Code)
+}
+
+//Arity 函数的参数个数，Max小于0表示参数个数不限
+type Arity struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+//Config 检查的配置，所有列表都是在标准库之外追加的
+type Config struct {
+	Globals     []string         `json:"globals"`     //脚本可以读写的全局变量
+	ReadGlobals []string         `json:"readGlobals"` //只读的全局变量，给它们赋值是assign-to-constant
+	Functions   map[string]Arity `json:"functions"`   //宿主用Go注册的函数，键是print或者os.time这样的名字，第一段自动成为只读全局变量
+	Disable     []string         `json:"disable"`     //不做的检查，值是Issue.Code
+	Enable      []string         `json:"enable"`      //默认不做的检查，见optIn
+	NoStd       bool             `json:"noStd"`       //不使用lua 5.3标准库的全局变量和函数
+}
+
+//optIn 默认不做的检查
+var optIn = map[string]bool{
+	"max-arity": true,
+}
+
+//Lint 检查一个chunk，chunkName用作Issue.File，cfg为nil时只使用标准库；返回的问题按位置排列
+func Lint(chunkName, src string, cfg *Config) []Issue {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	c := newChecker(chunkName, src, cfg)
+	block, err := parser.ParseMode(src, chunkName, parser.RecoverErrors)
+	switch err := err.(type) {
+	case nil:
+		c.check(block)
+	case parser.ErrorList:
+		for _, e := range err {
+			c.syntaxError(e)
+		}
+	case *lexer.SyntaxError:
+		c.syntaxError(err)
+	}
+
+	disabled := map[string]bool{}
+	for code := range optIn {
+		disabled[code] = true
+	}
+	for _, code := range cfg.Enable {
+		disabled[code] = false
+	}
+	for _, code := range cfg.Disable {
+		disabled[code] = true
+	}
+	issues := []Issue{}
+	for _, issue := range c.issues {
+		if !disabled[issue.Code] {
+			issues = append(issues, issue)
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues
+}
+
+func (c *checker) report(span ast.Span, code, f string, a ...interface{}) {
+	c.issues = append(c.issues, Issue{
+		File:      c.chunkName,
+		Line:      span.Pos.Line,
+		Column:    span.Pos.Column,
+		EndLine:   span.End.Line,
+		EndColumn: span.End.Column,
+		Code:      code,
+		Message:   fmt.Sprintf(f, a...),
+	})
+}
+
+func (c *checker) syntaxError(err *lexer.SyntaxError) {
+	msg := err.Msg
+	switch err.Token {
+	case "":
+	case "<eof>":
+		msg += " near <eof>"
+	default:
+		msg += " near '" + err.Token + "'"
+	}
+	c.issues = append(c.issues, Issue{
+		File:      c.chunkName,
+		Line:      err.Line,
+		Column:    err.Column,
+		EndLine:   err.Line,
+		EndColumn: err.Column,
+		Code:      "syntax",
+		Message:   msg,
+	})
+}
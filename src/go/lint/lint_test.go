@@ -0,0 +1,78 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func codes(issues []Issue) []string {
+	var list []string
+	for _, issue := range issues {
+		list = append(list, issue.Code)
+	}
+	return list
+}
+
+func TestIssueCodes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"x = = 1", []string{"syntax"}},
+		{"print(undefinedName)", []string{"undefined-global"}},
+		{"x = 1 print(x)", nil},
+		{"local a = 1", []string{"unused-local"}},
+		{"local _a = 1", nil},
+		{"local function f(a) end f()", []string{"unused-param"}},
+		{"local function f(a, ...) return ... end f()", []string{"unused-param"}},
+		{"local a = 1 do local a = 2 print(a) end print(a)", []string{"shadowed-local"}},
+		{"local function f() do return end print(1) end f()", []string{"unreachable"}},
+		{"for i = 1, 2 do i = i + 1 end", []string{"assign-to-constant"}},
+		{"string = 1", []string{"assign-to-constant"}},
+		{"print(rawget({}))", []string{"arity"}},
+		{"print(setmetatable({}, nil, 1, 2))", nil},
+		{"print(tostring(1, 2, 3))", nil},
+		{"print(rawget(...))", nil},
+	}
+	for _, tt := range tests {
+		if got := codes(Lint("test", tt.src, nil)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tests := []struct {
+		src  string
+		cfg  Config
+		want []string
+	}{
+		{"print(tostring(1, 2, 3))", Config{Enable: []string{"max-arity"}}, []string{"max-arity"}},
+		{"print(tostring(1, 2, 3))", Config{Enable: []string{"max-arity"}, Disable: []string{"max-arity"}}, nil},
+		{"local a = 1", Config{Disable: []string{"unused-local"}}, nil},
+		{"host = 1 print(host)", Config{Globals: []string{"host"}}, nil},
+		{"host = 1", Config{ReadGlobals: []string{"host"}}, []string{"assign-to-constant"}},
+		{"app.run()", Config{Functions: map[string]Arity{"app.run": {Min: 1, Max: 1}}}, []string{"arity"}},
+		{"app.run(1)", Config{Functions: map[string]Arity{"app.run": {Min: 1, Max: 1}}}, nil},
+		{"print(1)", Config{NoStd: true}, []string{"undefined-global"}},
+	}
+	for _, tt := range tests {
+		cfg := tt.cfg
+		if got := codes(Lint("test", tt.src, &cfg)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q %+v: got %v, want %v", tt.src, tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestIssuePosition(t *testing.T) {
+	issues := Lint("test.lua", "local x = 1\nprint(y)\n", nil)
+	if len(issues) != 2 {
+		t.Fatalf("got %v", issues)
+	}
+	if got, want := issues[1].String(), "test.lua:2:7: accessing undefined global 'y' [undefined-global]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if issues[0].Line != 1 || issues[0].Code != "unused-local" {
+		t.Errorf("got %v, want unused-local on line 1", issues[0])
+	}
+}
@@ -0,0 +1,37 @@
+package lint
+
+//stdGlobals lua 5.3标准库的全局变量，脚本只能读不能改
+var stdGlobals = []string{
+	"_G", "_VERSION", "assert", "collectgarbage", "dofile", "error", "getmetatable",
+	"ipairs", "load", "loadfile", "next", "pairs", "pcall", "print", "rawequal",
+	"rawget", "rawlen", "rawset", "require", "select", "setmetatable", "tonumber",
+	"tostring", "type", "xpcall",
+	"coroutine", "debug", "io", "math", "os", "package", "string", "table", "utf8",
+}
+
+//stdFunctions 基础库函数的参数个数，按lua 5.3手册
+var stdFunctions = map[string]Arity{
+	"assert":         {1, -1},
+	"collectgarbage": {0, 2},
+	"dofile":         {0, 1},
+	"error":          {0, 2},
+	"getmetatable":   {1, 1},
+	"ipairs":         {1, 1},
+	"load":           {1, 4},
+	"loadfile":       {0, 3},
+	"next":           {1, 2},
+	"pairs":          {1, 1},
+	"pcall":          {1, -1},
+	"print":          {0, -1},
+	"rawequal":       {2, 2},
+	"rawget":         {2, 2},
+	"rawlen":         {1, 1},
+	"rawset":         {3, 3},
+	"require":        {1, 1},
+	"select":         {1, -1},
+	"setmetatable":   {2, 2},
+	"tonumber":       {1, 2},
+	"tostring":       {1, 1},
+	"type":           {1, 1},
+	"xpcall":         {2, -1},
+}
@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+)
+
+//Client 一个最简单的同步客户端，用来在进程内按脚本驱动Server，比如测试或者调试。
+//收到的消息由一个goroutine一直读出来排队，服务器发通知时不会因为客户端在写请求而卡住
+type Client struct {
+	conn   *conn
+	nextID int
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*Message //已经收到还没取走的消息，按顺序排列
+	err    error      //读消息出的错，之后不会再收到消息
+}
+
+//NewClient 创建从r读消息、往w写消息的客户端
+func NewClient(r io.Reader, w io.Writer) *Client {
+	c := &Client{conn: newConn(r, w)}
+	c.cond = sync.NewCond(&c.mu)
+	go c.readLoop()
+	return c
+}
+
+//Pipe 创建一对用管道连起来的客户端和服务器，调用者需要在另一个goroutine里运行server.Serve()；
+//Serve返回后管道被关闭，客户端的Call和ReadNotification返回错误
+func Pipe() (*Client, *Server) {
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+	s := NewServer(serverR, serverW)
+	s.closers = []io.Closer{serverR, serverW}
+	return NewClient(clientR, clientW), s
+}
+
+func (c *Client) readLoop() {
+	for {
+		msg, err := c.conn.read()
+		c.mu.Lock()
+		if err != nil {
+			c.err = err
+		} else {
+			c.queue = append(c.queue, msg)
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+//next 取走队列里第一个满足match的消息，没有时等待
+func (c *Client) next(match func(*Message) bool) (*Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		for i, msg := range c.queue {
+			if match(msg) {
+				c.queue = append(c.queue[:i], c.queue[i+1:]...)
+				return msg, nil
+			}
+		}
+		if c.err != nil {
+			return nil, c.err
+		}
+		c.cond.Wait()
+	}
+}
+
+//Call 发送请求并等待响应，把结果解析到result里(result为nil时丢掉)；服务器返回错误时err是*ResponseError
+func (c *Client) Call(method string, params, result interface{}) error {
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if err := c.conn.write(&Message{ID: &id, Method: method, Params: data}); err != nil {
+		return err
+	}
+
+	msg, err := c.next(func(msg *Message) bool {
+		return msg.Method == "" && msg.ID != nil && string(*msg.ID) == string(id)
+	})
+	if err != nil {
+		return err
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if result == nil || msg.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(*msg.Result, result)
+}
+
+//Notify 发送通知
+func (c *Client) Notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.conn.write(&Message{Method: method, Params: data})
+}
+
+//ReadNotification 返回下一个服务器发来的通知，没有时阻塞等待
+func (c *Client) ReadNotification() (*Message, error) {
+	return c.next(func(msg *Message) bool { return msg.Method != "" })
+}
@@ -0,0 +1,182 @@
+package lsp
+
+import (
+	"go/compiler"
+	"go/compiler/ast"
+	"go/compiler/lexer"
+	"go/compiler/parser"
+	"path"
+	"sort"
+	"unicode/utf8"
+)
+
+//document 一个打开着的文档以及对它的分析结果，文本每次变化都重新分析
+type document struct {
+	uri     string
+	version int
+	text    string
+	lines   []int //每一行第一个字节的偏移，换行的规则和词法分析器一样
+	block   *ast.Block
+	errs    []*lexer.SyntaxError
+	tokens  []*lexer.Token
+	names   *resolution
+}
+
+func newDocument(uri string, version int, text string) *document {
+	doc := &document{uri: uri, version: version, text: text}
+	doc.analyze()
+	return doc
+}
+
+func (doc *document) analyze() {
+	doc.lines = lineStarts(doc.text)
+	chunkName := path.Base(doc.uri)
+	text := compiler.MaskComment(doc.text) //BOM和#!开头的第一行换成空格，位置不变
+	block, err := parser.ParseMode(text, chunkName, parser.RecoverErrors)
+	switch err := err.(type) {
+	case nil:
+		doc.errs = nil
+	case parser.ErrorList:
+		doc.errs = err
+	case *lexer.SyntaxError:
+		doc.errs = []*lexer.SyntaxError{err}
+	}
+	if block == nil {
+		block = &ast.Block{}
+	}
+	doc.block = block
+
+	le := lexer.NewLexerMode(text, chunkName, lexer.KeepComments)
+	le.SetErrorHandler(func(*lexer.SyntaxError) {}) //错误已经由parser报告过了
+	for {
+		if _, kind, _ := le.NextToken(); kind == lexer.TOKEN_EOF {
+			break
+		}
+	}
+	doc.tokens = le.Tokens()
+	doc.names = resolve(text, block)
+}
+
+func lineStarts(text string) []int {
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; c == '\r' || c == '\n' {
+			if i+1 < len(text) && (text[i+1] == '\r' || text[i+1] == '\n') && text[i+1] != c {
+				i++ //\r\n和\n\r都算一个换行
+			}
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+//position 把字节偏移换成LSP的位置
+func (doc *document) position(offset int) Position {
+	if offset > len(doc.text) {
+		offset = len(doc.text)
+	}
+	line := sort.Search(len(doc.lines), func(i int) bool { return doc.lines[i] > offset }) - 1
+	return Position{Line: line, Character: utf16Len(doc.text[doc.lines[line]:offset])}
+}
+
+//offset 把LSP的位置换成字节偏移，超出行尾时取行尾
+func (doc *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(doc.lines) {
+		return len(doc.text)
+	}
+	offset, end := doc.lines[pos.Line], doc.lineEnd(pos.Line)
+	for n := 0; n < pos.Character && offset < end; {
+		r, size := utf8.DecodeRuneInString(doc.text[offset:end])
+		n += runeLen16(r)
+		offset += size
+	}
+	return offset
+}
+
+//lineEnd 第line行换行符的位置
+func (doc *document) lineEnd(line int) int {
+	end := len(doc.text)
+	if line+1 < len(doc.lines) {
+		end = doc.lines[line+1]
+	}
+	for end > doc.lines[line] && (doc.text[end-1] == '\r' || doc.text[end-1] == '\n') {
+		end--
+	}
+	return end
+}
+
+func (doc *document) rangeOf(span ast.Span) Range {
+	return Range{Start: doc.position(span.Pos.Offset), End: doc.position(span.End.Offset)}
+}
+
+//errorRange 语法错误只有行号和列号，范围覆盖错误附近的token
+func (doc *document) errorRange(err *lexer.SyntaxError) Range {
+	line := err.Line - 1
+	if line < 0 || line >= len(doc.lines) {
+		end := doc.position(len(doc.text))
+		return Range{Start: end, End: end}
+	}
+	start := doc.lines[line]
+	if err.Column > 0 {
+		start += err.Column - 1
+	}
+	end := start
+	if err.Token != "<eof>" && start+len(err.Token) <= doc.lineEnd(line) {
+		end = start + len(err.Token)
+	}
+	return Range{Start: doc.position(start), End: doc.position(end)}
+}
+
+func (doc *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, err := range doc.errs {
+		msg := err.Msg
+		switch err.Token {
+		case "":
+		case "<eof>":
+			msg += " near <eof>"
+		default:
+			msg += " near '" + err.Token + "'"
+		}
+		diags = append(diags, Diagnostic{
+			Range:    doc.errorRange(err),
+			Severity: SeverityError,
+			Source:   "golua",
+			Message:  msg,
+		})
+	}
+	return diags
+}
+
+//applyChange 把一次修改应用到文本上，不重新分析
+func (doc *document) applyChange(change TextDocumentContentChangeEvent) {
+	if change.Range == nil {
+		doc.text = change.Text
+	} else {
+		start, end := doc.offset(change.Range.Start), doc.offset(change.Range.End)
+		if end < start {
+			start, end = end, start
+		}
+		doc.text = doc.text[:start] + change.Text + doc.text[end:]
+	}
+	doc.lines = lineStarts(doc.text)
+}
+
+//utf16Len s按UTF-16编码时的长度，LSP的列号是这样算的
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeLen16(r)
+	}
+	return n
+}
+
+func runeLen16(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,290 @@
+package lsp
+
+import (
+	"fmt"
+	"go/compiler/ast"
+	"go/compiler/lexer"
+	"go/compiler/scope"
+	"strings"
+)
+
+//documentSymbols 函数和局部变量，函数里面声明的符号作为它的子节点
+func (doc *document) documentSymbols(block *ast.Block) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	if block == nil {
+		return symbols
+	}
+	for _, stat := range block.Stats {
+		symbols = append(symbols, doc.statSymbols(stat)...)
+	}
+	return symbols
+}
+
+func (doc *document) statSymbols(stat ast.Stat) []DocumentSymbol {
+	var symbols []DocumentSymbol
+	switch x := stat.(type) {
+	case *ast.LocalFuncDefStat:
+		symbols = append(symbols, doc.funcSymbol(x.Name, SymbolFunction, x.Span, x.NameSpan, x.Exp))
+	case *ast.LocalVarDeclStat:
+		for i, name := range x.NameList {
+			span := spanAt(x.NameSpans, i)
+			if i < len(x.ExpList) {
+				if fn, ok := x.ExpList[i].(*ast.FuncDefExp); ok {
+					symbols = append(symbols, doc.funcSymbol(name, SymbolFunction, x.Span, span, fn))
+					continue
+				}
+			}
+			symbols = append(symbols, DocumentSymbol{
+				Name:           name,
+				Detail:         "local",
+				Kind:           SymbolVariable,
+				Range:          doc.rangeOf(x.Span),
+				SelectionRange: doc.rangeOf(span),
+			})
+		}
+	case *ast.AssignStat:
+		for i, v := range x.VarList {
+			if i >= len(x.ExpList) {
+				break
+			}
+			fn, ok := x.ExpList[i].(*ast.FuncDefExp)
+			name := funcName(v)
+			if !ok || name == "" {
+				continue
+			}
+			kind := SymbolFunction
+			if isMethod(v, fn) {
+				kind = SymbolMethod
+				name = name[:strings.LastIndex(name, ".")] + ":" + name[strings.LastIndex(name, ".")+1:]
+			}
+			symbols = append(symbols, doc.funcSymbol(name, kind, x.Span, ast.SpanOf(v), fn))
+		}
+	case *ast.DoStat:
+		symbols = doc.documentSymbols(x.Block)
+	case *ast.WhileStat:
+		symbols = doc.documentSymbols(x.Block)
+	case *ast.RepeatStat:
+		symbols = doc.documentSymbols(x.Block)
+	case *ast.IfStat:
+		for _, block := range x.Blocks {
+			symbols = append(symbols, doc.documentSymbols(block)...)
+		}
+	case *ast.ForNumStat:
+		symbols = doc.documentSymbols(x.Block)
+	case *ast.ForInStat:
+		symbols = doc.documentSymbols(x.Block)
+	}
+	return symbols
+}
+
+func (doc *document) funcSymbol(name string, kind SymbolKind, span, nameSpan ast.Span, fn *ast.FuncDefExp) DocumentSymbol {
+	return DocumentSymbol{
+		Name:           name,
+		Detail:         "function" + parList(fn),
+		Kind:           kind,
+		Range:          doc.rangeOf(span),
+		SelectionRange: doc.rangeOf(nameSpan),
+		Children:       doc.documentSymbols(fn.Block),
+	}
+}
+
+//funcName 把a.b.c这样的赋值目标写成名字，不是这种形式时返回空串
+func funcName(exp ast.Exp) string {
+	switch x := exp.(type) {
+	case *ast.NameExp:
+		return x.Name
+	case *ast.TableAccessExp:
+		key, ok := x.KeyExp.(*ast.StringExp)
+		if prefix := funcName(x.PrefixExp); ok && prefix != "" {
+			return prefix + "." + key.Val
+		}
+	}
+	return ""
+}
+
+//isMethod function a:b()的语法糖：隐含的self用的是方法名的区间
+func isMethod(v ast.Exp, fn *ast.FuncDefExp) bool {
+	access, ok := v.(*ast.TableAccessExp)
+	return ok && len(fn.ParList) > 0 && fn.ParList[0] == "self" &&
+		len(fn.ParSpans) > 0 && fn.ParSpans[0] == ast.SpanOf(access.KeyExp)
+}
+
+//parList 函数的参数表，比如(a, b, ...)
+func parList(fn *ast.FuncDefExp) string {
+	pars := append([]string(nil), fn.ParList...)
+	if fn.IsVararg {
+		pars = append(pars, "...")
+	}
+	return "(" + strings.Join(pars, ", ") + ")"
+}
+
+//definition 局部变量的声明处
+func (doc *document) definition(offset int) *Location {
+	occ := doc.names.at(offset)
+	if occ == nil || occ.v == nil || occ.v.Span.Pos.Line == 0 {
+		return nil
+	}
+	return &Location{URI: doc.uri, Range: doc.rangeOf(occ.v.Span)}
+}
+
+func (doc *document) hover(offset int) *Hover {
+	occ := doc.names.at(offset)
+	if occ == nil || occ.role != roleName {
+		return nil
+	}
+	var code, note string
+	if v := occ.v; v != nil && v.Kind == scope.Env {
+		code = "_ENV"
+		note = "environment of the chunk"
+	} else if v != nil {
+		switch fn := funcOf(v); {
+		case fn != nil:
+			code = "local function " + v.Name + parList(fn)
+		case v.Kind == scope.Param:
+			code = "(parameter) " + v.Name
+		case v.Kind == scope.ForVar:
+			code = "(for variable) " + v.Name
+		default:
+			code = "local " + v.Name
+		}
+		if !occ.decl {
+			note = fmt.Sprintf("declared on line %d", v.Span.Pos.Line)
+			if occ.upvalue {
+				note = "upvalue, " + note
+			}
+		}
+	} else if fn := doc.names.globalFuncs[occ.name]; fn != nil {
+		code = "function " + occ.name + parList(fn)
+		note = fmt.Sprintf("global, defined on line %d", fn.Line)
+	} else {
+		code = "global " + occ.name
+	}
+
+	value := "```lua\n" + code + "\n```"
+	if note != "" {
+		value += "\n\n" + note
+	}
+	r := doc.rangeOf(occ.span)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+//语义高亮的token类型和修饰符，下标就是SemanticTokens.Data里的编号
+var (
+	tokenTypes     = []string{"keyword", "variable", "parameter", "function", "method", "property", "string", "number", "comment", "operator"}
+	tokenModifiers = []string{"declaration"}
+)
+
+const (
+	tokKeyword = iota
+	tokVariable
+	tokParameter
+	tokFunction
+	tokMethod
+	tokProperty
+	tokString
+	tokNumber
+	tokComment
+	tokOperator
+)
+
+const modDeclaration = 1 << 0
+
+type semanticToken struct {
+	start, end int //字节偏移
+	typ, mods  int
+}
+
+//semanticTokens 按位置把token和注释编码成LSP要求的相对格式，跨行的token按行拆开
+func (doc *document) semanticTokens() *SemanticTokens {
+	var toks []semanticToken
+	for _, token := range doc.tokens {
+		for _, comment := range token.Leading {
+			toks = append(toks, semanticToken{start: comment.Pos.Offset, end: comment.End.Offset, typ: tokComment})
+		}
+		if typ, mods, ok := doc.classify(token); ok {
+			toks = append(toks, semanticToken{start: token.Pos.Offset, end: token.End.Offset, typ: typ, mods: mods})
+		}
+		for _, comment := range token.Trailing {
+			toks = append(toks, semanticToken{start: comment.Pos.Offset, end: comment.End.Offset, typ: tokComment})
+		}
+	}
+
+	data := []int{}
+	prev := Position{}
+	for _, tok := range toks {
+		for _, part := range doc.splitLines(tok.start, tok.end) {
+			start := doc.position(part[0])
+			length := utf16Len(doc.text[part[0]:part[1]])
+			if length == 0 {
+				continue
+			}
+			deltaChar := start.Character
+			if start.Line == prev.Line {
+				deltaChar -= prev.Character
+			}
+			data = append(data, start.Line-prev.Line, deltaChar, length, tok.typ, tok.mods)
+			prev = start
+		}
+	}
+	return &SemanticTokens{Data: data}
+}
+
+func (doc *document) classify(token *lexer.Token) (typ, mods int, ok bool) {
+	switch {
+	case token.Kind == lexer.TOKEN_EOF:
+		return 0, 0, false
+	case token.Kind == lexer.TOKEN_STRING:
+		return tokString, 0, true
+	case token.Kind == lexer.TOKEN_NUMBER:
+		return tokNumber, 0, true
+	case lexer.IsKeyword(token.Text):
+		return tokKeyword, 0, true
+	case token.Kind == lexer.TOKEN_IDENTIFIER:
+		typ = tokVariable
+		occ := doc.names.at(token.Pos.Offset)
+		if occ == nil || occ.span.Pos.Offset != token.Pos.Offset {
+			return typ, 0, true
+		}
+		switch occ.role {
+		case roleField:
+			typ = tokProperty
+		case roleMethod:
+			typ = tokMethod
+		}
+		if v := occ.v; v != nil {
+			switch {
+			case v.Kind == scope.Param:
+				typ = tokParameter
+			case funcOf(v) != nil:
+				typ = tokFunction
+			}
+		}
+		if occ.decl {
+			mods = modDeclaration
+		}
+		return typ, mods, true
+	case token.Kind >= lexer.TOKEN_OP_ASSIGN && token.Kind <= lexer.TOKEN_OP_NOT:
+		return tokOperator, 0, true
+	}
+	return 0, 0, false
+}
+
+//splitLines 把[start, end)按行切开，去掉换行符
+func (doc *document) splitLines(start, end int) [][2]int {
+	var parts [][2]int
+	for start < end {
+		line := doc.position(start).Line
+		lineEnd := doc.lineEnd(line)
+		if lineEnd > end {
+			lineEnd = end
+		}
+		if lineEnd > start {
+			parts = append(parts, [2]int{start, lineEnd})
+		}
+		if line+1 >= len(doc.lines) {
+			break
+		}
+		start = doc.lines[line+1]
+	}
+	return parts
+}
@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"go/compiler/ast"
+	"go/compiler/scope"
+	"sort"
+)
+
+type role int
+
+const (
+	roleName   role = iota //变量名
+	roleField              //a.b和{b = 1}里的b
+	roleMethod             //a:b()里的b
+)
+
+//occurrence 源码中出现的一个名字
+type occurrence struct {
+	span    ast.Span
+	name    string
+	role    role
+	v       *scope.Variable //roleName时为nil表示全局变量
+	decl    bool            //是否是局部变量的声明处
+	upvalue bool            //是否是在内层函数里引用外层函数的局部变量
+}
+
+//resolution 名字解析的结果，变量的部分来自scope
+type resolution struct {
+	occurrences []*occurrence              //按位置排列
+	globalFuncs map[string]*ast.FuncDefExp //function foo() end这样定义的全局函数
+}
+
+//at 返回offset处(包括名字的末尾)的名字
+func (res *resolution) at(offset int) *occurrence {
+	i := sort.Search(len(res.occurrences), func(i int) bool {
+		return res.occurrences[i].span.End.Offset >= offset
+	})
+	if i < len(res.occurrences) && res.occurrences[i].span.Pos.Offset <= offset {
+		return res.occurrences[i]
+	}
+	return nil
+}
+
+func resolve(src string, block *ast.Block) *resolution {
+	info := scope.Resolve(block)
+	res := &resolution{globalFuncs: map[string]*ast.FuncDefExp{}}
+	for _, v := range info.Vars {
+		//隐含的self在源码里没有自己的名字
+		if !v.Implicit && v.Span.Pos.Line > 0 {
+			res.add(&occurrence{span: v.Span, name: v.Name, v: v, decl: true})
+		}
+	}
+
+	field := func(exp ast.Exp, role role) {
+		//a.b、a:b和{b = 1}里的b在语法树里是StringExp，用源码区分a.b和a["b"]
+		if str, ok := exp.(*ast.StringExp); ok && str.Pos.Offset < len(src) && isNameStart(src[str.Pos.Offset]) {
+			res.add(&occurrence{span: str.Span, name: str.Val, role: role})
+		}
+	}
+	ast.Inspect(block, func(node ast.Node) bool {
+		switch x := node.(type) {
+		case *ast.NameExp:
+			if ref := info.Refs[x]; ref != nil {
+				res.add(&occurrence{span: x.Span, name: x.Name, v: ref.Var, upvalue: ref.Kind == scope.Upvalue})
+			}
+		case *ast.TableAccessExp:
+			field(x.KeyExp, roleField)
+		case *ast.FuncCallExp:
+			if x.NameExp != nil {
+				field(x.NameExp, roleMethod)
+			}
+		case *ast.TableConstructorExp:
+			for _, key := range x.KeyExps {
+				field(key, roleField)
+			}
+		case *ast.AssignStat:
+			for i, v := range x.VarList {
+				name, ok := v.(*ast.NameExp)
+				if !ok || i >= len(x.ExpList) || info.Refs[name] == nil || info.Refs[name].Kind != scope.Global {
+					continue
+				}
+				if fn, ok := x.ExpList[i].(*ast.FuncDefExp); ok && res.globalFuncs[name.Name] == nil {
+					res.globalFuncs[name.Name] = fn
+				}
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(res.occurrences, func(i, j int) bool {
+		return res.occurrences[i].span.Pos.Offset < res.occurrences[j].span.Pos.Offset
+	})
+	return res
+}
+
+func (res *resolution) add(occ *occurrence) {
+	res.occurrences = append(res.occurrences, occ)
+}
+
+//funcOf 局部函数，或者初始值是函数的局部变量，对应的函数
+func funcOf(v *scope.Variable) *ast.FuncDefExp {
+	switch decl := v.Decl.(type) {
+	case *ast.LocalFuncDefStat:
+		return decl.Exp
+	case *ast.LocalVarDeclStat:
+		if v.Index < len(decl.ExpList) {
+			fn, _ := decl.ExpList[v.Index].(*ast.FuncDefExp)
+			return fn
+		}
+	}
+	return nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+//spanAt 容错解析出来的语法树里名字和区间的个数可能对不上
+func spanAt(spans []ast.Span, i int) ast.Span {
+	if i < len(spans) {
+		return spans[i]
+	}
+	return ast.Span{}
+}
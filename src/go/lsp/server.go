@@ -0,0 +1,304 @@
+/*
+Package lsp 基于本项目的词法分析器和语法分析器实现Language Server Protocol，通过stdio之类的流收发JSON-RPC消息。
+
+支持的功能：语法错误诊断(容错解析，一次报告多个错误)、文档符号(函数和局部变量)、
+局部变量和upvalue的跳转到定义、悬停提示、语义高亮。文档只支持整体同步。
+*/
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//ErrNoShutdown 没有先收到shutdown就收到了exit，按协议进程应该以1退出
+var ErrNoShutdown = errors.New("lsp: exit without shutdown")
+
+//Server 一个语言服务器，按顺序处理收到的消息
+type Server struct {
+	conn        *conn
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+	closers     []io.Closer //Serve返回时关闭，Pipe用它让客户端收到EOF而不是一直等待
+}
+
+//NewServer 创建从r读消息、往w写消息的服务器
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{conn: newConn(r, w), docs: map[string]*document{}}
+}
+
+//handler 处理一个请求或通知，params是原始的JSON参数；通知的返回值会被丢掉
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":                       (*Server).initialize,
+	"initialized":                      ignore,
+	"shutdown":                         (*Server).shutdownRequest,
+	"$/cancelRequest":                  ignore,
+	"$/setTrace":                       ignore,
+	"textDocument/didOpen":             (*Server).didOpen,
+	"textDocument/didChange":           (*Server).didChange,
+	"textDocument/didClose":            (*Server).didClose,
+	"textDocument/didSave":             ignore,
+	"textDocument/documentSymbol":      (*Server).documentSymbol,
+	"textDocument/definition":          (*Server).definition,
+	"textDocument/hover":               (*Server).hover,
+	"textDocument/semanticTokens/full": (*Server).semanticTokensFull,
+}
+
+func ignore(s *Server, params json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+//Serve 处理消息直到收到exit；之前收到过shutdown时返回nil，否则返回ErrNoShutdown；读写出错时返回那个错误
+func (s *Server) Serve() error {
+	defer func() {
+		for _, c := range s.closers {
+			c.Close()
+		}
+	}()
+	for {
+		msg, err := s.conn.read()
+		if rpcErr, ok := err.(*ResponseError); ok {
+			if err := s.reply(nil, nil, rpcErr); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return nil
+			}
+			return ErrNoShutdown
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+//handle 处理一条消息，只有写响应失败时才返回错误
+func (s *Server) handle(msg *Message) error {
+	isRequest := msg.ID != nil
+	if msg.Method == "" {
+		if isRequest {
+			return nil //服务器不发请求，不会收到响应
+		}
+		return s.reply(nil, nil, &ResponseError{Code: CodeInvalidRequest, Message: "missing method"})
+	}
+
+	h, found := handlers[msg.Method]
+	switch {
+	case !found:
+		if !isRequest {
+			return nil //不认识的通知直接忽略
+		}
+		return s.reply(msg.ID, nil, &ResponseError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method})
+	case !s.initialized && msg.Method != "initialize":
+		if !isRequest {
+			return nil
+		}
+		return s.reply(msg.ID, nil, &ResponseError{Code: CodeServerNotInitialized, Message: "server not initialized"})
+	case s.shutdown && isRequest:
+		return s.reply(msg.ID, nil, &ResponseError{Code: CodeInvalidRequest, Message: "server is shutting down"})
+	}
+
+	result, err := s.call(h, msg.Params)
+	if !isRequest {
+		return nil
+	}
+	if err != nil {
+		rpcErr, ok := err.(*ResponseError)
+		if !ok {
+			rpcErr = &ResponseError{Code: CodeInternalError, Message: err.Error()}
+		}
+		return s.reply(msg.ID, nil, rpcErr)
+	}
+	return s.reply(msg.ID, result, nil)
+}
+
+//call 调用h，把h里的panic变成错误，一个文档分析出错不影响整个服务器
+func (s *Server) call(h handler, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("internal error: %v", r)
+		}
+	}()
+	return h(s, params)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rpcErr *ResponseError) error {
+	msg := &Message{ID: id, Error: rpcErr}
+	if id == nil {
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+	if rpcErr == nil {
+		raw, err := rawJSON(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = raw
+	}
+	return s.conn.write(msg)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.conn.write(&Message{Method: method, Params: data})
+}
+
+//unmarshal 解析参数，失败时返回InvalidParams
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p InitializeParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	s.initialized = true
+	return &InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       SyncFull,
+			HoverProvider:          true,
+			DefinitionProvider:     true,
+			DocumentSymbolProvider: true,
+			SemanticTokensProvider: &SemanticTokensOptions{
+				Legend: SemanticTokensLegend{TokenTypes: tokenTypes, TokenModifiers: tokenModifiers},
+				Full:   true,
+			},
+		},
+		ServerInfo: &ServerInfo{Name: "golua"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc := newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+	s.docs[doc.uri] = doc
+	return nil, s.publishDiagnostics(doc)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range p.ContentChanges {
+		doc.applyChange(change)
+	}
+	doc.version = p.TextDocument.Version
+	doc.analyze()
+	return nil, s.publishDiagnostics(doc)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	//关掉的文档不再显示诊断
+	return nil, s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+func (s *Server) publishDiagnostics(doc *document) error {
+	return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: doc.diagnostics(),
+	})
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	doc, found := s.docs[uri]
+	if !found {
+		return nil, &ResponseError{Code: CodeInvalidParams, Message: "document not open: " + uri}
+	}
+	return doc, nil
+}
+
+//positionParams 解析TextDocumentPositionParams，返回文档和位置对应的字节偏移
+func (s *Server) positionParams(params json.RawMessage) (*document, int, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, 0, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, 0, err
+	}
+	return doc, doc.offset(p.Position), nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.documentSymbols(doc.block), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	doc, offset, err := s.positionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if loc := doc.definition(offset); loc != nil {
+		return loc, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	doc, offset, err := s.positionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if h := doc.hover(offset); h != nil {
+		return h, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) semanticTokensFull(params json.RawMessage) (interface{}, error) {
+	var p SemanticTokensParams
+	if err := unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.semanticTokens(), nil
+}
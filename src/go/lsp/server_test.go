@@ -0,0 +1,235 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testURI = "file:///tmp/test.lua"
+
+//startServer 通过Pipe连接客户端和服务器并完成初始化，返回的channel收到Serve的返回值
+func startServer(t *testing.T) (*Client, chan error) {
+	t.Helper()
+	c, s := Pipe()
+	done := make(chan error, 1)
+	go func() { done <- s.Serve() }()
+	var init InitializeResult
+	if err := c.Call("initialize", &InitializeParams{}, &init); err != nil {
+		t.Fatal(err)
+	}
+	if !init.Capabilities.HoverProvider || !init.Capabilities.DefinitionProvider {
+		t.Errorf("capabilities = %+v", init.Capabilities)
+	}
+	if err := c.Notify("initialized", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	return c, done
+}
+
+//open 打开文档，返回服务器发布的诊断
+func open(t *testing.T, c *Client, text string) *PublishDiagnosticsParams {
+	t.Helper()
+	err := c.Notify("textDocument/didOpen", &DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "lua", Version: 1, Text: text},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readDiagnostics(t, c)
+}
+
+func readDiagnostics(t *testing.T, c *Client) *PublishDiagnosticsParams {
+	t.Helper()
+	msg, err := c.ReadNotification()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("got notification %s", msg.Method)
+	}
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		t.Fatal(err)
+	}
+	return &p
+}
+
+func at(line, character int) *TextDocumentPositionParams {
+	return &TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c, _ := startServer(t)
+	if p := open(t, c, "local x = 1\nprint(x)\n"); len(p.Diagnostics) != 0 || p.Version != 1 {
+		t.Errorf("diagnostics = %+v", p)
+	}
+
+	err := c.Notify("textDocument/didChange", &DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: testURI, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "local x = \nif x == then\n  print('ok'\nend\n"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := readDiagnostics(t, c)
+	if p.Version != 2 || len(p.Diagnostics) < 2 {
+		t.Fatalf("diagnostics = %+v", p)
+	}
+	d := p.Diagnostics[0]
+	if d.Severity != SeverityError || d.Message != "unexpected symbol near 'if'" || d.Range.Start != (Position{Line: 1, Character: 0}) {
+		t.Errorf("first diagnostic = %+v", d)
+	}
+
+	if err := c.Notify("textDocument/didClose", &DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: testURI}}); err != nil {
+		t.Fatal(err)
+	}
+	if p := readDiagnostics(t, c); len(p.Diagnostics) != 0 {
+		t.Errorf("diagnostics after close = %+v", p)
+	}
+}
+
+//TestShebang 第一行是#!时不报错，位置也不变
+func TestShebang(t *testing.T) {
+	c, _ := startServer(t)
+	if p := open(t, c, "\xEF\xBB\xBF#!/usr/bin/env lua\nlocal x = 1\nprint(x)\n"); len(p.Diagnostics) != 0 {
+		t.Errorf("diagnostics = %+v", p)
+	}
+	var loc Location
+	if err := c.Call("textDocument/definition", at(2, 6), &loc); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Range{Start: Position{Line: 1, Character: 6}, End: Position{Line: 1, Character: 7}}); loc.Range != want {
+		t.Errorf("definition = %+v, want %+v", loc.Range, want)
+	}
+}
+
+const testSource = `local function helper(a, b)
+  local sum = a + b
+  return function() return sum + a end
+end
+print(helper(1, 2), undefinedThing)
+`
+
+func TestDefinition(t *testing.T) {
+	c, _ := startServer(t)
+	open(t, c, testSource)
+	tests := []struct {
+		pos  *TextDocumentPositionParams
+		want *Range //nil表示没有定义
+	}{
+		{at(2, 33), &Range{Start: Position{Line: 0, Character: 22}, End: Position{Line: 0, Character: 23}}}, //upvalue a
+		{at(2, 27), &Range{Start: Position{Line: 1, Character: 8}, End: Position{Line: 1, Character: 11}}},  //upvalue sum
+		{at(4, 8), &Range{Start: Position{Line: 0, Character: 15}, End: Position{Line: 0, Character: 21}}},  //helper
+		{at(4, 24), nil}, //全局变量
+	}
+	for _, tt := range tests {
+		var loc *Location
+		if err := c.Call("textDocument/definition", tt.pos, &loc); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case tt.want == nil && loc != nil:
+			t.Errorf("%+v: definition = %+v, want none", tt.pos.Position, loc)
+		case tt.want != nil && (loc == nil || loc.URI != testURI || loc.Range != *tt.want):
+			t.Errorf("%+v: definition = %+v, want %+v", tt.pos.Position, loc, *tt.want)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	c, _ := startServer(t)
+	open(t, c, testSource)
+	tests := []struct {
+		pos  *TextDocumentPositionParams
+		want string //""表示没有提示
+	}{
+		{at(2, 33), "```lua\n(parameter) a\n```\n\nupvalue, declared on line 1"},
+		{at(4, 8), "```lua\nlocal function helper(a, b)\n```\n\ndeclared on line 1"},
+		{at(4, 24), "```lua\nglobal undefinedThing\n```"},
+		{at(3, 1), ""},
+	}
+	for _, tt := range tests {
+		var h *Hover
+		if err := c.Call("textDocument/hover", tt.pos, &h); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if h != nil {
+			got = h.Contents.Value
+		}
+		if got != tt.want {
+			t.Errorf("%+v: hover = %q, want %q", tt.pos.Position, got, tt.want)
+		}
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	c, s := Pipe()
+	go s.Serve()
+	err := c.Call("textDocument/hover", at(0, 0), nil)
+	if rpcErr, ok := err.(*ResponseError); !ok || rpcErr.Code != CodeServerNotInitialized {
+		t.Errorf("before initialize: %v", err)
+	}
+	if err := c.Call("initialize", &InitializeParams{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Call("foo/bar", nil, nil)
+	if rpcErr, ok := err.(*ResponseError); !ok || rpcErr.Code != CodeMethodNotFound {
+		t.Errorf("unknown method: %v", err)
+	}
+	err = c.Call("textDocument/hover", at(0, 0), nil)
+	if rpcErr, ok := err.(*ResponseError); !ok || rpcErr.Code != CodeInvalidParams || !strings.Contains(rpcErr.Message, "not open") {
+		t.Errorf("closed document: %v", err)
+	}
+}
+
+//wait 等待Serve返回，避免测试在服务器出问题时一直挂着
+func wait(t *testing.T, done chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+		return nil
+	}
+}
+
+func TestShutdownExit(t *testing.T) {
+	c, done := startServer(t)
+	if err := c.Call("shutdown", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Call("textDocument/hover", at(0, 0), nil)
+	if rpcErr, ok := err.(*ResponseError); !ok || rpcErr.Code != CodeInvalidRequest {
+		t.Errorf("request after shutdown: %v", err)
+	}
+	if err := c.Notify("exit", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(t, done); err != nil {
+		t.Errorf("Serve() = %v, want nil", err)
+	}
+	//Serve返回后管道已经关闭，Call不能一直等下去
+	if err := c.Call("shutdown", nil, nil); err == nil {
+		t.Error("Call after exit succeeded")
+	}
+	if _, err := c.ReadNotification(); err == nil {
+		t.Error("ReadNotification after exit succeeded")
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c, done := startServer(t)
+	if err := c.Notify("exit", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(t, done); err != ErrNoShutdown {
+		t.Errorf("Serve() = %v, want ErrNoShutdown", err)
+	}
+}
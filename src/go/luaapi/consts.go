@@ -40,6 +40,7 @@ const (
 const LUA_MINSTACK = 20
 const LUA_MAXSTACK = 1000000
 const LUA_REGISTRYINDEX = -LUA_MAXSTACK - 1000
+const LUA_RIDX_MAINTHREAD int64 = 1
 const LUA_RIDX_GLOBALS int64 = 2
 
 const (
@@ -89,6 +89,27 @@ type LuaState interface {
 
 	Error() int
 	PCall(nArgs, nResults, msgh int) int
+	Traceback(L LuaState, msg string, level int)
+	Where(level int)
+
+	/* userdata */
+	NewUserdata(v interface{})
+	ToUserdata(idx int) interface{}
+	IsUserdata(idx int) bool
+	GetUserValue(idx int) LuaType
+	SetUserValue(idx int)
+
+	/* coroutine functions */
+	NewThread() LuaState
+	Resume(from LuaState, nArgs int) int
+	CloseThread() int
+	Yield(nResults int) int
+	Status() int
+	IsYieldable() bool
+	ToThread(idx int) LuaState
+	PushThread() bool
+	XMove(to LuaState, n int)
+	GetStack() bool
 }
 
 type GoFunction func(LuaState) int
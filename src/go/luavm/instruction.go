@@ -52,6 +52,11 @@ func (ins Instruction) CMode() byte {
 	return opcodes[ins.OpCode()].argCMode
 }
 
+//SetsA 指令是否会写寄存器A
+func (ins Instruction) SetsA() bool {
+	return opcodes[ins.OpCode()].setAFlag == 1
+}
+
 func (ins Instruction) Execute(vm luaapi.LuaVM) {
 	action := opcodes[ins.OpCode()].action
 	if action != nil {
@@ -84,8 +84,8 @@ func bor(i Instruction, vm luaapi.LuaVM)  { _binaryArith(i, vm, luaapi.LUA_OPBOR
 func bxor(i Instruction, vm luaapi.LuaVM) { _binaryArith(i, vm, luaapi.LUA_OPBXOR) }
 func shl(i Instruction, vm luaapi.LuaVM)  { _binaryArith(i, vm, luaapi.LUA_OPSHL) }
 func shr(i Instruction, vm luaapi.LuaVM)  { _binaryArith(i, vm, luaapi.LUA_OPSHR) }
-func unm(i Instruction, vm luaapi.LuaVM)  { _binaryArith(i, vm, luaapi.LUA_OPUNM) }
-func bnot(i Instruction, vm luaapi.LuaVM) { _binaryArith(i, vm, luaapi.LUA_OPBNOT) }
+func unm(i Instruction, vm luaapi.LuaVM)  { _unaryArith(i, vm, luaapi.LUA_OPUNM) }
+func bnot(i Instruction, vm luaapi.LuaVM) { _unaryArith(i, vm, luaapi.LUA_OPBNOT) }
 
 func _len(i Instruction, vm luaapi.LuaVM) {
 	a, b, _ := i.ABC()
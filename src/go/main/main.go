@@ -142,9 +142,9 @@ func print(ls luaapi.LuaState) int {
 		if ls.IsBoolean(i) {
 			fmt.Printf("%t", ls.ToBoolean(i))
 		} else if ls.IsString(i) {
-			fmt.Printf(ls.ToString(i))
+			fmt.Print(ls.ToString(i))
 		} else {
-			fmt.Printf(ls.TypeName(ls.Type(i)))
+			fmt.Print(ls.TypeName(ls.Type(i)))
 		}
 		if i < nArgs {
 			fmt.Print("\t")
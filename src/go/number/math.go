@@ -3,6 +3,7 @@ package number
 import (
 	"math"
 	"strconv"
+	"strings"
 )
 
 func IFloorDiv(a, b int64) int64 {
@@ -47,11 +48,61 @@ func FloatToInteger(f float64) (int64, bool) {
 }
 
 func ParseInteger(str string) (int64, bool) {
+	str = strings.TrimSpace(str)
+	if isHex(str) {
+		return parseHexInteger(str)
+	}
 	i, err := strconv.ParseInt(str, 10, 64)
 	return i, err == nil
 }
 
+//parseHexInteger 十六进制整数溢出时回绕，与lua一致
+func parseHexInteger(str string) (int64, bool) {
+	neg := false
+	if str[0] == '-' || str[0] == '+' {
+		neg = str[0] == '-'
+		str = str[1:]
+	}
+	str = str[2:]
+	if str == "" {
+		return 0, false
+	}
+	var i int64
+	for _, c := range []byte(str) {
+		var d int64
+		switch {
+		case c >= '0' && c <= '9':
+			d = int64(c - '0')
+		case c >= 'a' && c <= 'f':
+			d = int64(c - 'a' + 10)
+		case c >= 'A' && c <= 'F':
+			d = int64(c - 'A' + 10)
+		default:
+			return 0, false
+		}
+		i = i*16 + d
+	}
+	if neg {
+		i = -i
+	}
+	return i, true
+}
+
 func ParseFloat(str string) (float64, bool) {
+	str = strings.TrimSpace(str)
+	if strings.ContainsAny(str, "nN") { // reject inf and nan
+		return 0, false
+	}
+	if isHex(str) && !strings.ContainsAny(str, "pP") {
+		str += "p0"
+	}
 	f, err := strconv.ParseFloat(str, 64)
 	return f, err == nil
 }
+
+func isHex(str string) bool {
+	if len(str) > 0 && (str[0] == '-' || str[0] == '+') {
+		str = str[1:]
+	}
+	return strings.HasPrefix(str, "0x") || strings.HasPrefix(str, "0X")
+}
@@ -1,13 +1,44 @@
 package state
 
 import (
+	"fmt"
 	"go/binchunk"
+	"go/compiler"
 	"go/luaapi"
 	"go/luavm"
+	"strings"
 )
 
+//Load 加载二进制chunk或者lua源码，mode可以是"b"、"t"或"bt"，空串等价于"bt"；
+//mode里还有"v"时先用binchunk.Verify检查二进制chunk，比如"bv"，用来加载不可信的chunk
 func (state *luaState) Load(chunk []byte, chunkName, mode string) int {
-	proto := binchunk.Undump(chunk)
+	if mode == "" || mode == "v" {
+		mode += "bt"
+	}
+	var proto *binchunk.Prototype
+	if isBinaryChunk(chunk) {
+		if !strings.Contains(mode, "b") {
+			return state.loadError("binary", mode)
+		}
+		var err error
+		if proto, err = binchunk.UndumpErr(chunk); err == nil && strings.Contains(mode, "v") {
+			err = binchunk.Verify(proto)
+		}
+		if err != nil {
+			state.stack.push(err.Error())
+			return luaapi.LUA_ERRSYNTAX
+		}
+	} else {
+		if !strings.Contains(mode, "t") {
+			return state.loadError("text", mode)
+		}
+		var err error
+		if proto, err = compiler.Compile(string(chunk), chunkName); err != nil {
+			state.stack.push(err.Error())
+			return luaapi.LUA_ERRSYNTAX
+		}
+	}
+
 	c := newLuaClosure(proto)
 	state.stack.push(c)
 
@@ -15,7 +46,18 @@ func (state *luaState) Load(chunk []byte, chunkName, mode string) int {
 		env := state.registry.get(luaapi.LUA_RIDX_GLOBALS)
 		c.upvals[0] = &upvalue{val: &env}
 	}
-	return 0
+	return luaapi.LUA_OK
+}
+
+func isBinaryChunk(chunk []byte) bool {
+	return len(chunk) >= len(binchunk.LUA_SIGNATURE) &&
+		string(chunk[:len(binchunk.LUA_SIGNATURE)]) == binchunk.LUA_SIGNATURE
+}
+
+func (state *luaState) loadError(kind, mode string) int {
+	msg := fmt.Sprintf("attempt to load a %s chunk (mode is '%s')", kind, mode)
+	state.stack.push(msg)
+	return luaapi.LUA_ERRSYNTAX
 }
 
 func (state *luaState) Call(nArgs, nResults int) {
@@ -30,6 +72,9 @@ func (state *luaState) Call(nArgs, nResults int) {
 			}
 		}
 	}
+	if ok && state.nCalls >= maxCalls {
+		state.runtimeError("stack overflow")
+	}
 	if ok {
 		//	fmt.Printf("Call %s<%d, %d>\n", c.proto.Source, c.proto.LineDefine, c.proto.LastLineDefined)
 		if c.proto != nil {
@@ -38,7 +83,7 @@ func (state *luaState) Call(nArgs, nResults int) {
 			state.callGoClosure(nArgs, nResults, c)
 		}
 	} else {
-		panic("not function!")
+		state.typeError(val, "call", state.varInfo(val))
 	}
 }
 
@@ -69,6 +114,7 @@ func (state *luaState) callLuaClosure(nArgs, nResults int, c *luaClosure) {
 }
 
 func (state *luaState) runLuaClosure() {
+	defer state.catchVMPanic()
 	for {
 		inst := luavm.Instruction(state.Fetch())
 		inst.Execute(state)
@@ -88,7 +134,7 @@ func (state *luaState) callGoClosure(nArgs, nResults int, c *luaClosure) {
 	state.stack.pop()
 
 	state.pushLuaStack(newStatck)
-	r := c.goFunc(state)
+	r := state.callGoFunction(c)
 	state.popLuaStatck()
 
 	if nResults != 0 {
@@ -98,18 +144,35 @@ func (state *luaState) callGoClosure(nArgs, nResults int, c *luaClosure) {
 	}
 }
 
+//PCall 以保护模式调用函数，捕获*LuaError，把函数和参数换成错误对象；*GoPanic不捕获。
+//msgh不为0时是消息处理函数的索引，出错时在出错的地方(调用栈还没有弹出)用错误对象调用它，
+//PCall把它的返回值作为错误对象
 func (state *luaState) PCall(nArgs, nResults, msgh int) (status int) {
 	caller := state.stack
+	base := caller.top - (nArgs + 1)
+	var handler luaValue
+	if msgh != 0 {
+		handler = state.stack.get(msgh)
+	}
 	status = luaapi.LUA_ERRRUN
 
 	defer func() {
-		if err := recover(); err != nil {
-			if msgh != 0 {
-				panic(err)
+		if r := recover(); r != nil {
+			luaErr, ok := r.(*LuaError)
+			if !ok {
+				panic(r)
+			}
+			err := luaErr.Value
+			if handler != nil {
+				err, status = state.callMsgh(handler, err)
 			}
 			for state.stack != caller {
 				state.popLuaStatck()
 			}
+			//Call在进入函数之前出错时函数和参数还在栈上
+			for state.stack.top > base {
+				state.stack.pop()
+			}
 			state.stack.push(err)
 		}
 	}()
@@ -118,3 +181,21 @@ func (state *luaState) PCall(nArgs, nResults, msgh int) (status int) {
 	status = luaapi.LUA_OK
 	return
 }
+
+//callMsgh 用err调用消息处理函数，返回它的结果；处理函数本身出错时返回它的错误和LUA_ERRERR
+func (state *luaState) callMsgh(handler, err luaValue) (result luaValue, status int) {
+	defer func() {
+		if r := recover(); r != nil {
+			luaErr, ok := r.(*LuaError)
+			if !ok {
+				panic(r)
+			}
+			result, status = luaErr.Value, luaapi.LUA_ERRERR
+		}
+	}()
+	state.stack.check(2)
+	state.stack.push(handler)
+	state.stack.push(err)
+	state.Call(1, 1)
+	return state.stack.pop(), luaapi.LUA_ERRRUN
+}
@@ -0,0 +1,16 @@
+package state
+
+import "testing"
+
+//TestPCallBeforeCall Call在进入函数之前出错时，pcall只返回false和错误对象
+func TestPCallBeforeCall(t *testing.T) {
+	run(t, newTestState(t), `
+		check(select("#", pcall(nil)) == 2, "pcall(nil)")
+		check(select("#", pcall(nil, 1, 2, 3)) == 2, "pcall(nil, 1, 2, 3)")
+		local ok, err = pcall(nil, 1)
+		check(not ok and err == "attempt to call a nil value", tostring(err))
+		check(select("#", pcall(error, "x")) == 2, "pcall(error, 'x')")
+		local ok, a, b = pcall(function(x) return x, 2 end, 1)
+		check(ok and a == 1 and b == 2, "pcall results")
+	`)
+}
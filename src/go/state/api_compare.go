@@ -41,6 +41,15 @@ func _eq(a, b luaValue, ls *luaState, bRaw bool) bool {
 			}
 		}
 		return a == b
+	case *userdata:
+		if !bRaw {
+			if y, ok := b.(*userdata); ok && x != y {
+				if result, ok := callMetamethod(x, y, "__eq", ls); ok {
+					return convertToBoolean(result)
+				}
+			}
+		}
+		return a == b
 	default:
 		return a == b
 	}
@@ -72,7 +81,8 @@ func _lt(a, b luaValue, ls *luaState, bRaw bool) bool {
 			return convertToBoolean(result)
 		}
 	}
-	panic("comparsion error")
+	ls.compareError(a, b)
+	return false
 }
 
 func _le(a, b luaValue, ls *luaState, bRaw bool) bool {
@@ -101,7 +111,8 @@ func _le(a, b luaValue, ls *luaState, bRaw bool) bool {
 			return convertToBoolean(result)
 		}
 	}
-	panic("comparsion error")
+	ls.compareError(a, b)
+	return false
 }
 
 func (state *luaState) Compare(idx1, idx2 int, op luaapi.CompareOp) bool {
@@ -0,0 +1,168 @@
+package state
+
+import (
+	"go/luaapi"
+)
+
+/*
+协程用goroutine实现：每个协程在自己的goroutine里运行，resume和yield通过coChan交接控制权，
+任何时候只有一个goroutine在执行lua代码，所以yield可以穿过任意的Go函数。
+挂起的协程的goroutine一直阻塞在yield里，不会被回收，直到宿主调用CloseThread。
+*/
+
+//threadClosed CloseThread让挂起的协程从Yield里以它panic，一直展开到协程的goroutine的最外层
+type threadClosed struct{}
+
+//NewThread 创建一个新线程并压入栈顶，新线程和当前线程共享registry(也就是全局变量)；
+//协程挂起后它的goroutine会一直存在，不再需要时要用CloseThread结束它
+func (state *luaState) NewThread() luaapi.LuaState {
+	t := &luaState{registry: state.registry}
+	t.pushLuaStack(newLuaStack(luaapi.LUA_MINSTACK, t))
+	state.stack.push(t)
+	return t
+}
+
+//Resume 开始或者继续执行协程：第一次resume时栈上是函数和nArgs个参数，之后是yield的返回值；
+//返回LUA_YIELD时栈上是yield传出的值，返回LUA_OK时是函数的返回值，出错时是错误对象
+func (state *luaState) Resume(from luaapi.LuaState, nArgs int) int {
+	lsFrom := from.(*luaState)
+	if lsFrom.coChan == nil {
+		lsFrom.coChan = make(chan int)
+	}
+
+	if state.coChan == nil {
+		//第一次resume
+		state.coChan = make(chan int)
+		state.coCaller = lsFrom
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if _, ok := r.(threadClosed); ok {
+						state.coChan <- 1 //告诉CloseThread协程已经结束
+						return
+					}
+					state.coPanic, _ = r.(*GoPanic)
+					if state.coPanic == nil {
+						state.coPanic = &GoPanic{Value: r}
+					}
+					state.coStatus = luaapi.LUA_ERRRUN
+				}
+				state.coCaller.coChan <- 1
+			}()
+			state.coStatus = state.PCall(nArgs, -1, 0)
+		}()
+	} else {
+		if state.coStatus != luaapi.LUA_YIELD {
+			if state.coStatus == luaapi.LUA_OK && state.GetStack() {
+				return state.resumeError("cannot resume non-suspended coroutine")
+			}
+			return state.resumeError("cannot resume dead coroutine")
+		}
+		state.coStatus = luaapi.LUA_OK
+		state.coCaller = lsFrom
+		state.coChan <- 1
+	}
+
+	<-lsFrom.coChan //等协程执行完或者yield
+	if p := state.coPanic; p != nil {
+		state.coPanic = nil
+		panic(p)
+	}
+	return state.coStatus
+}
+
+func (state *luaState) resumeError(msg string) int {
+	state.stack.push(msg)
+	return luaapi.LUA_ERRRUN
+}
+
+//Yield 挂起当前协程，栈顶的nResults个值交给Resume；
+//协程恢复执行时栈上是Resume传进来的参数，返回它们的个数
+func (state *luaState) Yield(nResults int) int {
+	if !state.IsYieldable() {
+		state.runtimeError("attempt to yield from outside a coroutine")
+	}
+	if state.stack.top > nResults {
+		results := state.stack.popN(nResults)
+		state.SetTop(0)
+		state.stack.pushN(results, nResults)
+	}
+
+	state.coStatus = luaapi.LUA_YIELD
+	state.coCaller.coChan <- 1
+	if <-state.coChan == coClose {
+		panic(threadClosed{})
+	}
+	return state.GetTop()
+}
+
+//coClose 通过coChan发给挂起的协程，让它结束而不是继续执行
+const coClose = 0
+
+//CloseThread 和lua_closethread一样重置线程：结束挂起的协程的goroutine，清空栈，之后线程可以重新使用；
+//线程因为出错而停止时返回那个状态码并把错误对象留在栈顶，否则返回LUA_OK。不能关闭正在执行的线程
+func (state *luaState) CloseThread() int {
+	status := state.coStatus
+	if status == luaapi.LUA_OK && state.GetStack() {
+		panic(state.newLuaError("cannot close a running coroutine"))
+	}
+	if status == luaapi.LUA_YIELD {
+		state.coChan <- coClose
+		<-state.coChan //等协程的goroutine展开完
+		status = luaapi.LUA_OK
+	}
+
+	var err luaValue
+	if status != luaapi.LUA_OK && state.stack.top > 0 {
+		err = state.stack.get(-1)
+	}
+	state.stack, state.nCalls = nil, 0
+	state.pushLuaStack(newLuaStack(luaapi.LUA_MINSTACK, state))
+	state.coStatus, state.coCaller, state.coChan, state.coPanic = luaapi.LUA_OK, nil, nil, nil
+	if status != luaapi.LUA_OK {
+		state.stack.push(err)
+	}
+	return status
+}
+
+//Status 线程的状态：LUA_OK、LUA_YIELD或者执行出错时的状态码
+func (state *luaState) Status() int {
+	return state.coStatus
+}
+
+//IsYieldable 能不能yield，只有主线程不能
+func (state *luaState) IsYieldable() bool {
+	return !state.isMainThread() && state.coCaller != nil
+}
+
+//ToThread 把索引处的值转换成线程，不是线程时返回nil
+func (state *luaState) ToThread(idx int) luaapi.LuaState {
+	val := state.stack.get(idx)
+	if t, ok := val.(*luaState); ok {
+		return t
+	}
+	return nil
+}
+
+//PushThread 把当前线程压入栈顶，返回它是不是主线程
+func (state *luaState) PushThread() bool {
+	state.stack.push(state)
+	return state.isMainThread()
+}
+
+//XMove 从当前线程的栈顶弹出n个值，按原来的顺序压入to的栈
+func (state *luaState) XMove(to luaapi.LuaState, n int) {
+	vals := state.stack.popN(n)
+	toStack := to.(*luaState).stack
+	toStack.check(n)
+	toStack.pushN(vals, n)
+}
+
+//GetStack 线程里有没有正在执行的函数，相当于lua_getstack(L, 0, &ar)
+func (state *luaState) GetStack() bool {
+	return state.stack.pre != nil
+}
+
+func (state *luaState) isMainThread() bool {
+	return state.registry.get(luaapi.LUA_RIDX_MAINTHREAD) == state
+}
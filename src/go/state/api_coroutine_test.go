@@ -0,0 +1,75 @@
+package state
+
+import (
+	"go/luaapi"
+	"runtime"
+	"testing"
+	"time"
+)
+
+//newYieldingThread 创建一个执行到yield挂起的协程
+func newYieldingThread(t *testing.T, ls luaapi.LuaState) luaapi.LuaState {
+	t.Helper()
+	co := ls.NewThread()
+	ls.Pop(1)
+	if status := co.Load([]byte("local x = ... yield(x + 1) return 'not reached'"), "=co", "t"); status != luaapi.LUA_OK {
+		t.Fatal(co.ToString(-1))
+	}
+	co.PushInteger(1)
+	if status := co.Resume(ls, 1); status != luaapi.LUA_YIELD {
+		t.Fatalf("Resume = %d, want LUA_YIELD", status)
+	}
+	if co.GetTop() != 1 || co.ToInteger(1) != 2 {
+		t.Fatalf("yielded %s", co.ToString(-1))
+	}
+	co.SetTop(0)
+	return co
+}
+
+func TestCloseThread(t *testing.T) {
+	ls := New()
+	ls.Register("yield", func(ls luaapi.LuaState) int { return ls.Yield(ls.GetTop()) })
+	before := runtime.NumGoroutine()
+	var threads []luaapi.LuaState
+	for i := 0; i < 100; i++ {
+		threads = append(threads, newYieldingThread(t, ls))
+	}
+	for _, co := range threads {
+		if status := co.CloseThread(); status != luaapi.LUA_OK {
+			t.Fatalf("CloseThread = %d, want LUA_OK", status)
+		}
+		if co.Status() != luaapi.LUA_OK || co.GetTop() != 0 || co.GetStack() {
+			t.Fatalf("thread not reset: status %d, top %d", co.Status(), co.GetTop())
+		}
+	}
+	//goroutine退出需要一点时间
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left after CloseThread, had %d", n, before)
+	}
+
+	//关闭之后可以重新使用
+	co := threads[0]
+	co.Load([]byte("return 42"), "=co", "t")
+	if status := co.Resume(ls, 0); status != luaapi.LUA_OK || co.ToInteger(-1) != 42 {
+		t.Errorf("Resume after CloseThread = %d, %s", status, co.ToString(-1))
+	}
+}
+
+func TestCloseThreadError(t *testing.T) {
+	ls := New()
+	co := ls.NewThread()
+	co.Load([]byte("error('boom')"), "=co", "t")
+	co.Register("error", func(ls luaapi.LuaState) int { return ls.Error() })
+	if status := co.Resume(ls, 0); status != luaapi.LUA_ERRRUN {
+		t.Fatalf("Resume = %d, want LUA_ERRRUN", status)
+	}
+	if status := co.CloseThread(); status != luaapi.LUA_ERRRUN || co.GetTop() != 1 || co.ToString(-1) != "boom" {
+		t.Errorf("CloseThread = %d with %q on the stack", status, co.ToString(-1))
+	}
+	if co.Status() != luaapi.LUA_OK {
+		t.Errorf("Status after CloseThread = %d", co.Status())
+	}
+}
@@ -0,0 +1,305 @@
+package state
+
+import (
+	"fmt"
+	"go/binchunk"
+	"go/compiler/lexer"
+	"go/luaapi"
+	"go/luavm"
+	"sort"
+	"strings"
+)
+
+const (
+	levels1 = 10 //Traceback太长时保留开头的层数
+	levels2 = 11 //和结尾的层数
+)
+
+/*
+Traceback 和luaL_traceback一样，把线程L的调用栈从第level层开始格式化，压入当前线程的栈顶：
+
+	msg
+	stack traceback:
+		[C]: in function 'error'
+		test.lua:3: in local 'f'
+		test.lua:6: in main chunk
+
+第0层是L正在执行的函数，第1层是调用它的函数，依此类推。msg为空串时省略第一行。
+*/
+func (state *luaState) Traceback(L luaapi.LuaState, msg string, level int) {
+	var buf strings.Builder
+	if msg != "" {
+		buf.WriteString(msg)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("stack traceback:")
+
+	var frames []*luaStack
+	for stack := L.(*luaState).stack; stack.pre != nil; stack = stack.pre {
+		frames = append(frames, stack)
+	}
+	if level < len(frames) {
+		frames = frames[level:]
+	} else {
+		frames = nil
+	}
+	for i, frame := range frames {
+		if len(frames) > levels1+levels2 && i == levels1 {
+			buf.WriteString("\n\t...")
+		}
+		if len(frames) > levels1+levels2 && i >= levels1 && i < len(frames)-levels2 {
+			continue
+		}
+		buf.WriteString("\n\t")
+		buf.WriteString(frameInfo(L.(*luaState), frame))
+	}
+	state.stack.push(buf.String())
+}
+
+//Where 和luaL_where一样，把第level层函数正在执行的位置压入栈顶，比如"test.lua:3: "；
+//那一层不是lua函数或者没有行号时压入空串
+func (state *luaState) Where(level int) {
+	frame := state.stack
+	for ; level > 0 && frame.pre != nil; level-- {
+		frame = frame.pre
+	}
+	if frame.pre != nil && frame.closure.proto != nil {
+		if line := currentLine(frame); line > 0 {
+			state.stack.push(fmt.Sprintf("%s:%d: ", shortSrc(frame.closure.proto.Source), line))
+			return
+		}
+	}
+	state.stack.push("")
+}
+
+//frameInfo 一层调用的描述，比如test.lua:3: in local 'f'
+func frameInfo(ls *luaState, frame *luaStack) string {
+	var where, name string
+	c := frame.closure
+	if c.proto == nil {
+		where = "[C]:"
+	} else if line := currentLine(frame); line > 0 {
+		where = fmt.Sprintf("%s:%d:", shortSrc(c.proto.Source), line)
+	} else {
+		where = fmt.Sprintf("%s:", shortSrc(c.proto.Source))
+	}
+
+	if global := globalFuncName(ls, c); global != "" {
+		name = fmt.Sprintf("function '%s'", global)
+	} else if namewhat, fname := funcName(frame); namewhat != "" {
+		name = fmt.Sprintf("%s '%s'", namewhat, fname)
+	} else if c.proto == nil {
+		name = "?"
+	} else if c.proto.LineDefine == 0 {
+		name = "main chunk"
+	} else {
+		name = fmt.Sprintf("function <%s:%d>", shortSrc(c.proto.Source), c.proto.LineDefine)
+	}
+	return where + " in " + name
+}
+
+//currentLine lua函数正在执行的指令的行号，没有调试信息时返回0
+func currentLine(frame *luaStack) int {
+	proto := frame.closure.proto
+	if pc := frame.pc - 1; pc >= 0 && pc < len(proto.LineInfo) {
+		return int(proto.LineInfo[pc])
+	}
+	return 0
+}
+
+//shortSrc 和luaO_chunkid一样把Source变成报错用的名字
+func shortSrc(source string) string {
+	if source == "" {
+		return "?"
+	}
+	return lexer.ChunkID(source)
+}
+
+//globalFuncName 在全局变量里找c的名字，有多个名字时取最小的
+func globalFuncName(ls *luaState, c *luaClosure) string {
+	globals, ok := ls.registry.get(luaapi.LUA_RIDX_GLOBALS).(*luaTable)
+	if !ok {
+		return ""
+	}
+	var names []string
+	for k, v := range globals._map {
+		if name, ok := k.(string); ok && v == c {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+//funcName 根据调用者正在执行的指令推断被调用的函数的名字，和ldebug.c的getfuncname一样
+func funcName(frame *luaStack) (namewhat, name string) {
+	caller := frame.pre
+	if caller == nil || caller.closure == nil || caller.closure.proto == nil || caller.pc < 1 {
+		return "", ""
+	}
+	proto, pc := caller.closure.proto, caller.pc-1
+	if pc >= len(proto.Code) {
+		return "", ""
+	}
+	inst := luavm.Instruction(proto.Code[pc])
+	switch inst.OpCode() {
+	case luavm.OP_CALL, luavm.OP_TAILCALL:
+		a, _, _ := inst.ABC()
+		return objName(proto, pc, a)
+	case luavm.OP_TFORCALL:
+		return "for iterator", "for iterator"
+	}
+	return "", ""
+}
+
+//objName 寄存器reg在pc处的值是从哪里来的
+func objName(proto *binchunk.Prototype, pc, reg int) (namewhat, name string) {
+	if name := localName(proto, reg+1, pc); name != "" {
+		return "local", name
+	}
+	setPC := findSetReg(proto, pc, reg)
+	if setPC < 0 {
+		return "", ""
+	}
+	inst := luavm.Instruction(proto.Code[setPC])
+	a, b, c := inst.ABC()
+	switch inst.OpCode() {
+	case luavm.OP_MOVE:
+		if b < a {
+			return objName(proto, setPC, b)
+		}
+	case luavm.OP_GETTABUP:
+		return tableKindName(upvalueName(proto, b) == "_ENV"), keyName(proto, setPC, c)
+	case luavm.OP_GETTABLE:
+		env := localName(proto, b+1, setPC)
+		if namewhat, name := objName(proto, setPC, b); env == "" && namewhat == "upvalue" {
+			env = name //先用GETUPVAL把_ENV加载到寄存器里
+		}
+		return tableKindName(env == "_ENV"), keyName(proto, setPC, c)
+	case luavm.OP_GETUPVAL:
+		return "upvalue", upvalueName(proto, b)
+	case luavm.OP_LOADK:
+		_, bx := inst.ABx()
+		if s, ok := proto.Constants[bx].(string); ok {
+			return "constant", s
+		}
+	case luavm.OP_SELF:
+		return "method", keyName(proto, setPC, c)
+	}
+	return "", ""
+}
+
+func tableKindName(isEnv bool) string {
+	if isEnv {
+		return "global"
+	}
+	return "field"
+}
+
+//findSetReg 找pc之前最后一条写寄存器reg的指令，跳转目标之前的指令不算
+func findSetReg(proto *binchunk.Prototype, lastPC, reg int) int {
+	setReg, jmpTarget := -1, 0
+	filter := func(pc int) int {
+		if pc < jmpTarget {
+			return -1
+		}
+		return pc
+	}
+	for pc := 0; pc < lastPC; pc++ {
+		inst := luavm.Instruction(proto.Code[pc])
+		a, b, _ := inst.ABC()
+		switch inst.OpCode() {
+		case luavm.OP_LOADNIL:
+			if a <= reg && reg <= a+b {
+				setReg = filter(pc)
+			}
+		case luavm.OP_TFORCALL:
+			if reg >= a+2 {
+				setReg = filter(pc)
+			}
+		case luavm.OP_CALL, luavm.OP_TAILCALL:
+			if reg >= a {
+				setReg = filter(pc)
+			}
+		case luavm.OP_JMP:
+			_, sBx := inst.AsBx()
+			if dest := pc + 1 + sBx; pc < dest && dest <= lastPC && dest > jmpTarget {
+				jmpTarget = dest
+			}
+		default:
+			if inst.SetsA() && reg == a {
+				setReg = filter(pc)
+			}
+		}
+	}
+	return setReg
+}
+
+//localName 第n个(从1开始)在pc处有效的局部变量的名字
+func localName(proto *binchunk.Prototype, n, pc int) string {
+	for _, locVar := range proto.LocVars {
+		if int(locVar.StartPC) > pc {
+			break
+		}
+		if pc < int(locVar.EndPC) {
+			if n--; n == 0 {
+				return locVar.VarName
+			}
+		}
+	}
+	return ""
+}
+
+func upvalueName(proto *binchunk.Prototype, idx int) string {
+	if idx < len(proto.UpvalueNames) {
+		return proto.UpvalueNames[idx]
+	}
+	return "?"
+}
+
+//keyName RK(rk)是字符串常量，或者是从字符串常量加载的寄存器时返回这个字符串，否则返回"?"
+func keyName(proto *binchunk.Prototype, pc, rk int) string {
+	if rk > 0xFF {
+		if s, ok := proto.Constants[rk&0xFF].(string); ok {
+			return s
+		}
+	} else if namewhat, name := objName(proto, pc, rk); namewhat == "constant" {
+		return name
+	}
+	return "?"
+}
+
+//varInfo 当前lua函数正在执行的索引或者调用指令操作的对象就是val时，返回它的描述，比如" (global 'x')"
+func (state *luaState) varInfo(val luaValue) string {
+	frame := state.stack
+	c := frame.closure
+	if c == nil || c.proto == nil || frame.pc < 1 || frame.pc > len(c.proto.Code) {
+		return ""
+	}
+	proto, pc := c.proto, frame.pc-1
+	inst := luavm.Instruction(proto.Code[pc])
+	a, b, _ := inst.ABC()
+	reg, upval := -1, -1
+	switch inst.OpCode() {
+	case luavm.OP_GETTABLE, luavm.OP_SELF:
+		reg = b
+	case luavm.OP_SETTABLE, luavm.OP_CALL, luavm.OP_TAILCALL:
+		reg = a
+	case luavm.OP_GETTABUP:
+		upval = b
+	case luavm.OP_SETTABUP:
+		upval = a
+	}
+	if reg >= 0 && reg < len(frame.slots) && frame.slots[reg] == val {
+		if namewhat, name := objName(proto, pc, reg); namewhat != "" {
+			return fmt.Sprintf(" (%s '%s')", namewhat, name)
+		}
+	}
+	if upval >= 0 && upval < len(c.upvals) && c.upvals[upval] != nil && *c.upvals[upval].val == val {
+		return fmt.Sprintf(" (upvalue '%s')", upvalueName(proto, upval))
+	}
+	return ""
+}
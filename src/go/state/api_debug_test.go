@@ -0,0 +1,79 @@
+package state
+
+import (
+	"go/luaapi"
+	"strings"
+	"testing"
+)
+
+func TestTraceback(t *testing.T) {
+	ls := newTestState(t)
+	var results []string
+	ls.Register("result", func(ls luaapi.LuaState) int {
+		results = append(results, ls.ToString(ls.GetTop())) //xpcall的结果只要最后一个
+		return 0
+	})
+	run(t, ls, `local function f()
+  error("boom")
+end
+local function g() f() end
+result(xpcall(g, traceback))
+local t = {}
+function t.m() local x = nil; return x.y end
+result(xpcall(function() t.m() end, traceback))
+local function rec(n) if n == 0 then error("deep") end rec(n - 1) end
+result(xpcall(rec, traceback, 30))
+result(traceback(""))`)
+
+	want := []string{
+		`boom
+stack traceback:
+	[C]: in function 'error'
+	test:2: in upvalue 'f'
+	test:4: in function <test:4>
+	[C]: in function 'xpcall'
+	test:5: in main chunk`,
+		`test:7: attempt to index a nil value (local 'x')
+stack traceback:
+	test:7: in field 'm'
+	test:8: in function <test:8>
+	[C]: in function 'xpcall'
+	test:8: in main chunk`,
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i, w := range want {
+		if results[i] != w {
+			t.Errorf("traceback %d:\ngot:\n%s\nwant:\n%s", i, results[i], w)
+		}
+	}
+
+	//太长时只保留开头的levels1层和结尾的levels2层
+	lines := strings.Split(results[2], "\n")
+	if len(lines) != 2+levels1+1+levels2 || lines[2+levels1] != "\t..." {
+		t.Errorf("long traceback:\n%s", results[2])
+	}
+	if last := lines[len(lines)-1]; last != "\ttest:10: in main chunk" {
+		t.Errorf("long traceback ends with %q", last)
+	}
+	if results[3] != "stack traceback:\n\ttest:11: in main chunk" {
+		t.Errorf("traceback without message = %q", results[3])
+	}
+}
+
+//TestWhere 第1层是调用Go函数的lua函数时返回它的位置，是Go函数时返回空串
+func TestWhere(t *testing.T) {
+	ls := newTestState(t)
+	ls.Register("where", func(ls luaapi.LuaState) int {
+		ls.Where(int(ls.ToInteger(1)))
+		return 1
+	})
+	run(t, ls, `
+		check(where(1) == "test:2: ", where(1))
+		check(where(0) == "", "level 0 is the Go function")
+		local ok, w = pcall(where, 1)
+		check(ok and w == "", "called from pcall")
+		check(where(5) == "", "level beyond the stack")
+	`)
+}
@@ -9,7 +9,7 @@ func (state *luaState) Len(idx int) {
 	} else if t, ok := val.(*luaTable); ok {
 		state.stack.push(int64(t.len()))
 	} else {
-		panic("length error")
+		state.typeError(val, "get length of", "")
 	}
 }
 
@@ -32,16 +32,15 @@ func (state *luaState) Concat(n int) {
 				state.stack.push(result)
 				continue
 			}
-			panic("concatenation error")
+			state.concatError(a, b)
 		}
 	}
 }
 
+//Error 弹出栈顶的错误对象，以*LuaError抛出
 func (state *luaState) Error() int {
 	err := state.stack.pop()
-	panic(err)
-	//println(err)
-	//return 0
+	panic(state.newLuaError(err))
 }
 
 func (state *luaState) RawLen(idx int) {
@@ -51,7 +50,7 @@ func (state *luaState) RawLen(idx int) {
 	} else if t, ok := val.(*luaTable); ok {
 		state.stack.push(int64(t.len()))
 	} else {
-		panic("length error")
+		state.typeError(val, "get length of", "")
 	}
 }
 
@@ -66,5 +65,6 @@ func (state *luaState) Next(idx int) bool {
 		}
 		return false
 	}
-	panic("table expected")
+	state.runtimeError("table expected, got %s", typeName(typeOf(val)))
+	return false
 }
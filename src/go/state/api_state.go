@@ -100,26 +100,7 @@ func (state *luaState) PushString(s string) {
 }
 
 func (state *luaState) TypeName(tp luaapi.LuaType) string {
-	switch tp {
-	case luaapi.LUA_TNONE:
-		return "no value"
-	case luaapi.LUA_TNIL:
-		return "nil"
-	case luaapi.LUA_TBOOLEAN:
-		return "boolean"
-	case luaapi.LUA_TNUMBER:
-		return "number"
-	case luaapi.LUA_TSTRING:
-		return "string"
-	case luaapi.LUA_TTABLE:
-		return "table"
-	case luaapi.LUA_TFUNCTION:
-		return "function"
-	case luaapi.LUA_TTHREAD:
-		return "thread"
-	default:
-		return "userdata"
-	}
+	return typeName(tp)
 }
 
 func (state *luaState) Type(idx int) luaapi.LuaType {
@@ -139,7 +120,7 @@ func (state *luaState) IsNil(idx int) bool {
 }
 
 func (state *luaState) IsNoneOrNil(idx int) bool {
-	return state.Type(idx) == luaapi.LUA_TNIL
+	return state.Type(idx) <= luaapi.LUA_TNIL
 }
 
 func (state *luaState) IsBoolean(idx int) bool {
@@ -227,13 +208,15 @@ func (state *luaState) ToString(idx int) string {
 	return s
 }
 
+//PushGoFunction 弹出n个值作为f的upvalue，创建Go闭包并压入栈顶；
+//f执行时可以通过伪索引luaapi.LuaUpvaluesIndex(i)读写第i个upvalue
 func (state *luaState) PushGoFunction(f luaapi.GoFunction, n int) {
 	closure := newGoClosure(f, n)
 	for i := n; i > 0; i-- {
 		val := state.stack.pop()
-		closure.upvals[n-1] = &upvalue{&val}
+		closure.upvals[i-1] = &upvalue{&val}
 	}
-	state.stack.push(newGoClosure(f, 0))
+	state.stack.push(closure)
 }
 
 func (state *luaState) IsGoFunction(idx int) bool {
@@ -293,6 +276,6 @@ func (state *luaState) SetMetatable(idx int) {
 	} else if mt, ok := mtVal.(*luaTable); ok {
 		setMetatable(val, mt, state)
 	} else {
-		panic("table expected!")
+		state.runtimeError("nil or table expected")
 	}
 }
@@ -42,7 +42,8 @@ func (state *luaState) getTable(t, k luaValue, bRaw bool) luaapi.LuaType {
 			}
 		}
 	}
-	panic("not a table")
+	state.typeError(t, "index", state.varInfo(t))
+	return luaapi.LUA_TNIL
 }
 
 func (state *luaState) GetField(idx int, k string) luaapi.LuaType {
@@ -65,7 +66,8 @@ func (state *luaState) SetTable(idx int) {
 func (state *luaState) setTable(t, k, v luaValue, bRaw bool) {
 	if tbl, ok := t.(*luaTable); ok {
 		if bRaw || tbl.get(k) != nil || !tbl.hasMetafield("__newindex") {
-			tbl.put(k, v)
+			//nil和NaN不能作为键，但是__newindex可以处理它们，所以由put在真正写入时检查
+			tbl.put(k, v, state)
 			return
 		}
 	}
@@ -86,7 +88,7 @@ func (state *luaState) setTable(t, k, v luaValue, bRaw bool) {
 		}
 	}
 
-	panic("not a table")
+	state.typeError(t, "index", state.varInfo(t))
 }
 
 func (state *luaState) SetField(idx int, k string) {
@@ -0,0 +1,60 @@
+package state
+
+import (
+	"go/luaapi"
+	"math"
+	"testing"
+)
+
+//TestNewIndexNilKey nil和NaN键先交给__newindex，没有__newindex时才报错
+func TestNewIndexNilKey(t *testing.T) {
+	run(t, newTestState(t), `
+		local n = 0
+		local t = setmetatable({}, {__newindex = function(t, k, v) n = n + v end})
+		t[nil] = 1
+		t[0/0] = 2
+		check(n == 3, "__newindex was not called for nil and NaN")
+
+		local ok, err = pcall(function() local r = {} r[nil] = 1 end)
+		check(not ok and err == "test:8: table index is nil", tostring(err))
+		ok, err = pcall(function() local r = {} r[0/0] = 1 end)
+		check(not ok and err == "test:10: table index is NaN", tostring(err))
+		ok, err = pcall(function() local p = setmetatable({}, {__newindex = {}}) p[nil] = 1 end)
+		check(not ok and err == "test:12: table index is nil", tostring(err))
+	`)
+}
+
+//TestRawSetInvalidKey Go函数用RawSet写入nil或NaN键时是普通的运行时错误，pcall可以捕获
+func TestRawSetInvalidKey(t *testing.T) {
+	ls := newTestState(t)
+	ls.Register("rawnil", func(ls luaapi.LuaState) int {
+		ls.NewTable()
+		ls.PushNil()
+		ls.PushInteger(1)
+		ls.RawSet(-3)
+		return 0
+	})
+	ls.Register("rawnan", func(ls luaapi.LuaState) int {
+		ls.NewTable()
+		ls.PushNumber(math.NaN())
+		ls.PushInteger(1)
+		ls.RawSet(-3)
+		return 0
+	})
+	run(t, ls, `
+		local ok, err = pcall(rawnil)
+		check(not ok and err == "table index is nil", tostring(err))
+		ok, err = pcall(rawnan)
+		check(not ok and err == "table index is NaN", tostring(err))
+	`)
+
+	defer func() {
+		if err, ok := recover().(*LuaError); !ok || err.Error() != "table index is nil" {
+			t.Errorf("recovered %v, want *LuaError", err)
+		}
+	}()
+	ls.NewTable()
+	ls.PushNil()
+	ls.PushInteger(1)
+	ls.RawSet(-3)
+}
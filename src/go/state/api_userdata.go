@@ -0,0 +1,52 @@
+package state
+
+import (
+	"go/luaapi"
+)
+
+//userdata 包装一个Go值的完整userdata，每个userdata有自己的元表和user value
+type userdata struct {
+	metaTable *luaTable
+	userValue luaValue
+	data      interface{}
+}
+
+//NewUserdata 创建包装v的userdata并压入栈顶，lua代码只能通过元表操作它
+func (state *luaState) NewUserdata(v interface{}) {
+	state.stack.push(&userdata{data: v})
+}
+
+//ToUserdata 返回索引处的userdata包装的Go值，不是userdata时返回nil
+func (state *luaState) ToUserdata(idx int) interface{} {
+	if u, ok := state.stack.get(idx).(*userdata); ok {
+		return u.data
+	}
+	return nil
+}
+
+func (state *luaState) IsUserdata(idx int) bool {
+	return state.Type(idx) == luaapi.LUA_TUSERDATA
+}
+
+//GetUserValue 把索引处的userdata的user value压入栈顶，返回它的类型
+func (state *luaState) GetUserValue(idx int) luaapi.LuaType {
+	u := state.checkUserdata(idx)
+	state.stack.push(u.userValue)
+	return typeOf(u.userValue)
+}
+
+//SetUserValue 弹出栈顶的值，设置成索引处的userdata的user value
+func (state *luaState) SetUserValue(idx int) {
+	u := state.checkUserdata(idx)
+	u.userValue = state.stack.pop()
+}
+
+//checkUserdata 索引处不是userdata时抛出lua代码能捕获的错误
+func (state *luaState) checkUserdata(idx int) *userdata {
+	val := state.stack.get(idx)
+	if u, ok := val.(*userdata); ok {
+		return u
+	}
+	state.runtimeError("userdata expected, got %s", typeName(typeOf(val)))
+	return nil
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"go/luaapi"
+	"testing"
+)
+
+func TestUserdata(t *testing.T) {
+	ls := newTestState(t)
+	ls.Register("point", func(ls luaapi.LuaState) int {
+		ls.NewUserdata([2]int64{ls.ToInteger(1), ls.ToInteger(2)})
+		ls.GetGlobal("Point")
+		ls.SetMetatable(-2)
+		return 1
+	})
+	ls.Register("uservalue", func(ls luaapi.LuaState) int {
+		ls.GetUserValue(1)
+		return 1
+	})
+	ls.NewTable()
+	ls.PushGoFunction(func(ls luaapi.LuaState) int {
+		ls.PushBoolean(ls.ToUserdata(1) == ls.ToUserdata(2))
+		return 1
+	}, 0)
+	ls.SetField(-2, "__eq")
+	ls.SetGlobal("Point")
+
+	//计数器的方法通过元表的__index找到
+	ls.Register("counter", func(ls luaapi.LuaState) int {
+		ls.NewUserdata(new(int64))
+		ls.GetGlobal("Counter")
+		ls.SetMetatable(-2)
+		return 1
+	})
+	ls.Register("plain", func(ls luaapi.LuaState) int {
+		ls.NewUserdata(0)
+		return 1
+	})
+	ls.NewTable()
+	ls.NewTable()
+	ls.PushGoFunction(func(ls luaapi.LuaState) int {
+		n := ls.ToUserdata(1).(*int64)
+		if ls.IsNoneOrNil(2) {
+			*n++
+		} else {
+			*n += ls.ToInteger(2)
+		}
+		ls.PushInteger(*n)
+		return 1
+	}, 0)
+	ls.SetField(-2, "inc")
+	ls.SetField(-2, "__index")
+	ls.SetGlobal("Counter")
+
+	run(t, ls, `
+		local a, b, c = point(1, 2), point(1, 2), point(2, 1)
+		check(a == b and a ~= c, "__eq")
+		check(uservalue(a) == nil, "uservalue")
+		local ok, err = pcall(uservalue, {})
+		check(not ok and err == "userdata expected, got table", tostring(err))
+
+		local n = counter()
+		n:inc()
+		check(n:inc(5) == 6, "method through __index")
+		check(n.missing == nil, "missing method")
+
+		local u = plain()
+		ok, err = pcall(function() return u.x end)
+		check(not ok and err == "test:14: attempt to index a userdata value (upvalue 'u')", tostring(err))
+		ok, err = pcall(function() return u + 1 end)
+		check(not ok and err == "test:16: attempt to perform arithmetic on a userdata value", tostring(err))
+	`)
+}
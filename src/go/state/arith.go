@@ -61,6 +61,15 @@ func (state *luaState) Arith(op luaapi.ArithOp) {
 		a = b
 	}
 	operator := operators[op]
+	if op == luaapi.LUA_OPIDIV || op == luaapi.LUA_OPMOD {
+		_, aOK := a.(int64)
+		if y, ok := b.(int64); ok && aOK && y == 0 {
+			if op == luaapi.LUA_OPIDIV {
+				state.runtimeError("attempt to divide by zero")
+			}
+			state.runtimeError("attempt to perform 'n%%0'")
+		}
+	}
 	if result := _arith(a, b, operator); result != nil {
 		state.stack.push(result)
 		return
@@ -70,7 +79,7 @@ func (state *luaState) Arith(op luaapi.ArithOp) {
 		state.stack.push(result)
 		return
 	}
-	panic("arithmetic error")
+	state.arithError(a, b, operator.floatFunc == nil)
 }
 
 func _arith(a, b luaValue, op operator) luaValue {
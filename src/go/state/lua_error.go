@@ -0,0 +1,160 @@
+package state
+
+import (
+	"fmt"
+	"go/luaapi"
+	"runtime/debug"
+)
+
+//maxCalls 嵌套调用的最大层数，超过时报stack overflow，避免耗尽Go的栈
+const maxCalls = 20000
+
+/*
+LuaError lua代码能用pcall捕获的错误：error抛出的值，或者虚拟机执行时发现的错误，比如对nil做算术运算。
+lua函数和Go函数里的错误都以*LuaError panic，PCall捕获它并把Value作为错误对象；
+宿主程序在PCall之外调用Call时可以recover它。
+*/
+type LuaError struct {
+	Value  interface{} //错误对象，虚拟机发现的错误是"chunk:line: msg"形式的字符串
+	Source string      //出错时最内层的lua函数的Source，没有lua函数时为空
+	Line   int         //出错的行号，没有调试信息时为0
+}
+
+func (err *LuaError) Error() string {
+	switch x := err.Value.(type) {
+	case string:
+		return x
+	case int64, float64:
+		return fmt.Sprint(x)
+	default:
+		return fmt.Sprintf("(error object is a %s value)", typeName(typeOf(x)))
+	}
+}
+
+/*
+GoPanic Go函数里除了*LuaError以外的panic，通常是宿主程序的bug，比如空指针。
+PCall不捕获它，它会一直传到宿主程序调用Call的地方，和lua代码的错误区分开。
+*/
+type GoPanic struct {
+	Value interface{} //原来的panic的值
+	Stack []byte      //panic时的Go调用栈
+}
+
+func (p *GoPanic) Error() string {
+	return fmt.Sprintf("panic in Go function: %v\n%s", p.Value, p.Stack)
+}
+
+//newLuaError 用当前最内层的lua函数的位置创建错误
+func (state *luaState) newLuaError(val luaValue) *LuaError {
+	err := &LuaError{Value: val}
+	for stack := state.stack; stack != nil; stack = stack.pre {
+		if c := stack.closure; c != nil && c.proto != nil {
+			err.Source, err.Line = c.proto.Source, currentLine(stack)
+			break
+		}
+	}
+	return err
+}
+
+//runtimeError 和luaG_runerror一样抛出虚拟机的错误，正在执行的是lua函数时在消息前面加上位置
+func (state *luaState) runtimeError(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if c := state.stack.closure; c != nil && c.proto != nil {
+		if line := currentLine(state.stack); line > 0 {
+			msg = fmt.Sprintf("%s:%d: %s", shortSrc(c.proto.Source), line, msg)
+		} else {
+			msg = fmt.Sprintf("%s:?: %s", shortSrc(c.proto.Source), msg)
+		}
+	}
+	panic(state.newLuaError(msg))
+}
+
+//catchVMPanic 执行lua函数时deferred调用，把虚拟机里的其他panic(比如下标越界)变成LuaError
+func (state *luaState) catchVMPanic() {
+	if r := recover(); r != nil {
+		switch r.(type) {
+		case *LuaError, *GoPanic, threadClosed:
+			panic(r)
+		default:
+			state.runtimeError("%v", r)
+		}
+	}
+}
+
+//callGoFunction 调用Go函数，把它的其他panic包装成GoPanic
+func (state *luaState) callGoFunction(c *luaClosure) int {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r.(type) {
+			case *LuaError, *GoPanic, threadClosed:
+				panic(r)
+			default:
+				panic(&GoPanic{Value: r, Stack: debug.Stack()})
+			}
+		}
+	}()
+	return c.goFunc(state)
+}
+
+//typeError 和luaG_typeerror一样，比如attempt to index a nil value (global 'x')
+func (state *luaState) typeError(val luaValue, op, varInfo string) {
+	state.runtimeError("attempt to %s a %s value%s", op, typeName(typeOf(val)), varInfo)
+}
+
+//arithError 算术或者位运算的操作数不是数字，或者位运算的数字没有整数表示
+func (state *luaState) arithError(a, b luaValue, bitwise bool) {
+	_, aOK := convertToFloat(a)
+	_, bOK := convertToFloat(b)
+	if bitwise && aOK && bOK {
+		state.runtimeError("number has no integer representation")
+	}
+	bad := a
+	if aOK {
+		bad = b
+	}
+	if bitwise {
+		state.typeError(bad, "perform bitwise operation on", "")
+	}
+	state.typeError(bad, "perform arithmetic on", "")
+}
+
+//concatError 报告第一个不是字符串或者数字的操作数
+func (state *luaState) concatError(a, b luaValue) {
+	switch a.(type) {
+	case string, int64, float64:
+		a = b
+	}
+	state.typeError(a, "concatenate", "")
+}
+
+//compareError 和luaG_ordererror一样
+func (state *luaState) compareError(a, b luaValue) {
+	t1, t2 := typeName(typeOf(a)), typeName(typeOf(b))
+	if t1 == t2 {
+		state.runtimeError("attempt to compare two %s values", t1)
+	}
+	state.runtimeError("attempt to compare %s with %s", t1, t2)
+}
+
+func typeName(tp luaapi.LuaType) string {
+	switch tp {
+	case luaapi.LUA_TNONE:
+		return "no value"
+	case luaapi.LUA_TNIL:
+		return "nil"
+	case luaapi.LUA_TBOOLEAN:
+		return "boolean"
+	case luaapi.LUA_TNUMBER:
+		return "number"
+	case luaapi.LUA_TSTRING:
+		return "string"
+	case luaapi.LUA_TTABLE:
+		return "table"
+	case luaapi.LUA_TFUNCTION:
+		return "function"
+	case luaapi.LUA_TTHREAD:
+		return "thread"
+	default:
+		return "userdata"
+	}
+}
@@ -0,0 +1,89 @@
+package state
+
+import (
+	"go/luaapi"
+	"runtime"
+	"testing"
+)
+
+//TestCatchableErrors 虚拟机发现的错误和error抛出的值都能被pcall捕获，消息前面是出错的位置
+func TestCatchableErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"local a; return a + 1", "test:1: attempt to perform arithmetic on a nil value"},
+		{"return 1 // 0", "test:1: attempt to divide by zero"},
+		{"return 1 % 0", "test:1: attempt to perform 'n%0'"},
+		{"return x.y", "test:1: attempt to index a nil value (global 'x')"},
+		{"undefinedfn()", "test:1: attempt to call a nil value (global 'undefinedfn')"},
+		{"local t = {} t.a.b = 1", "test:1: attempt to index a nil value (field 'a')"},
+		{"return #nil", "test:1: attempt to get length of a nil value"},
+		{"return {} < {}", "test:1: attempt to compare two table values"},
+		{"return 1 < 'x'", "test:1: attempt to compare number with string"},
+		{"return 'a' .. {}", "test:1: attempt to concatenate a table value"},
+		{"return 1.5 | 1", "test:1: number has no integer representation"},
+		{"local function rec() return 1 + rec() end return rec()", "test:1: stack overflow"},
+		{"error('plain')", "plain"},
+	}
+	for _, tt := range tests {
+		ls := newTestState(t)
+		if status := ls.Load([]byte(tt.src), "=test", "t"); status != luaapi.LUA_OK {
+			t.Fatalf("%q: %s", tt.src, ls.ToString(-1))
+		}
+		if status := ls.PCall(0, 0, 0); status != luaapi.LUA_ERRRUN {
+			t.Errorf("%q: status %d, want LUA_ERRRUN", tt.src, status)
+			continue
+		}
+		if got := ls.ToString(-1); got != tt.want {
+			t.Errorf("%q: error %q, want %q", tt.src, got, tt.want)
+		}
+		if ls.GetTop() != 1 {
+			t.Errorf("%q: %d values left on the stack", tt.src, ls.GetTop())
+		}
+	}
+}
+
+func TestErrorObject(t *testing.T) {
+	run(t, newTestState(t), `
+		local ok, err = pcall(error, {code = 42})
+		check(not ok and err.code == 42, "error object is not preserved")
+		ok, err = pcall(error)
+		check(not ok and err == nil, "error() without a value")
+	`)
+}
+
+//TestLuaErrorOutsidePCall 宿主在PCall之外调用Call时可以recover到*LuaError
+func TestLuaErrorOutsidePCall(t *testing.T) {
+	ls := newTestState(t)
+	ls.Load([]byte("\nlocal a = nil\nreturn a.b"), "@test.lua", "t")
+	defer func() {
+		err, ok := recover().(*LuaError)
+		if !ok {
+			t.Fatalf("recovered %v, want *LuaError", err)
+		}
+		if err.Source != "@test.lua" || err.Line != 3 || err.Error() != "test.lua:3: attempt to index a nil value (local 'a')" {
+			t.Errorf("got %+v", err)
+		}
+	}()
+	ls.Call(0, 0)
+}
+
+//TestGoPanic Go函数里的其他panic不被pcall捕获，以*GoPanic传给宿主
+func TestGoPanic(t *testing.T) {
+	ls := newTestState(t)
+	ls.Register("gonil", func(ls luaapi.LuaState) int {
+		var p *int
+		return *p
+	})
+	ls.Load([]byte("local ok = pcall(gonil) check(false, 'pcall caught a Go panic')"), "=test", "t")
+	defer func() {
+		p, ok := recover().(*GoPanic)
+		if !ok {
+			t.Fatalf("recovered %v, want *GoPanic", p)
+		}
+		if _, ok := p.Value.(runtime.Error); !ok || len(p.Stack) == 0 {
+			t.Errorf("got %v", p)
+		}
+	}()
+	ls.PCall(0, 0, 0)
+}
@@ -52,7 +52,7 @@ func newLuaStack(size int, state *luaState) *luaStack {
 
 func (stack *luaStack) check(n int) {
 	free := len(stack.slots) - stack.top
-	if n >= free {
+	if n <= free {
 		return
 	}
 	for i := free; i < n; i++ {
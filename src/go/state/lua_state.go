@@ -4,29 +4,38 @@ import (
 	"go/luaapi"
 )
 
+//luaState 一个线程(协程)，所有线程共享registry，每个线程有自己的luaStack链
 type luaState struct {
 	stack    *luaStack
 	registry *luaTable
+	nCalls   int //嵌套调用的层数
+	/* coroutine */
+	coStatus int       //LUA_OK、LUA_YIELD或者出错时的状态码
+	coCaller *luaState //最近一次resume这个协程的线程
+	coChan   chan int  //用来在resume和yield之间交接控制权
+	coPanic  *GoPanic  //协程里的Go函数panic了，交给resume它的线程重新panic
 }
 
 func New() *luaState {
 	registry := newLuaTable(0, 0)
-	registry.put(luaapi.LUA_RIDX_GLOBALS, newLuaTable(0, 0))
-
 	ls := &luaState{
 		registry: registry,
 	}
 	ls.pushLuaStack(newLuaStack(luaapi.LUA_MINSTACK, ls))
+	registry.put(luaapi.LUA_RIDX_GLOBALS, newLuaTable(0, 0), ls)
+	registry.put(luaapi.LUA_RIDX_MAINTHREAD, ls, ls)
 	return ls
 }
 
 func (state *luaState) pushLuaStack(stack *luaStack) {
 	stack.pre = state.stack
 	state.stack = stack
+	state.nCalls++
 }
 
 func (state *luaState) popLuaStatck() {
 	statck := state.stack
 	state.stack = statck.pre
 	statck.pre = nil
+	state.nCalls--
 }
@@ -13,17 +13,28 @@ type luaTable struct {
 	keys      map[luaValue]luaValue
 }
 
+//maxSizeHint 预分配的上限；NEWTABLE的B、C用浮点字节编码，最大接近2^34，
+//不可信的chunk或者宿主传来的大数不能直接拿去make，超过的部分在插入时再增长
+const maxSizeHint = 1 << 16
+
 func newLuaTable(nArr, nRec int) *luaTable {
 	t := &luaTable{}
-	if nArr > 0 { //TODO 估计有锅
-		t.arr = make([]luaValue, 0, nArr)
+	if nArr > 0 {
+		t.arr = make([]luaValue, 0, clampSizeHint(nArr))
 	}
 	if nRec > 0 {
-		t._map = make(map[luaValue]luaValue, nRec)
+		t._map = make(map[luaValue]luaValue, clampSizeHint(nRec))
 	}
 	return t
 }
 
+func clampSizeHint(n int) int {
+	if n > maxSizeHint {
+		return maxSizeHint
+	}
+	return n
+}
+
 func (tbl *luaTable) get(key luaValue) luaValue {
 	key = _floatToInteger(key)
 	if idx, ok := key.(int64); ok {
@@ -43,12 +54,13 @@ func _floatToInteger(key luaValue) luaValue {
 	return key
 }
 
-func (tbl *luaTable) put(key, val luaValue) {
+//put 写入一个键值对，nil和NaN不能作为键，用ls报告运行时错误
+func (tbl *luaTable) put(key, val luaValue, ls *luaState) {
 	if key == nil {
-		panic("table index is nill")
+		ls.runtimeError("table index is nil")
 	}
 	if f, ok := key.(float64); ok && math.IsNaN(f) {
-		panic("table index is NaN")
+		ls.runtimeError("table index is NaN")
 	}
 	key = _floatToInteger(key)
 	if idx, ok := key.(int64); ok && idx > 0 {
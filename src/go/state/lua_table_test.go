@@ -0,0 +1,46 @@
+package state
+
+import (
+	"go/binchunk"
+	"go/luaapi"
+	"go/luavm"
+	"testing"
+)
+
+func abc(op, a, b, c int) uint32 {
+	return uint32(op | a<<6 | c<<14 | b<<23)
+}
+
+//TestNewTableSizeHint NEWTABLE的B、C只是预分配的大小，不可信的chunk给出很大的值也不能让make失败
+func TestNewTableSizeHint(t *testing.T) {
+	for _, size := range []int{255, 511, 0x1F8} {
+		proto := &binchunk.Prototype{
+			Source:        "=test",
+			MaxStatckSize: 2,
+			Code: []uint32{
+				abc(luavm.OP_NEWTABLE, 0, size, size),
+				abc(luavm.OP_RETURN, 0, 2, 0),
+			},
+		}
+		ls := New()
+		if status := ls.Load(binchunk.Dump(proto, true), "=test", "bv"); status != luaapi.LUA_OK {
+			t.Fatalf("NEWTABLE 0 %d %d: load: %v", size, size, ls.ToString(-1))
+		}
+		if status := ls.PCall(0, 1, 0); status != luaapi.LUA_OK {
+			t.Fatalf("NEWTABLE 0 %d %d: %v", size, size, ls.ToString(-1))
+		}
+		if !ls.IsTable(-1) {
+			t.Errorf("NEWTABLE 0 %d %d returned %s", size, size, ls.TypeName(ls.Type(-1)))
+		}
+	}
+}
+
+func TestCreateTableSizeHint(t *testing.T) {
+	ls := New()
+	ls.CreateTable(1<<40, -1)
+	ls.PushInteger(1)
+	ls.SetI(-2, 1)
+	if ls.GetI(-1, 1) != luaapi.LUA_TNUMBER || ls.ToInteger(-1) != 1 {
+		t.Errorf("t[1] = %v, want 1", ls.ToString(-1))
+	}
+}
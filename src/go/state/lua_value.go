@@ -24,6 +24,10 @@ func typeOf(val luaValue) luaapi.LuaType {
 		return luaapi.LUA_TTABLE
 	case *luaClosure:
 		return luaapi.LUA_TFUNCTION
+	case *luaState:
+		return luaapi.LUA_TTHREAD
+	case *userdata:
+		return luaapi.LUA_TUSERDATA
 	default:
 		panic("not impl val type!!!")
 	}
@@ -81,6 +85,10 @@ func LuaValToString(val luaValue) string {
 		return x.ParserToString()
 	case *luaClosure:
 		return "luaClosure"
+	case *luaState:
+		return "thread"
+	case *userdata:
+		return "userdata"
 	default:
 		panic("not impl val type!!!")
 	}
@@ -91,17 +99,24 @@ func PrintLuaVal(val luaValue) {
 }
 
 func setMetatable(val luaValue, mt *luaTable, ls *luaState) {
-	if t, ok := val.(*luaTable); ok {
-		t.metaTable = mt
+	switch x := val.(type) {
+	case *luaTable:
+		x.metaTable = mt
+		return
+	case *userdata:
+		x.metaTable = mt
 		return
 	}
 	key := fmt.Sprintf("_MT%d", typeOf(val))
-	ls.registry.put(key, mt)
+	ls.registry.put(key, mt, ls)
 }
 
 func getMetatable(val luaValue, ls *luaState) *luaTable {
-	if t, ok := val.(*luaTable); ok {
-		return t.metaTable
+	switch x := val.(type) {
+	case *luaTable:
+		return x.metaTable
+	case *userdata:
+		return x.metaTable
 	}
 	key := fmt.Sprintf("_MT%d", typeOf(val))
 	if mt := ls.registry.get(key); mt != nil {
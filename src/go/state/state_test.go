@@ -0,0 +1,67 @@
+package state
+
+import (
+	"go/luaapi"
+	"testing"
+)
+
+//newTestState 注册测试脚本用到的几个基础函数，check(cond, msg)在cond为假时让测试失败
+func newTestState(t *testing.T) luaapi.LuaState {
+	ls := New()
+	ls.Register("pcall", func(ls luaapi.LuaState) int {
+		status := ls.PCall(ls.GetTop()-1, -1, 0)
+		ls.PushBoolean(status == luaapi.LUA_OK)
+		ls.Insert(1)
+		return ls.GetTop()
+	})
+	ls.Register("error", func(ls luaapi.LuaState) int {
+		ls.SetTop(1)
+		return ls.Error()
+	})
+	ls.Register("setmetatable", func(ls luaapi.LuaState) int {
+		ls.SetTop(2)
+		ls.SetMetatable(1)
+		return 1
+	})
+	ls.Register("select", func(ls luaapi.LuaState) int {
+		ls.PushInteger(int64(ls.GetTop() - 1))
+		return 1
+	})
+	ls.Register("tostring", func(ls luaapi.LuaState) int {
+		s, _ := ls.ToStringX(1)
+		ls.PushString(s)
+		return 1
+	})
+	ls.Register("xpcall", func(ls luaapi.LuaState) int {
+		ls.PushValue(1) //把函数和消息处理函数交换位置
+		ls.Copy(2, 1)
+		ls.Replace(2)
+		status := ls.PCall(ls.GetTop()-2, -1, 1)
+		ls.PushBoolean(status == luaapi.LUA_OK)
+		ls.Replace(1)
+		return ls.GetTop()
+	})
+	ls.Register("traceback", func(ls luaapi.LuaState) int {
+		msg, _ := ls.ToStringX(1)
+		ls.Traceback(ls, msg, 1)
+		return 1
+	})
+	ls.Register("check", func(ls luaapi.LuaState) int {
+		if !ls.ToBoolean(1) {
+			t.Errorf("check failed: %s", ls.ToString(2))
+		}
+		return 0
+	})
+	return ls
+}
+
+//run 执行一段lua代码，出错时让测试失败
+func run(t *testing.T, ls luaapi.LuaState, src string) {
+	t.Helper()
+	if status := ls.Load([]byte(src), "=test", "t"); status != luaapi.LUA_OK {
+		t.Fatalf("load: %s", ls.ToString(-1))
+	}
+	if status := ls.PCall(0, 0, 0); status != luaapi.LUA_OK {
+		t.Fatalf("run: %s", ls.ToString(-1))
+	}
+}
@@ -0,0 +1,137 @@
+package stdlib
+
+import (
+	"go/luaapi"
+)
+
+var coFuncs = libFuncs{
+	"create":      coCreate,
+	"resume":      coResume,
+	"yield":       coYield,
+	"status":      coStatus,
+	"isyieldable": coYieldable,
+	"running":     coRunning,
+	"wrap":        coWrap,
+}
+
+//OpenCoroutineLib 相当于luaopen_coroutine，把coroutine表压入栈顶
+func OpenCoroutineLib(ls luaapi.LuaState) int {
+	newLib(ls, coFuncs)
+	return 1
+}
+
+//checkCo 第一个参数必须是协程
+func checkCo(ls luaapi.LuaState, fname string) luaapi.LuaState {
+	co := ls.ToThread(1)
+	if co == nil {
+		argError(ls, 1, fname, "coroutine expected")
+	}
+	return co
+}
+
+//coroutine.create(f)
+func coCreate(ls luaapi.LuaState) int {
+	if !ls.IsFunction(1) {
+		return argError(ls, 1, "create", "function expected")
+	}
+	co := ls.NewThread()
+	ls.PushValue(1) //把函数移到新线程里
+	ls.XMove(co, 1)
+	return 1
+}
+
+//coroutine.resume(co, ...)
+func coResume(ls luaapi.LuaState) int {
+	co := checkCo(ls, "resume")
+	if r := auxResume(ls, co, ls.GetTop()-1); r < 0 {
+		ls.PushBoolean(false)
+		ls.Insert(-2)
+		return 2 //false, 错误对象
+	} else {
+		ls.PushBoolean(true)
+		ls.Insert(-(r + 1))
+		return r + 1 //true, 返回值或者yield传出的值
+	}
+}
+
+//auxResume 把narg个参数交给co执行，返回结果的个数，出错时返回-1并把错误对象留在栈顶
+func auxResume(ls, co luaapi.LuaState, narg int) int {
+	if co.Status() == luaapi.LUA_OK && co.GetTop() == 0 {
+		ls.PushString("cannot resume dead coroutine")
+		return -1
+	}
+	ls.XMove(co, narg)
+	status := co.Resume(ls, narg)
+	if status == luaapi.LUA_OK || status == luaapi.LUA_YIELD {
+		nres := co.GetTop()
+		co.XMove(ls, nres)
+		return nres
+	}
+	co.XMove(ls, 1)
+	return -1
+}
+
+//coroutine.yield(...)
+func coYield(ls luaapi.LuaState) int {
+	return ls.Yield(ls.GetTop())
+}
+
+//coroutine.status(co)
+func coStatus(ls luaapi.LuaState) int {
+	co := checkCo(ls, "status")
+	ls.PushString(auxStatus(ls, co))
+	return 1
+}
+
+func auxStatus(ls, co luaapi.LuaState) string {
+	if ls == co {
+		return "running"
+	}
+	switch co.Status() {
+	case luaapi.LUA_YIELD:
+		return "suspended"
+	case luaapi.LUA_OK:
+		if co.GetStack() { //正在resume别的协程
+			return "normal"
+		} else if co.GetTop() == 0 {
+			return "dead"
+		} else {
+			return "suspended" //还没有开始执行
+		}
+	default: //出错了
+		return "dead"
+	}
+}
+
+//coroutine.isyieldable()
+func coYieldable(ls luaapi.LuaState) int {
+	ls.PushBoolean(ls.IsYieldable())
+	return 1
+}
+
+//coroutine.running()
+func coRunning(ls luaapi.LuaState) int {
+	isMain := ls.PushThread()
+	ls.PushBoolean(isMain)
+	return 2
+}
+
+//coroutine.wrap(f)
+func coWrap(ls luaapi.LuaState) int {
+	coCreate(ls)
+	ls.PushGoFunction(auxWrap, 1) //协程是返回的函数的upvalue
+	return 1
+}
+
+func auxWrap(ls luaapi.LuaState) int {
+	co := ls.ToThread(luaapi.LuaUpvaluesIndex(1))
+	if r := auxResume(ls, co, ls.GetTop()); r >= 0 {
+		return r
+	}
+	if ls.Type(-1) == luaapi.LUA_TSTRING { //错误是字符串时加上调用者的位置
+		ls.Where(1)
+		ls.Insert(-2)
+		ls.Concat(2)
+	}
+	return ls.Error() //把错误传给调用者
+}
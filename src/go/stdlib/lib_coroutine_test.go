@@ -0,0 +1,122 @@
+package stdlib
+
+import (
+	"go/luaapi"
+	"go/state"
+	"testing"
+)
+
+//run 打开标准库执行一段lua代码，check(cond, msg)在cond为假时让测试失败
+func run(t *testing.T, src string) {
+	t.Helper()
+	ls := state.New()
+	OpenLibs(ls)
+	ls.Register("pcall", func(ls luaapi.LuaState) int {
+		status := ls.PCall(ls.GetTop()-1, -1, 0)
+		ls.PushBoolean(status == luaapi.LUA_OK)
+		ls.Insert(1)
+		return ls.GetTop()
+	})
+	ls.Register("error", func(ls luaapi.LuaState) int {
+		ls.SetTop(1)
+		return ls.Error()
+	})
+	ls.Register("select", func(ls luaapi.LuaState) int {
+		ls.PushInteger(int64(ls.GetTop() - 1))
+		return 1
+	})
+	ls.Register("check", func(ls luaapi.LuaState) int {
+		if !ls.ToBoolean(1) {
+			msg, _ := ls.ToStringX(2)
+			t.Errorf("check failed: %s", msg)
+		}
+		return 0
+	})
+	if status := ls.Load([]byte(src), "=test", "t"); status != luaapi.LUA_OK {
+		t.Fatalf("load: %s", ls.ToString(-1))
+	}
+	if status := ls.PCall(0, 0, 0); status != luaapi.LUA_OK {
+		t.Fatalf("run: %s", ls.ToString(-1))
+	}
+}
+
+func TestCoroutineStatus(t *testing.T) {
+	run(t, `
+		local co
+		co = coroutine.create(function(a, b)
+			check(coroutine.status(co) == "running", "status inside")
+			check(coroutine.isyieldable(), "isyieldable inside")
+			local inner = coroutine.create(function()
+				check(coroutine.status(co) == "normal", "status of the resumer")
+			end)
+			coroutine.resume(inner)
+			local c = coroutine.yield(a + b)
+			return c * 2
+		end)
+		check(coroutine.status(co) == "suspended", "status before resume")
+		check(not coroutine.isyieldable(), "main thread is yieldable")
+
+		local ok, sum = coroutine.resume(co, 1, 2)
+		check(ok and sum == 3, "yielded value")
+		check(coroutine.status(co) == "suspended", "status after yield")
+
+		local ok, r = coroutine.resume(co, 5)
+		check(ok and r == 10, "return value")
+		check(coroutine.status(co) == "dead", "status after return")
+
+		local ok, err = coroutine.resume(co)
+		check(not ok and err == "cannot resume dead coroutine", err)
+
+		local main, ismain = coroutine.running()
+		check(ismain, "running in the main thread")
+	`)
+}
+
+func TestCoroutineError(t *testing.T) {
+	run(t, `
+		local co = coroutine.create(function() error("boom") end)
+		local ok, err = coroutine.resume(co)
+		check(not ok and err == "boom", "error from the coroutine")
+		check(coroutine.status(co) == "dead", "status after error")
+
+		local ok, err = pcall(coroutine.resume, 1)
+		check(not ok and err == "bad argument #1 to 'resume' (coroutine expected)", err)
+		local ok, err = pcall(coroutine.create, 1)
+		check(not ok and err == "bad argument #1 to 'create' (function expected)", err)
+		local ok, err = pcall(coroutine.yield, 1)
+		check(not ok and err == "attempt to yield from outside a coroutine", err)
+	`)
+}
+
+func TestCoroutineWrap(t *testing.T) {
+	run(t, `
+		local gen = coroutine.wrap(function(n)
+			for i = 1, n do coroutine.yield(i) end
+			return "done"
+		end)
+		check(gen(3) == 1 and gen() == 2 and gen() == 3, "yielded values")
+		check(gen() == "done", "return value")
+		local ok, err = pcall(gen)
+		check(not ok and err == "cannot resume dead coroutine", err)
+		ok, err = pcall(function()
+			return gen()
+		end)
+		check(not ok and err == "test:11: cannot resume dead coroutine", err)
+		local boom = coroutine.wrap(function()
+			error("boom")
+		end)
+		ok, err = pcall(function() boom() end)
+		check(not ok and err == "test:17: boom", err)
+
+		local failing = coroutine.wrap(function() error({code = 42}) end)
+		local ok, err = pcall(failing)
+		check(not ok and err.code == 42, "wrap passes the error object through")
+
+		--yield可以穿过Go函数
+		local co = coroutine.wrap(function() return pcall(coroutine.yield, 1) end)
+		check(co() == 1, "yield across pcall")
+		local ok, v = co(2)
+		check(ok and v == 2, "resume across pcall")
+		check(select("#", coroutine.wrap(function() end)()) == 0, "no results")
+	`)
+}
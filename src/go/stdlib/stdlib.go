@@ -0,0 +1,46 @@
+/*
+stdlib 用luaapi实现的lua标准库。
+
+	ls := state.New()
+	stdlib.OpenLibs(ls)
+*/
+package stdlib
+
+import (
+	"fmt"
+	"go/luaapi"
+)
+
+type libFuncs map[string]luaapi.GoFunction
+
+//libs OpenLibs打开的库，名字是对应的全局变量
+var libs = []struct {
+	name string
+	open luaapi.GoFunction
+}{
+	{"coroutine", OpenCoroutineLib},
+}
+
+//OpenLibs 打开所有的库，每个库的表保存到同名的全局变量里
+func OpenLibs(ls luaapi.LuaState) {
+	for _, lib := range libs {
+		ls.PushGoFunction(lib.open, 0)
+		ls.Call(0, 1)
+		ls.SetGlobal(lib.name)
+	}
+}
+
+//newLib 创建一个包含funcs的表，压入栈顶
+func newLib(ls luaapi.LuaState, funcs libFuncs) {
+	ls.CreateTable(0, len(funcs))
+	for name, f := range funcs {
+		ls.PushGoFunction(f, 0)
+		ls.SetField(-2, name)
+	}
+}
+
+//argError 和luaL_argerror一样抛出"bad argument #arg to 'fname' (msg)"
+func argError(ls luaapi.LuaState, arg int, fname, msg string) int {
+	ls.PushString(fmt.Sprintf("bad argument #%d to '%s' (%s)", arg, fname, msg))
+	return ls.Error()
+}